@@ -0,0 +1,221 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/goodrain/rainbond-oam/pkg/compose"
+	"github.com/goodrain/rainbond-oam/pkg/oam"
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// the targets of convert
+const (
+	oamTarget        = "oam"
+	kubernetesTarget = "kubernetes"
+	helmTarget       = "helm"
+	composeTarget    = "compose"
+)
+
+type convertFlags struct {
+	target          string
+	output          string
+	pack            bool
+	namespace       string
+	domain          string
+	streamRouteMode string
+	monitorMode     string
+	diagnostics     *oam.Diagnostics
+}
+
+func runConvert(c *cli, args []string) int {
+	var flags convertFlags
+	fs := c.flagSet("convert", "[file]")
+	fs.StringVar(&flags.target, "target", oamTarget, "the output: oam, kubernetes, helm or compose")
+	fs.StringVar(&flags.output, "o", "", "write the output files into the directory instead of stdout")
+	fs.BoolVar(&flags.pack, "package", false, "write the helm chart as a .tgz archive into the output directory")
+	fs.StringVar(&flags.namespace, "namespace", "", "the namespace the application is installed to")
+	fs.StringVar(&flags.domain, "domain", "", "the domain suffix of the http routes use the default domain")
+	fs.StringVar(&flags.streamRouteMode, "stream-route-mode", "", "how the tcp/udp routes are exposed: LoadBalancer, NodePort or NginxConfigMap")
+	fs.StringVar(&flags.monitorMode, "monitor-mode", "", "how the component monitors are output: ServiceMonitor or ScrapeConfig")
+	file, code, ok := c.parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if flags.pack && (flags.target != helmTarget || flags.output == "") {
+		fmt.Fprintln(c.stderr, "-package requires -target helm and -o")
+		return exitUsage
+	}
+	ram, err := c.loadRAM(file)
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	ram.HandleNullValue()
+	flags.diagnostics = oam.NewDiagnostics()
+	var files map[string][]byte
+	switch flags.target {
+	case oamTarget, kubernetesTarget:
+		files, err = convertObjects(*ram, flags)
+	case helmTarget:
+		files, err = c.convertHelm(*ram, flags)
+	case composeTarget:
+		files, err = c.convertCompose(*ram, flags)
+	default:
+		fmt.Fprintf(c.stderr, "unknown target %q\n", flags.target)
+		return exitUsage
+	}
+	for _, d := range flags.diagnostics.Items() {
+		fmt.Fprintln(c.stderr, d)
+	}
+	if err != nil {
+		return c.fail("convert %s failure: %v", inputName(file), err)
+	}
+	if flags.output != "" {
+		if err := writeFiles(flags.output, files); err != nil {
+			return c.fail("write output failure: %v", err)
+		}
+		return exitOK
+	}
+	c.stdout.Write(joinDocuments(files))
+	return exitOK
+}
+
+func (f convertFlags) options() []oam.Option {
+	var opts []oam.Option
+	if f.namespace != "" {
+		opts = append(opts, oam.WithNamespace(f.namespace))
+	}
+	if f.domain != "" {
+		opts = append(opts, oam.WithIngressDomain(f.domain))
+	}
+	if f.streamRouteMode != "" {
+		opts = append(opts, oam.WithStreamRouteMode(oam.StreamRouteMode(f.streamRouteMode)))
+	}
+	if f.monitorMode != "" {
+		opts = append(opts, oam.WithMonitorMode(oam.MonitorMode(f.monitorMode)))
+	}
+	if f.diagnostics != nil {
+		opts = append(opts, oam.WithDiagnostics(f.diagnostics))
+	}
+	return opts
+}
+
+// convertObjects one file for each object, named after the kind and the name of the object
+func convertObjects(ram v1alpha1.RainbondApplicationConfig, flags convertFlags) (map[string][]byte, error) {
+	builder := oam.NewBuilder(ram, flags.options()...)
+	if flags.target == kubernetesTarget {
+		builder = oam.NewKubernetesBuilder(ram, flags.options()...)
+	}
+	app, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for i, obj := range app.Objects() {
+		body, err := oam.MarshalObjects([]runtime.Object{obj})
+		if err != nil {
+			return nil, err
+		}
+		// the order of the objects is kept by the prefix, the definitions are applied before the components
+		files[fmt.Sprintf("%03d-%s.yaml", i, objectFileName(obj))] = body
+	}
+	return files, nil
+}
+
+func objectFileName(obj runtime.Object) string {
+	name := strings.ToLower(obj.GetObjectKind().GroupVersionKind().Kind)
+	if accessor, err := meta.Accessor(obj); err == nil {
+		name += "-" + accessor.GetName()
+	}
+	return name
+}
+
+func (c *cli) convertHelm(ram v1alpha1.RainbondApplicationConfig, flags convertFlags) (map[string][]byte, error) {
+	chart, err := oam.NewHelmChart(ram, flags.options()...)
+	if err != nil {
+		return nil, err
+	}
+	if flags.pack {
+		var archive bytes.Buffer
+		if err := chart.WriteArchive(&archive); err != nil {
+			return nil, err
+		}
+		return map[string][]byte{chart.ArchiveName(): archive.Bytes()}, nil
+	}
+	files := make(map[string][]byte, len(chart.Files))
+	for name, content := range chart.Files {
+		files[path.Join(chart.Name, name)] = content
+	}
+	return files, nil
+}
+
+// convertCompose the report is written to stderr, the config files can only be written into the output directory
+func (c *cli) convertCompose(ram v1alpha1.RainbondApplicationConfig, flags convertFlags) (map[string][]byte, error) {
+	exported, err := compose.Export(ram)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range exported.Report {
+		fmt.Fprintf(c.stderr, "warning: %s\n", w)
+	}
+	body, err := exported.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{compose.FileName: body}
+	if flags.output == "" {
+		for name := range exported.Files {
+			fmt.Fprintf(c.stderr, "warning: config file %s is not written to stdout, use -o to write it\n", name)
+		}
+		return files, nil
+	}
+	for name, content := range exported.Files {
+		files[name] = content
+	}
+	return files, nil
+}
+
+// joinDocuments join the files as multi-document yaml in the order of the names, each document is
+// headed by the name of the file
+func joinDocuments(files map[string][]byte) []byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		fmt.Fprintf(&buf, "# Source: %s\n", name)
+		buf.Write(files[name])
+		if content := files[name]; len(content) > 0 && content[len(content)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
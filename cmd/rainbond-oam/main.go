@@ -0,0 +1,175 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// the exit codes, the usage error is distinguished from the failure of the command
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(cli *cli, args []string) int
+}
+
+var commands = []command{
+	{name: "convert", usage: "convert a rainbond application config into oam, kubernetes, helm or compose output", run: runConvert},
+	{name: "validate", usage: "validate a rainbond application config, exit non-zero on errors", run: runValidate},
+	{name: "diff", usage: "show the changes between two versions of a rainbond application config", run: runDiff},
+	{name: "migrate", usage: "migrate a rainbond application config to the template version", run: runMigrate},
+	{name: "schema", usage: "print the json schema of the rainbond application config", run: runSchema},
+	{name: "normalize", usage: "fill the null values of a rainbond application config and write it canonically", run: runNormalize},
+}
+
+// cli the standard streams of the command, they are replaced in tests
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	os.Exit(c.run(os.Args[1:]))
+}
+
+func (c *cli) run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		c.usage()
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(c, args[1:])
+		}
+	}
+	fmt.Fprintf(c.stderr, "unknown command %q\n", args[0])
+	c.usage()
+	return exitUsage
+}
+
+func (c *cli) usage() {
+	fmt.Fprintf(c.stderr, "Usage: rainbond-oam <command> [flags] [file]\n\nThe file is read from stdin if it is absent or -.\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+// flagSet new flag set reports the errors to stderr
+func (c *cli) flagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: rainbond-oam %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parse the flags and return the input file, the exit code is returned if the command must stop
+func (c *cli) parseFlags(fs *flag.FlagSet, args []string) (string, int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return "", exitOK, false
+		}
+		return "", exitUsage, false
+	}
+	switch fs.NArg() {
+	case 0:
+		return "-", exitOK, true
+	case 1:
+		return fs.Arg(0), exitOK, true
+	default:
+		fmt.Fprintf(c.stderr, "expect one input file, got %d\n", fs.NArg())
+		fs.Usage()
+		return "", exitUsage, false
+	}
+}
+
+func (c *cli) readInput(file string) ([]byte, error) {
+	if file == "-" {
+		return ioutil.ReadAll(c.stdin)
+	}
+	return ioutil.ReadFile(file)
+}
+
+// loadRAM load the application config, json and yaml are both accepted
+func (c *cli) loadRAM(file string) (*v1alpha1.RainbondApplicationConfig, error) {
+	body, err := c.readInput(file)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRAM(file, body)
+}
+
+func decodeRAM(file string, body []byte) (*v1alpha1.RainbondApplicationConfig, error) {
+	var ram v1alpha1.RainbondApplicationConfig
+	if err := yaml.Unmarshal(body, &ram); err != nil {
+		return nil, fmt.Errorf("parse %s failure %s", inputName(file), err.Error())
+	}
+	return &ram, nil
+}
+
+func inputName(file string) string {
+	if file == "-" {
+		return "stdin"
+	}
+	return file
+}
+
+// writeFiles write the files keyed by the path relative to dir
+func writeFiles(dir string, files map[string][]byte) error {
+	for name, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if rel, err := filepath.Rel(dir, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("file %s is out of the directory %s", name, dir)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cli) fail(format string, args ...interface{}) int {
+	fmt.Fprintf(c.stderr, format+"\n", args...)
+	return exitFailure
+}
@@ -0,0 +1,189 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+)
+
+func testRAM() []byte {
+	ram := v1alpha1.RainbondApplicationConfig{
+		AppKeyID:   "5d8a5fc1d2b44a4dbc8c6a1e0c9d5e11",
+		AppName:    "nginx",
+		AppVersion: "1.0",
+		Components: []*v1alpha1.Component{{
+			ServiceKey:   "a1b2c3d4e5f6",
+			ServiceCname: "Nginx",
+			ServiceAlias: "nginx",
+			Image:        "nginx:1.19",
+			DeployType:   v1alpha1.StatelessMultipleDeployType,
+			Memory:       128,
+			Ports:        []v1alpha1.ComponentPort{{ContainerPort: 80, Protocol: "http", IsInner: true, IsOuter: true}},
+		}},
+	}
+	body, _ := json.Marshal(ram)
+	return body
+}
+
+func runCLI(stdin []byte, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: bytes.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	code := c.run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestConvert(t *testing.T) {
+	for target, expect := range map[string]string{
+		"oam":        "kind: ApplicationConfiguration",
+		"kubernetes": "kind: Deployment",
+		"helm":       "# Source: nginx/values.yaml",
+		"compose":    "image: nginx:1.19",
+	} {
+		code, stdout, stderr := runCLI(testRAM(), "convert", "-target", target)
+		if code != exitOK {
+			t.Fatalf("convert to %s exit %d: %s", target, code, stderr)
+		}
+		if !strings.Contains(stdout, expect) {
+			t.Fatalf("convert to %s expect %q in\n%s", target, expect, stdout)
+		}
+	}
+	if code, _, _ := runCLI(testRAM(), "convert", "-target", "unknown"); code != exitUsage {
+		t.Fatalf("unknown target expect exit %d, got %d", exitUsage, code)
+	}
+	dir, err := ioutil.TempDir("", "rainbond-oam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if code, _, stderr := runCLI(testRAM(), "convert", "-target", "helm", "-package", "-o", dir); code != exitOK {
+		t.Fatalf("package helm chart exit %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nginx-1.0.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if code, stdout, _ := runCLI(testRAM(), "validate"); code != exitOK || !strings.Contains(stdout, "stdin: ok") {
+		t.Fatalf("validate expect ok, got %d %s", code, stdout)
+	}
+	if code, _, stderr := runCLI([]byte(`{"apps": []}`), "validate"); code != exitFailure || stderr == "" {
+		t.Fatalf("validate the application without component expect failure, got %d", code)
+	}
+	invalid := `{"apps": [{"service_key": "a", "dep_service_map_list": [{"dep_service_key": "b"}]}, {"service_key": "a", "service_env_map_list": [{"attr_name": "1A"}]}]}`
+	if code, _, stderr := runCLI([]byte(invalid), "validate"); code != exitFailure || strings.Count(stderr, "\n") != 4 ||
+		!strings.Contains(stderr, "stdin: apps[1].service_env_map_list[0].attr_name: ") {
+		t.Fatalf("validate expect every invalid field, got %d %s", code, stderr)
+	}
+	mismatch := "{\n  \"apps\": [{\"service_key\": \"a\", \"extend_method\": \"unknown\", \"memory\": \"512\"}]\n}"
+	if code, _, stderr := runCLI([]byte(mismatch), "validate"); code != exitFailure ||
+		!strings.Contains(stderr, "stdin:2:50: apps[0].extend_method: ") || !strings.Contains(stderr, "stdin:2:71: apps[0].memory: ") {
+		t.Fatalf("validate expect the schema errors with positions, got %d %s", code, stderr)
+	}
+	if code, _, _ := runCLI([]byte(`{`), "validate"); code != exitFailure {
+		t.Fatalf("validate malformed file expect failure, got %d", code)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rainbond-oam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "app.json")
+	ioutil.WriteFile(file, testRAM(), 0644)
+	if code, _, _ := runCLI(nil, "normalize", "-check", file); code != exitFailure {
+		t.Fatalf("the compact file is not normalized, got exit %d", code)
+	}
+	if code, _, stderr := runCLI(nil, "normalize", "-w", file); code != exitOK {
+		t.Fatalf("normalize exit %d: %s", code, stderr)
+	}
+	if code, _, stderr := runCLI(nil, "normalize", "-check", file); code != exitOK {
+		t.Fatalf("the normalized file must be canonical, got exit %d: %s", code, stderr)
+	}
+	body, _ := ioutil.ReadFile(file)
+	if !strings.Contains(string(body), `"template_version": "v2"`) || !strings.Contains(string(body), `"probes": []`) {
+		t.Fatalf("the null values are not handled:\n%s", body)
+	}
+	if code, stdout, _ := runCLI(body, "normalize"); code != exitOK || stdout != string(body) {
+		t.Fatal("normalize from stdin must write the same content to stdout")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	legacy := []byte("apps:\n- service_key: a\n  extend_method: stateless\n  memory: \"128\"\n")
+	code, stdout, stderr := runCLI(legacy, "migrate")
+	if code != exitOK {
+		t.Fatalf("migrate exit %d: %s", code, stderr)
+	}
+	var ram v1alpha1.RainbondApplicationConfig
+	if err := json.Unmarshal([]byte(stdout), &ram); err != nil {
+		t.Fatal(err)
+	}
+	if ram.TempleteVersion != v1alpha1.LatestTemplateVersion || ram.Components[0].DeployType != v1alpha1.StatelessMultipleDeployType || ram.Components[0].Memory != 128 {
+		t.Fatalf("unexpected migrated template %s", stdout)
+	}
+	if code, _, _ := runCLI([]byte(stdout), "migrate", "-to", "v2"); code != exitFailure {
+		t.Fatalf("downgrade expect failure, got %d", code)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rainbond-oam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	old, new := filepath.Join(dir, "old.json"), filepath.Join(dir, "new.yaml")
+	ioutil.WriteFile(old, []byte(`{"group_version": "1.0", "apps": [{"service_key": "a", "service_cname": "web", "image": "nginx:1.19"}]}`), 0644)
+	ioutil.WriteFile(new, []byte("group_version: \"1.1\"\napps:\n- service_key: a\n  service_cname: web\n  image: nginx:1.21\n"), 0644)
+	code, stdout, stderr := runCLI(nil, "diff", old, new)
+	if code != exitOK || !strings.Contains(stdout, "~ component web (a)\n    ~ image: \"nginx:1.19\" -> \"nginx:1.21\"\n") {
+		t.Fatalf("diff exit %d: %s%s", code, stdout, stderr)
+	}
+	if code, stdout, _ := runCLI(nil, "diff", "-json", old, new); code != exitOK || !strings.Contains(stdout, `"path":"image"`) {
+		t.Fatalf("diff -json exit %d: %s", code, stdout)
+	}
+	if code, _, _ := runCLI(nil, "diff", old); code != exitUsage {
+		t.Fatalf("diff with one file expect usage error, got %d", code)
+	}
+}
+
+func TestWriteFilesOutOfDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rainbond-oam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := writeFiles(filepath.Join(dir, "out"), map[string][]byte{"../evil": []byte("evil")}); err == nil {
+		t.Fatal("expect error for the file out of the directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); err == nil {
+		t.Fatal("the file out of the directory is written")
+	}
+}
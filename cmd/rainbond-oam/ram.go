@@ -0,0 +1,206 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+func runValidate(c *cli, args []string) int {
+	fs := c.flagSet("validate", "[file]")
+	file, code, ok := c.parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	body, err := c.readInput(file)
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	// the json is checked against the schema first, the errors have the line and the column
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		if err := v1alpha1.ValidateJSON(body); err != nil {
+			for _, se := range err.(v1alpha1.SchemaErrors) {
+				fmt.Fprintf(c.stderr, "%s:%v\n", inputName(file), se)
+			}
+			return exitFailure
+		}
+	}
+	ram, err := decodeRAM(file, body)
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	ram.HandleNullValue()
+	if err := ram.Validation(); err != nil {
+		// every invalid field is reported on its own line
+		if errs, ok := err.(v1alpha1.ValidationErrors); ok {
+			for _, fe := range errs {
+				fmt.Fprintf(c.stderr, "%s: %v\n", inputName(file), fe)
+			}
+			return exitFailure
+		}
+		return c.fail("%s: %v", inputName(file), err)
+	}
+	fmt.Fprintf(c.stdout, "%s: ok\n", inputName(file))
+	return exitOK
+}
+
+func runSchema(c *cli, args []string) int {
+	fs := c.flagSet("schema", "")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	c.stdout.Write(v1alpha1.SchemaJSON())
+	return exitOK
+}
+
+func runNormalize(c *cli, args []string) int {
+	fs := c.flagSet("normalize", "[file]")
+	write := fs.Bool("w", false, "write the result to the input file instead of stdout")
+	output := fs.String("o", "", "write the result into the directory with the name of the input file")
+	check := fs.Bool("check", false, "write nothing, exit non-zero if the file is not canonical")
+	file, code, ok := c.parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if *write && file == "-" {
+		fmt.Fprintln(c.stderr, "-w requires an input file")
+		return exitUsage
+	}
+	body, err := c.readInput(file)
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	ram, err := decodeRAM(file, body)
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	ram.HandleNullValue()
+	normalized, err := json.MarshalIndent(ram, "", "  ")
+	if err != nil {
+		return c.fail("marshal %s failure: %v", inputName(file), err)
+	}
+	normalized = append(normalized, '\n')
+	switch {
+	case *check:
+		if !bytes.Equal(body, normalized) {
+			return c.fail("%s is not normalized", inputName(file))
+		}
+	case *write:
+		if err := ioutil.WriteFile(file, normalized, 0644); err != nil {
+			return c.fail("%v", err)
+		}
+	case *output != "":
+		name := "app.json"
+		if file != "-" {
+			name = filepath.Base(file)
+		}
+		if err := writeFiles(*output, map[string][]byte{name: normalized}); err != nil {
+			return c.fail("%v", err)
+		}
+	default:
+		c.stdout.Write(normalized)
+	}
+	return exitOK
+}
+
+// runMigrate the yaml is migrated as json, the result is always json
+func runMigrate(c *cli, args []string) int {
+	fs := c.flagSet("migrate", "[file]")
+	target := fs.String("to", v1alpha1.LatestTemplateVersion, "the target template version")
+	write := fs.Bool("w", false, "write the result to the input file instead of stdout")
+	file, code, ok := c.parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if *write && file == "-" {
+		fmt.Fprintln(c.stderr, "-w requires an input file")
+		return exitUsage
+	}
+	body, err := c.readInput(file)
+	if err != nil {
+		return c.fail("%v", err)
+	}
+	raw, err := yaml.YAMLToJSON(body)
+	if err != nil {
+		return c.fail("parse %s failure %s", inputName(file), err.Error())
+	}
+	migrated, err := v1alpha1.Migrate(raw, *target)
+	if err != nil {
+		return c.fail("%s: %v", inputName(file), err)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, bytes.TrimSpace(migrated), "", "  "); err != nil {
+		return c.fail("%v", err)
+	}
+	out.WriteByte('\n')
+	if *write {
+		if err := ioutil.WriteFile(file, out.Bytes(), 0644); err != nil {
+			return c.fail("%v", err)
+		}
+		return exitOK
+	}
+	c.stdout.Write(out.Bytes())
+	return exitOK
+}
+
+func runDiff(c *cli, args []string) int {
+	fs := c.flagSet("diff", "<old> <new>")
+	asJSON := fs.Bool("json", false, "write the changes as json instead of text")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintf(c.stderr, "expect the old and the new files, got %d files\n", fs.NArg())
+		fs.Usage()
+		return exitUsage
+	}
+	var rams []*v1alpha1.RainbondApplicationConfig
+	for _, file := range fs.Args() {
+		ram, err := c.loadRAM(file)
+		if err != nil {
+			return c.fail("%v", err)
+		}
+		rams = append(rams, ram)
+	}
+	d := v1alpha1.Diff(rams[0], rams[1])
+	if *asJSON {
+		fmt.Fprintln(c.stdout, d.JSON())
+		return exitOK
+	}
+	fmt.Fprint(c.stdout, d.String())
+	return exitOK
+}
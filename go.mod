@@ -3,9 +3,11 @@ module github.com/goodrain/rainbond-oam
 go 1.13
 
 require (
+	github.com/crossplane/crossplane-runtime v0.8.0
 	github.com/crossplane/oam-kubernetes-runtime v0.1.0
 	github.com/google/uuid v1.1.1
 	github.com/sirupsen/logrus v1.4.2
-	k8s.io/api v0.18.5
-	k8s.io/apimachinery v0.18.5
+	k8s.io/api v0.19.16
+	k8s.io/apimachinery v0.19.16
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,433 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package compose
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goodrain/rainbond-oam/pkg/oam"
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"github.com/goodrain/rainbond-oam/pkg/util"
+	"sigs.k8s.io/yaml"
+)
+
+//FileName the name of the exported compose file
+var FileName = "docker-compose.yml"
+
+//FileVersion the version of the exported compose file
+var FileVersion = "3.8"
+
+//ConfigDir the directory holds the config files, it is relative to the compose file
+var ConfigDir = "configs"
+
+//Exported the compose file exported from the application
+type Exported struct {
+	File *File
+	// Files the config files bind mounted by the services, keyed by the path relative to the compose file
+	Files map[string][]byte
+	// Report the features of the application compose can not express
+	Report []Warning
+}
+
+type exporter struct {
+	ram      v1alpha1.RainbondApplicationConfig
+	exported *Exported
+	report   warnings
+	// names component key -> service name
+	names map[string]string
+	// published the host ports published by the services
+	published map[string]string
+}
+
+//Export render the application as a compose file for local development. The dependencies become depends_on,
+//the connection envs of the dependencies are set on the dependents, the config files are written next to the
+//compose file and bind mounted. The routes, plugins, monitors and probes compose can not run are reported.
+func Export(ram v1alpha1.RainbondApplicationConfig) (*Exported, error) {
+	e := &exporter{
+		ram: ram,
+		exported: &Exported{
+			File:  &File{Version: FileVersion, Services: map[string]*Service{}, Volumes: map[string]*Volume{}},
+			Files: map[string][]byte{},
+		},
+		names:     map[string]string{},
+		published: map[string]string{},
+	}
+	for _, com := range ram.Components {
+		name := serviceAlias(firstNonEmpty(com.ServiceAlias, com.ServiceName, com.ServiceCname), com.ServiceKey)
+		base := name
+		for i := 1; e.exported.File.Services[name] != nil; i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		e.names[com.ServiceKey] = name
+		e.exported.File.Services[name] = &Service{}
+	}
+	for _, com := range ram.Components {
+		if err := e.exportComponent(com); err != nil {
+			return nil, fmt.Errorf("component %s: %v", com.ServiceCname, err)
+		}
+	}
+	e.exportConfigGroups()
+	e.reportRoutes()
+	if len(e.exported.File.Volumes) == 0 {
+		e.exported.File.Volumes = nil
+	}
+	e.exported.Report = e.report
+	return e.exported, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// escape the dollars are escaped, compose does not interpolate them with the host envs
+func escape(value string) string {
+	return strings.Replace(value, "$", "$$", -1)
+}
+
+func (e *exporter) exportComponent(com *v1alpha1.Component) error {
+	name := e.names[com.ServiceKey]
+	svc := e.exported.File.Services[name]
+	svc.Image = firstNonEmpty(com.Image, com.ShareImage)
+	if svc.Image == "" {
+		return fmt.Errorf("the component has no image")
+	}
+	if com.AppImage.HubUser != "" || com.AppImage.HubPassword != "" {
+		e.report.add(name, "image", "the image is pulled with the hub credential, run docker login %s first", com.AppImage.HubURL)
+	}
+	if com.Cmd != "" {
+		words, err := util.SplitShellWords(com.Cmd)
+		if err != nil {
+			return fmt.Errorf("parse cmd: %v", err)
+		}
+		if strings.Contains(util.JoinShellWords(words), "${") {
+			e.report.add(name, "command", "the env references in the cmd are not expanded by docker")
+		}
+		svc.Command = Command(escape(com.Cmd))
+	}
+	e.exportEnvs(com, svc)
+	e.exportVolumes(com)
+	for _, dep := range com.DepServiceMapList {
+		depName, ok := e.names[dep.DepServiceKey]
+		if !ok {
+			return fmt.Errorf("the component depends on unknown component %s", dep.DepServiceKey)
+		}
+		svc.DependsOn = append(svc.DependsOn, depName)
+	}
+	e.exportPorts(com, svc)
+	e.exportProbe(com, svc)
+	e.exportResources(com, svc)
+	for _, config := range com.ServicePluginConfigs {
+		e.report.add(name, "plugins", "plugin %s is not exported", pluginName(e.ram.Plugins, config.PluginID))
+	}
+	for _, monitor := range com.ComponentMonitor {
+		e.report.add(name, "monitors", "monitor %s of port %d is not exported", monitor.Name, monitor.Port)
+	}
+	return nil
+}
+
+func pluginName(plugins []v1alpha1.Plugin, pluginID string) string {
+	for _, plugin := range plugins {
+		if plugin.PluginID == pluginID {
+			return firstNonEmpty(plugin.PluginAlias, plugin.PluginName, pluginID)
+		}
+	}
+	return pluginID
+}
+
+// exportEnvs the envs of the component win, the connection envs of the dependencies are set in order.
+// The dependencies are reached by the local address through the mesh of rainbond, the connection envs
+// of the local address are pointed at the service of the dependency.
+func (e *exporter) exportEnvs(com *v1alpha1.Component, svc *Service) {
+	env := Environment{}
+	set := func(list []v1alpha1.ComponentEnv, host string) {
+		for _, item := range list {
+			if _, ok := env[item.AttrName]; ok {
+				continue
+			}
+			value := item.AttrValue
+			if host != "" && (value == "127.0.0.1" || value == "localhost") {
+				value = host
+			}
+			value = escape(value)
+			env[item.AttrName] = &value
+		}
+	}
+	set(com.Envs, "")
+	set(com.ServiceConnectInfoMapList, "")
+	for _, dep := range com.DepServiceMapList {
+		for _, depCom := range e.ram.Components {
+			if depCom.ServiceKey == dep.DepServiceKey {
+				set(depCom.ServiceConnectInfoMapList, e.names[depCom.ServiceKey])
+			}
+		}
+	}
+	if len(env) > 0 {
+		svc.Environment = env
+	}
+}
+
+// exportPorts the outer ports are published with the same host port, the conflicting host ports are not published
+func (e *exporter) exportPorts(com *v1alpha1.Component, svc *Service) {
+	name := e.names[com.ServiceKey]
+	for _, port := range com.Ports {
+		protocol := "tcp"
+		if strings.ToLower(port.Protocol) == "udp" {
+			protocol = "udp"
+		}
+		if !port.IsOuter {
+			svc.Expose = append(svc.Expose, strconv.Itoa(port.ContainerPort))
+			continue
+		}
+		key := fmt.Sprintf("%d/%s", port.ContainerPort, protocol)
+		if other, ok := e.published[key]; ok {
+			e.report.add(name, "ports", "host port %s is published by service %s, the port is exposed only", key, other)
+			svc.Expose = append(svc.Expose, strconv.Itoa(port.ContainerPort))
+			continue
+		}
+		e.published[key] = name
+		svc.Ports = append(svc.Ports, Port{Target: port.ContainerPort, Published: strconv.Itoa(port.ContainerPort), Protocol: protocol})
+	}
+}
+
+// exportProbe the cmd probe becomes the health check, readiness is preferred. The probes disabled by
+// rainbond are not exported
+func (e *exporter) exportProbe(com *v1alpha1.Component, svc *Service) {
+	name := e.names[com.ServiceKey]
+	var exported bool
+	for _, mode := range []v1alpha1.ProbeMode{v1alpha1.ReadinessProbeMode, v1alpha1.LivenessProbeMode, v1alpha1.StartupProbeMode} {
+		for _, probe := range com.Probes {
+			if !probe.IsUsed || v1alpha1.ParseProbeMode(string(probe.Mode)) != mode {
+				continue
+			}
+			scheme := v1alpha1.ParseProbeScheme(string(probe.Scheme))
+			if scheme == "" && strings.TrimSpace(probe.Cmd) != "" {
+				scheme = v1alpha1.CmdProbeScheme
+			}
+			if scheme != v1alpha1.CmdProbeScheme {
+				e.report.add(name, "healthcheck", "%s probe of scheme %s is not exported, the health check of compose runs a command", mode, scheme)
+				continue
+			}
+			if exported {
+				e.report.add(name, "healthcheck", "%s probe is not exported, compose supports one health check", mode)
+				continue
+			}
+			words, err := util.SplitShellWords(probe.Cmd)
+			if err != nil || len(words) == 0 {
+				e.report.add(name, "healthcheck", "%s probe has invalid cmd %q", mode, probe.Cmd)
+				continue
+			}
+			test := StringList{"CMD"}
+			for _, word := range words {
+				test = append(test, escape(word))
+			}
+			svc.Healthcheck = &Healthcheck{Test: test, Retries: probe.FailureThreshold}
+			if probe.PeriodSecond > 0 {
+				svc.Healthcheck.Interval = fmt.Sprintf("%ds", probe.PeriodSecond)
+			}
+			if probe.TimeoutSecond > 0 {
+				svc.Healthcheck.Timeout = fmt.Sprintf("%ds", probe.TimeoutSecond)
+			}
+			if probe.InitialDelaySecond > 0 {
+				svc.Healthcheck.StartPeriod = fmt.Sprintf("%ds", probe.InitialDelaySecond)
+			}
+			exported = true
+		}
+	}
+}
+
+func (e *exporter) exportResources(com *v1alpha1.Component, svc *Service) {
+	replicas := com.ExtendMethodRule.MinNode
+	if com.DeployType == v1alpha1.StateSingletonDeployType || com.DeployType == v1alpha1.StatelessSingletionDeployType {
+		replicas = 1
+	}
+	deploy := &Deploy{}
+	if replicas > 1 {
+		deploy.Replicas = &replicas
+		if len(svc.Ports) > 0 {
+			e.report.add(e.names[com.ServiceKey], "deploy.replicas", "the replicas conflict on the published host ports")
+		}
+	}
+	if com.Memory > 0 || com.CPU > 0 {
+		limits := &Resource{}
+		if com.Memory > 0 {
+			limits.Memory = Scalar(fmt.Sprintf("%dM", com.Memory))
+		}
+		if com.CPU > 0 {
+			limits.Cpus = Scalar(strconv.Itoa(com.CPU))
+		}
+		deploy.Resources = &Resources{Limits: limits}
+	}
+	if deploy.Replicas != nil || deploy.Resources != nil {
+		svc.Deploy = deploy
+	}
+}
+
+// exportVolumes the persistent volumes become named volumes, the config files are bind mounted
+func (e *exporter) exportVolumes(com *v1alpha1.Component) {
+	name := e.names[com.ServiceKey]
+	svc := e.exported.File.Services[name]
+	for _, volume := range com.ServiceVolumeMapList {
+		if !path.IsAbs(volume.VolumeMountPath) {
+			e.report.add(name, "volumes", "the mount path %s of volume %s is not absolute, it is not exported", volume.VolumeMountPath, volume.VolumeName)
+			continue
+		}
+		switch volume.VolumeType {
+		case v1alpha1.ConfigFileVolumeType:
+			file := path.Join(ConfigDir, name, strings.TrimPrefix(path.Clean(volume.VolumeMountPath), "/"))
+			e.exported.Files[file] = []byte(volume.FileContent())
+			svc.Volumes = append(svc.Volumes, Mount{Type: BindMountType, Source: "./" + file, Target: volume.VolumeMountPath, ReadOnly: true})
+		case v1alpha1.MemoryFSVolumeType:
+			svc.Volumes = append(svc.Volumes, Mount{Type: TmpfsMountType, Target: volume.VolumeMountPath})
+		default:
+			source := volumeSource(name, com, volume.VolumeName)
+			e.exported.File.Volumes[source] = &Volume{}
+			svc.Volumes = append(svc.Volumes, Mount{
+				Type:     VolumeMountType,
+				Source:   source,
+				Target:   volume.VolumeMountPath,
+				ReadOnly: volume.AccessMode == v1alpha1.ROXAccessMode,
+			})
+		}
+	}
+	for _, mnt := range com.MntReleationList {
+		e.mountShared(com, mnt)
+	}
+}
+
+func volumeSource(name string, com *v1alpha1.Component, volume string) string {
+	return name + "-" + serviceAlias(volume, com.ServiceKey)
+}
+
+// mountShared mount the named volume of the owner component, the owner is found by the share id or the key
+func (e *exporter) mountShared(com *v1alpha1.Component, mnt v1alpha1.ComponentShareVolume) {
+	name := e.names[com.ServiceKey]
+	var source string
+	for _, owner := range e.ram.Components {
+		if owner.ServiceShareID != mnt.ShareServiceUUID && owner.ServiceKey != mnt.ShareServiceUUID {
+			continue
+		}
+		for _, volume := range owner.ServiceVolumeMapList {
+			if volume.VolumeName == mnt.VolumeName && (volume.VolumeType == v1alpha1.ShareFileVolumeType || volume.VolumeType == v1alpha1.LocalVolumeType) {
+				source = volumeSource(e.names[owner.ServiceKey], owner, volume.VolumeName)
+			}
+		}
+	}
+	if source == "" {
+		e.report.add(name, "volumes", "the shared volume %s of component %s is not found, it is not mounted", mnt.VolumeName, mnt.ShareServiceUUID)
+		return
+	}
+	e.exported.File.Services[name].Volumes = append(e.exported.File.Services[name].Volumes, Mount{Type: VolumeMountType, Source: source, Target: mnt.VolumeMountDir})
+}
+
+// exportConfigGroups the env groups become the environment, the file groups are bind mounted
+func (e *exporter) exportConfigGroups() {
+	for _, group := range e.ram.AppConfigGroups {
+		items := make([]string, 0, len(group.ConfigItems))
+		for item := range group.ConfigItems {
+			items = append(items, item)
+		}
+		sort.Strings(items)
+		for _, key := range group.ComponentKeys {
+			name, ok := e.names[key]
+			if !ok {
+				e.report.add("", "config_groups", "config group %s refers to unknown component %s", group.Name, key)
+				continue
+			}
+			svc := e.exported.File.Services[name]
+			for _, item := range items {
+				if strings.ToLower(group.InjectionType) == "env" {
+					if svc.Environment == nil {
+						svc.Environment = Environment{}
+					}
+					if _, exists := svc.Environment[item]; exists {
+						e.report.add(name, "environment."+item, "env of config group %s collides with the env of the component", group.Name)
+						continue
+					}
+					value := escape(group.ConfigItems[item])
+					svc.Environment[item] = &value
+					continue
+				}
+				if strings.Contains(item, "/") || strings.Contains(item, `\`) || strings.Contains(item, "..") {
+					e.report.add(name, "volumes", "the item %s of config group %s is not a file name, it is not exported", item, group.Name)
+					continue
+				}
+				file := path.Join(ConfigDir, "groups", serviceAlias(group.Name, "group"), item)
+				e.exported.Files[file] = []byte(group.ConfigItems[item])
+				svc.Volumes = append(svc.Volumes, Mount{
+					Type:     BindMountType,
+					Source:   "./" + file,
+					Target:   path.Join(oam.ConfigGroupMountDir, group.Name, item),
+					ReadOnly: true,
+				})
+			}
+		}
+	}
+}
+
+// reportRoutes compose publishes the ports of the host only, the gateway rules are lost
+func (e *exporter) reportRoutes() {
+	for _, route := range e.ram.IngressHTTPRoutes {
+		e.report.add(e.names[route.ComponentKey], "routes", "http route %s of port %d is not exported, use the published port", firstNonEmpty(route.Location, "/"), route.Port)
+	}
+	for _, route := range e.ram.IngressStreamRoutes() {
+		e.report.add(e.names[route.ComponentKey], "routes", "%s stream route of port %d is not exported, use the published port", firstNonEmpty(route.Protocol, "tcp"), route.Port)
+	}
+}
+
+//Marshal the content of the compose file
+func (e *Exported) Marshal() ([]byte, error) {
+	return yaml.Marshal(e.File)
+}
+
+//WriteDir write the compose file and the config files into dir
+func (e *Exported) WriteDir(dir string) error {
+	body, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{FileName: body}
+	for file, content := range e.Files {
+		files[file] = content
+	}
+	for file, content := range files {
+		target := filepath.Join(dir, filepath.FromSlash(file))
+		if rel, err := filepath.Rel(dir, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("file %s is out of the directory %s", file, dir)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package compose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+)
+
+func newExportRAM() v1alpha1.RainbondApplicationConfig {
+	return v1alpha1.RainbondApplicationConfig{
+		AppKeyID: "5d8a5fc1d2b44a4dbc8c6a1e0c9d5e11",
+		AppName:  "wordpress",
+		Components: []*v1alpha1.Component{
+			{
+				ServiceKey:     "a1b2c3d4e5f6",
+				ServiceShareID: "share-mysql",
+				ServiceCname:   "MySQL",
+				ServiceAlias:   "gr7c3d4e",
+				Image:          "mysql:5.7",
+				DeployType:     v1alpha1.StateSingletonDeployType,
+				Memory:         512,
+				Ports:          []v1alpha1.ComponentPort{{ContainerPort: 3306, Protocol: "mysql", IsInner: true}},
+				Envs:           []v1alpha1.ComponentEnv{{AttrName: "MYSQL_ROOT_PASSWORD", AttrValue: "pa$$word"}},
+				ServiceConnectInfoMapList: []v1alpha1.ComponentEnv{
+					{AttrName: "MYSQL_HOST", AttrValue: "127.0.0.1"},
+					{AttrName: "MYSQL_PORT", AttrValue: "3306"},
+				},
+				ServiceVolumeMapList: v1alpha1.ComponentVolumeList{
+					{VolumeName: "data", VolumeMountPath: "/var/lib/mysql", VolumeType: v1alpha1.LocalVolumeType},
+					{VolumeName: "backup", VolumeMountPath: "/backup", VolumeType: v1alpha1.ShareFileVolumeType, AccessMode: v1alpha1.RWXAccessMode},
+					{VolumeName: "conf", VolumeMountPath: "/etc/mysql/conf.d/my.cnf", VolumeType: v1alpha1.ConfigFileVolumeType, FileConent: "[mysqld]\n"},
+				},
+				Probes: []v1alpha1.ComponentProbe{{Mode: v1alpha1.ReadinessProbeMode, Scheme: v1alpha1.CmdProbeScheme, Cmd: "mysqladmin ping", PeriodSecond: 10, FailureThreshold: 3, IsUsed: true}},
+			},
+			{
+				ServiceKey:           "f6e5d4c3b2a1",
+				ServiceCname:         "WordPress",
+				ServiceAlias:         "gr9a8b7c",
+				Image:                "wordpress:5",
+				DeployType:           v1alpha1.StatelessMultipleDeployType,
+				ExtendMethodRule:     v1alpha1.ComponentExtendMethodRule{MinNode: 2},
+				Cmd:                  "apache2-foreground",
+				Ports:                []v1alpha1.ComponentPort{{ContainerPort: 80, Protocol: "http", IsOuter: true, IsInner: true}},
+				DepServiceMapList:    []v1alpha1.ComponentDep{{DepServiceKey: "a1b2c3d4e5f6"}},
+				MntReleationList:     []v1alpha1.ComponentShareVolume{{VolumeName: "backup", VolumeMountDir: "/var/backup", ShareServiceUUID: "share-mysql"}},
+				Probes:               []v1alpha1.ComponentProbe{{Mode: v1alpha1.LivenessProbeMode, Scheme: v1alpha1.HTTPProbeScheme, Port: 80, Path: "/", IsUsed: true}},
+				ServicePluginConfigs: []v1alpha1.ComponentPluginConfig{{PluginID: "p1"}},
+			},
+		},
+		Plugins:           []v1alpha1.Plugin{{PluginID: "p1", PluginAlias: "mesh"}},
+		AppConfigGroups:   []v1alpha1.AppConfigGroup{{Name: "site", InjectionType: "env", ConfigItems: map[string]string{"SITE_NAME": "blog"}, ComponentKeys: []string{"f6e5d4c3b2a1"}}},
+		IngressHTTPRoutes: []v1alpha1.IngressHTTPRoute{{Location: "/", TargetComponent: v1alpha1.TargetComponent{ComponentKey: "f6e5d4c3b2a1", Port: 80}}},
+	}
+}
+
+func TestExport(t *testing.T) {
+	exported, err := Export(newExportRAM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mysql, wp := exported.File.Services["gr7c3d4e"], exported.File.Services["gr9a8b7c"]
+	if mysql == nil || wp == nil {
+		t.Fatalf("unexpected services %v", exported.File.Services)
+	}
+	if len(wp.DependsOn) != 1 || wp.DependsOn[0] != "gr7c3d4e" {
+		t.Fatalf("unexpected depends_on %v", wp.DependsOn)
+	}
+	if *wp.Environment["MYSQL_HOST"] != "gr7c3d4e" || *wp.Environment["MYSQL_PORT"] != "3306" || *wp.Environment["SITE_NAME"] != "blog" {
+		t.Fatal("the connection envs and the config group envs are not set on the dependent")
+	}
+	if *mysql.Environment["MYSQL_ROOT_PASSWORD"] != "pa$$$$word" || *mysql.Environment["MYSQL_HOST"] != "127.0.0.1" {
+		t.Fatal("the envs of the component are not kept or the dollars are not escaped")
+	}
+	if string(exported.Files["configs/gr7c3d4e/etc/mysql/conf.d/my.cnf"]) != "[mysqld]\n" {
+		t.Fatalf("the config file is not written: %v", exported.Files)
+	}
+	var bind, shared bool
+	for _, mount := range mysql.Volumes {
+		bind = bind || (mount.Type == BindMountType && mount.Source == "./configs/gr7c3d4e/etc/mysql/conf.d/my.cnf" && mount.ReadOnly)
+	}
+	for _, mount := range wp.Volumes {
+		shared = shared || (mount.Source == "gr7c3d4e-backup" && mount.Target == "/var/backup")
+	}
+	if !bind || !shared {
+		t.Fatalf("unexpected volumes %+v %+v", mysql.Volumes, wp.Volumes)
+	}
+	if len(wp.Ports) != 1 || wp.Ports[0].Published != "80" || len(mysql.Expose) != 1 || *wp.Deploy.Replicas != 2 {
+		t.Fatal("unexpected ports or replicas")
+	}
+	if mysql.Healthcheck == nil || strings.Join(mysql.Healthcheck.Test, " ") != "CMD mysqladmin ping" || wp.Healthcheck != nil {
+		t.Fatal("unexpected health checks")
+	}
+	report := map[string]bool{}
+	for _, w := range exported.Report {
+		report[w.Service+" "+w.Key] = true
+	}
+	for _, expect := range []string{"gr9a8b7c routes", "gr9a8b7c plugins", "gr9a8b7c healthcheck"} {
+		if !report[expect] {
+			t.Errorf("expect %s reported, got %v", expect, exported.Report)
+		}
+	}
+
+	// the exported file can be imported again
+	dir, err := ioutil.TempDir("", "compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := exported.WriteDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadFile(filepath.Join(dir, FileName))
+	if _, warnings, err := Load(body); err != nil || len(warnings) != 0 {
+		t.Fatalf("load exported file failure %v %v\n%s", err, warnings, body)
+	}
+	ram, _, err := ImportFile(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, com := range ram.Components {
+		if com.ServiceCname != "gr7c3d4e" {
+			continue
+		}
+		for _, env := range com.Envs {
+			if env.AttrName == "MYSQL_ROOT_PASSWORD" && env.AttrValue != "pa$$word" {
+				t.Fatalf("unexpected env %+v", env)
+			}
+		}
+		for _, volume := range com.ServiceVolumeMapList {
+			if volume.VolumeType == v1alpha1.ConfigFileVolumeType && volume.FileConent != "[mysqld]\n" {
+				t.Fatalf("unexpected config file %+v", volume)
+			}
+		}
+	}
+}
+
+func TestExportDisabledProbe(t *testing.T) {
+	ram := newExportRAM()
+	ram.Components[0].Probes[0].IsUsed = false
+	exported, err := Export(ram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hc := exported.File.Services["gr7c3d4e"].Healthcheck; hc != nil {
+		t.Fatalf("disabled probe is exported as %+v", hc)
+	}
+}
+
+func TestExportUnsafePaths(t *testing.T) {
+	ram := newExportRAM()
+	ram.Components[0].ServiceVolumeMapList = append(ram.Components[0].ServiceVolumeMapList,
+		v1alpha1.ComponentVolume{VolumeName: "evil", VolumeMountPath: "../../evil", VolumeType: v1alpha1.ConfigFileVolumeType, FileConent: "evil"})
+	ram.AppConfigGroups = append(ram.AppConfigGroups, v1alpha1.AppConfigGroup{
+		Name: "files", InjectionType: "file", ConfigItems: map[string]string{"../../pwned": "pwned", "app.conf": "debug=true"}, ComponentKeys: []string{"f6e5d4c3b2a1"},
+	})
+	exported, err := Export(ram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file := range exported.Files {
+		if !strings.HasPrefix(file, ConfigDir+"/") || strings.Contains(file, "..") {
+			t.Fatalf("file %s is out of the config directory", file)
+		}
+	}
+	if len(exported.Files) != 2 {
+		t.Fatalf("unexpected files %v", exported.Files)
+	}
+	reported := 0
+	for _, w := range exported.Report {
+		if strings.Contains(w.Message, "evil") || strings.Contains(w.Message, "pwned") {
+			reported++
+		}
+	}
+	if reported != 2 {
+		t.Fatalf("expect the unsafe paths reported, got %v", exported.Report)
+	}
+
+	dir, err := ioutil.TempDir("", "compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exported.Files["../evil"] = []byte("evil")
+	if err := exported.WriteDir(filepath.Join(dir, "out")); err == nil {
+		t.Fatal("expect error for the file out of the directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); err == nil {
+		t.Fatal("the file out of the directory is written")
+	}
+}
@@ -0,0 +1,790 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package compose
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"github.com/goodrain/rainbond-oam/pkg/util"
+	"github.com/google/uuid"
+	"sigs.k8s.io/yaml"
+)
+
+//ServiceSource the service source of the imported components
+var ServiceSource = "docker_compose"
+
+// the namespace of the generated keys, the keys of the same application and service are always the same
+var keyNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://www.rainbond.com/docker-compose"))
+
+// the escaped dollar, ${NAME}, ${NAME:-default}, ${NAME-default} and $NAME
+var interpolationRegexp = regexp.MustCompile(`\$(\$|\{([A-Za-z_][A-Za-z0-9_]*)(?::?-([^}]*))?\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+var byteValueRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([kKmMgGtT]?)[bB]?$`)
+
+// the keys can be represented by the rainbond application config
+var (
+	supportedFileKeys        = keySet("version", "name", "services", "volumes")
+	supportedServiceKeys     = keySet("image", "command", "environment", "env_file", "ports", "expose", "volumes", "tmpfs", "depends_on", "links", "healthcheck", "deploy", "scale", "mem_limit", "cpus", "restart")
+	supportedDeployKeys      = keySet("replicas", "resources")
+	supportedResourcesKeys   = keySet("limits", "reservations")
+	supportedResourceKeys    = keySet("cpus", "memory")
+	supportedHealthcheckKeys = keySet("test", "interval", "timeout", "start_period", "retries", "disable")
+)
+
+// the defaults of the docker health check
+const (
+	defaultHealthcheckInterval = 30
+	defaultHealthcheckTimeout  = 30
+	defaultHealthcheckRetries  = 3
+)
+
+//Warning a key of the compose file that is not supported or not fully represented
+type Warning struct {
+	Service string `json:"service,omitempty"`
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	if w.Service == "" {
+		return fmt.Sprintf("%s: %s", w.Key, w.Message)
+	}
+	return fmt.Sprintf("service %s %s: %s", w.Service, w.Key, w.Message)
+}
+
+type warnings []Warning
+
+func (w *warnings) add(service, key, format string, args ...interface{}) {
+	*w = append(*w, Warning{Service: service, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func keySet(keys ...string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+//Load parse the compose file, the keys not supported are reported as warnings
+func Load(body []byte) (*File, []Warning, error) {
+	data, err := yaml.YAMLToJSON(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse compose file failure %s", err.Error())
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("parse compose file failure %s", err.Error())
+	}
+	if len(file.Services) == 0 {
+		return nil, nil, fmt.Errorf("no service in the compose file, the version 1 file without services is not supported")
+	}
+	var keys map[string]json.RawMessage
+	var services struct {
+		Services map[string]map[string]json.RawMessage `json:"services"`
+	}
+	json.Unmarshal(data, &keys)
+	json.Unmarshal(data, &services)
+	var ws warnings
+	unsupportedKeys(&ws, "", "", keys, supportedFileKeys)
+	for name, keys := range services.Services {
+		unsupportedKeys(&ws, name, "", keys, supportedServiceKeys)
+		var deploy map[string]json.RawMessage
+		if json.Unmarshal(keys["deploy"], &deploy) == nil {
+			unsupportedKeys(&ws, name, "deploy.", deploy, supportedDeployKeys)
+			var resources map[string]map[string]json.RawMessage
+			if json.Unmarshal(deploy["resources"], &resources) == nil {
+				unsupportedKeys(&ws, name, "deploy.resources.", toRawKeys(resources), supportedResourcesKeys)
+				for _, kind := range []string{"limits", "reservations"} {
+					unsupportedKeys(&ws, name, "deploy.resources."+kind+".", resources[kind], supportedResourceKeys)
+				}
+			}
+		}
+		var healthcheck map[string]json.RawMessage
+		if json.Unmarshal(keys["healthcheck"], &healthcheck) == nil {
+			unsupportedKeys(&ws, name, "healthcheck.", healthcheck, supportedHealthcheckKeys)
+		}
+	}
+	sort.SliceStable(ws, func(i, j int) bool {
+		if ws[i].Service != ws[j].Service {
+			return ws[i].Service < ws[j].Service
+		}
+		return ws[i].Key < ws[j].Key
+	})
+	return &file, ws, nil
+}
+
+func toRawKeys(m map[string]map[string]json.RawMessage) map[string]json.RawMessage {
+	keys := make(map[string]json.RawMessage, len(m))
+	for key := range m {
+		keys[key] = nil
+	}
+	return keys
+}
+
+// unsupportedKeys the extension keys x-* are ignored
+func unsupportedKeys(ws *warnings, service, prefix string, keys map[string]json.RawMessage, supported map[string]bool) {
+	for key := range keys {
+		if !supported[key] && !strings.HasPrefix(key, "x-") {
+			ws.add(service, prefix+key, "not supported, it is ignored")
+		}
+	}
+}
+
+//Importer import the docker-compose file into the rainbond application config
+type Importer struct {
+	// AppName the name of the application, the name of the compose file or the name of Dir is used if it is empty
+	AppName string
+	// Dir the directory of the compose file, the env files and the bind mounted files are read from it.
+	// They are not read if it is empty.
+	Dir string
+
+	file     *File
+	warnings warnings
+	keys     map[string]string
+	// owners the service owns the named volume
+	owners map[string]string
+	// volumes the volume name of the named volume in the owner component
+	volumes map[string]string
+	coms    map[string]*v1alpha1.Component
+}
+
+//ImportFile import the compose file, the application is named after the directory of the file
+func ImportFile(path string) (*v1alpha1.RainbondApplicationConfig, []Warning, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	importer := &Importer{Dir: filepath.Dir(abs)}
+	return importer.Import(body)
+}
+
+//Import map the services to the components. The ServiceKey and the ServiceShareID are generated from the
+//application name and the service name, so importing the file again produces the same keys.
+func (i *Importer) Import(body []byte) (*v1alpha1.RainbondApplicationConfig, []Warning, error) {
+	file, ws, err := Load(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	i.file, i.warnings = file, ws
+	i.keys = map[string]string{}
+	i.owners = map[string]string{}
+	i.volumes = map[string]string{}
+	i.coms = map[string]*v1alpha1.Component{}
+	appName := i.AppName
+	if appName == "" {
+		appName = file.Name
+	}
+	if appName == "" && i.Dir != "" {
+		appName = filepath.Base(i.Dir)
+	}
+	if appName == "" {
+		appName = "compose"
+	}
+	ram := &v1alpha1.RainbondApplicationConfig{
+		AppKeyID:        stableKey("app", appName),
+		AppName:         appName,
+		TempleteVersion: "v2",
+	}
+	names := make([]string, 0, len(file.Services))
+	for name, svc := range file.Services {
+		if svc == nil || svc.Image == "" {
+			i.warnings.add(name, "image", "the service has no image, building the image is not supported, the service is skipped")
+			continue
+		}
+		names = append(names, name)
+		i.keys[name] = stableKey(appName, name)
+	}
+	sort.Strings(names)
+	// the first service mounting a named volume owns it, the others mount the shared volume
+	for _, name := range names {
+		for _, mount := range file.Services[name].Volumes {
+			if mount.Type == VolumeMountType && mount.Source != "" && i.owners[mount.Source] == "" {
+				i.owners[mount.Source] = name
+			}
+		}
+	}
+	for _, name := range names {
+		com, err := i.importService(appName, name, file.Services[name])
+		if err != nil {
+			return nil, nil, fmt.Errorf("service %s: %v", name, err)
+		}
+		i.coms[name] = com
+		ram.Components = append(ram.Components, com)
+	}
+	// the owners are imported before the services mounting their volumes
+	for _, name := range names {
+		i.importVolumes(name, file.Services[name])
+	}
+	for _, com := range ram.Components {
+		i.resolveDeployType(com)
+	}
+	ram.HandleNullValue()
+	return ram, i.warnings, nil
+}
+
+// interpolate resolve the variables of compose, the escaped dollar becomes dollar, the variables of the host
+// are replaced by their default values and reported
+func (i *Importer) interpolate(name, key, value string) string {
+	return interpolationRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		sub := interpolationRegexp.FindStringSubmatch(match)
+		if sub[1] == "$" {
+			return "$"
+		}
+		variable := sub[2]
+		if variable == "" {
+			variable = sub[4]
+		}
+		i.warnings.add(name, key, "the variable %s of the host is not known, the default value %q is used", variable, sub[3])
+		return sub[3]
+	})
+}
+
+// stableKey the uuid based on the names without the dashes
+func stableKey(names ...string) string {
+	return strings.Replace(uuid.NewSHA1(keyNamespace, []byte(strings.Join(names, "\x00"))).String(), "-", "", -1)
+}
+
+func (i *Importer) importService(appName, name string, svc *Service) (*v1alpha1.Component, error) {
+	key := i.keys[name]
+	com := &v1alpha1.Component{
+		ServiceKey:     key,
+		ServiceShareID: stableKey(appName, name, "share"),
+		ServiceCname:   name,
+		ServiceAlias:   serviceAlias(name, key),
+		ServiceType:    v1alpha1.ApplicationServiceType,
+		ServiceSource:  ServiceSource,
+		Image:          i.interpolate(name, "image", svc.Image),
+	}
+	com.ShareImage = com.Image
+	com.ServiceName = com.ServiceAlias
+	if svc.Command != "" {
+		com.Cmd = i.interpolate(name, "command", string(svc.Command))
+		if _, err := util.SplitShellWords(com.Cmd); err != nil {
+			return nil, fmt.Errorf("parse command: %v", err)
+		}
+	}
+	if svc.Restart != "" && svc.Restart != "always" && svc.Restart != "unless-stopped" {
+		i.warnings.add(name, "restart", "restart policy %s is not supported, the container is always restarted", svc.Restart)
+	}
+	i.importPorts(com, name, svc)
+	if err := i.importEnvs(com, name, svc); err != nil {
+		return nil, err
+	}
+	i.importDeps(com, name, svc)
+	i.importProbe(com, name, svc)
+	i.importResources(com, name, svc)
+	return com, nil
+}
+
+// serviceAlias the service name as dns-1123 label, the underscores and the dots become dashes
+func serviceAlias(name, key string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-':
+			sb.WriteRune(r)
+		case r == '_' || r == '.':
+			sb.WriteRune('-')
+		}
+	}
+	alias := strings.Trim(sb.String(), "-")
+	if len(alias) > 63 {
+		alias = strings.Trim(alias[:63], "-")
+	}
+	if alias == "" || alias[0] < 'a' || alias[0] > 'z' {
+		if len(key) > 6 {
+			key = key[:6]
+		}
+		return "gr" + strings.ToLower(key)
+	}
+	return alias
+}
+
+func (i *Importer) importPorts(com *v1alpha1.Component, name string, svc *Service) {
+	ports := map[int]int{}
+	add := func(port Port, outer bool) {
+		if idx, ok := ports[port.Target]; ok {
+			com.Ports[idx].IsOuter = com.Ports[idx].IsOuter || outer
+			return
+		}
+		protocol := "tcp"
+		if strings.ToLower(port.Protocol) == "udp" {
+			protocol = "udp"
+		}
+		com.Ports = append(com.Ports, v1alpha1.ComponentPort{
+			PortAlias:     strings.ToUpper(com.ServiceAlias) + strconv.Itoa(port.Target),
+			Protocol:      protocol,
+			ContainerPort: port.Target,
+			IsInner:       true,
+			IsOuter:       outer,
+		})
+		ports[port.Target] = len(com.Ports) - 1
+	}
+	for idx, port := range svc.Ports {
+		if port.Published != "" && port.Published != strconv.Itoa(port.Target) {
+			i.warnings.add(name, fmt.Sprintf("ports[%d]", idx), "published port %s is not kept, the port %d is exposed by the gateway", port.Published, port.Target)
+		}
+		if port.HostIP != "" {
+			i.warnings.add(name, fmt.Sprintf("ports[%d]", idx), "host ip %s is not supported", port.HostIP)
+		}
+		add(port, port.Published != "")
+	}
+	for idx, expose := range svc.Expose {
+		exposed, err := ParsePort(expose)
+		if err != nil {
+			i.warnings.add(name, fmt.Sprintf("expose[%d]", idx), "%v, it is ignored", err)
+			continue
+		}
+		for _, port := range exposed {
+			add(port, false)
+		}
+	}
+	sort.SliceStable(com.Ports, func(a, b int) bool { return com.Ports[a].ContainerPort < com.Ports[b].ContainerPort })
+}
+
+func (i *Importer) importEnvs(com *v1alpha1.Component, name string, svc *Service) error {
+	envs := map[string]string{}
+	for idx, envFile := range svc.EnvFile {
+		if i.Dir == "" {
+			i.warnings.add(name, fmt.Sprintf("env_file[%d]", idx), "env file %s is not read without the directory of the compose file", envFile)
+			continue
+		}
+		path, ok := i.resolvePath(envFile)
+		if !ok {
+			i.warnings.add(name, fmt.Sprintf("env_file[%d]", idx), "env file %s is out of the directory of the compose file, it is not read", envFile)
+			continue
+		}
+		fileEnvs, err := readEnvFile(path)
+		if err != nil {
+			return fmt.Errorf("read env file %s: %v", envFile, err)
+		}
+		for envName, value := range fileEnvs {
+			envs[envName] = value
+		}
+	}
+	for _, envName := range svc.Environment.Names() {
+		value := svc.Environment[envName]
+		if value == nil {
+			i.warnings.add(name, "environment."+envName, "the value from the shell is not known, the env is empty")
+			envs[envName] = ""
+			continue
+		}
+		envs[envName] = i.interpolate(name, "environment."+envName, *value)
+	}
+	envNames := make([]string, 0, len(envs))
+	for envName := range envs {
+		envNames = append(envNames, envName)
+	}
+	sort.Strings(envNames)
+	for _, envName := range envNames {
+		com.Envs = append(com.Envs, v1alpha1.ComponentEnv{
+			AttrName:  envName,
+			Name:      envName,
+			AttrValue: envs[envName],
+			IsChange:  true,
+		})
+	}
+	return nil
+}
+
+// readEnvFile read the KEY=VALUE lines, the blank lines and the comments are skipped
+func readEnvFile(path string) (map[string]string, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	envs := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value := line, ""
+		if idx := strings.Index(line, "="); idx >= 0 {
+			name, value = strings.TrimSpace(line[:idx]), line[idx+1:]
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		envs[name] = value
+	}
+	return envs, scanner.Err()
+}
+
+// resolvePath resolve the path relative to Dir, false if the path is not in Dir. The files out of Dir,
+// such as the files of the importing host, must not be read into the template.
+func (i *Importer) resolvePath(path string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(i.Dir, path)
+	}
+	path = filepath.Clean(path)
+	dir, real := i.Dir, path
+	// the symbolic links in Dir may point out of it
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		real = resolved
+	}
+	rel, err := filepath.Rel(dir, real)
+	return path, err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (i *Importer) importDeps(com *v1alpha1.Component, name string, svc *Service) {
+	deps := map[string]bool{}
+	add := func(key, dep string) {
+		depKey, ok := i.keys[dep]
+		if !ok {
+			i.warnings.add(name, key, "the service depends on unknown service %s, the dependency is ignored", dep)
+			return
+		}
+		if deps[depKey] || dep == name {
+			return
+		}
+		deps[depKey] = true
+		com.DepServiceMapList = append(com.DepServiceMapList, v1alpha1.ComponentDep{DepServiceKey: depKey})
+	}
+	for _, dep := range svc.DependsOn {
+		add("depends_on", dep)
+	}
+	for idx, link := range svc.Links {
+		parts := strings.SplitN(link, ":", 2)
+		if len(parts) == 2 && parts[1] != parts[0] {
+			i.warnings.add(name, fmt.Sprintf("links[%d]", idx), "link alias %s is not supported, the service is reached by its own name", parts[1])
+		}
+		add(fmt.Sprintf("links[%d]", idx), parts[0])
+	}
+}
+
+func (i *Importer) importProbe(com *v1alpha1.Component, name string, svc *Service) {
+	hc := svc.Healthcheck
+	if hc == nil || hc.Disable || len(hc.Test) == 0 || hc.Test[0] == "NONE" {
+		return
+	}
+	test := make([]string, len(hc.Test))
+	for idx := range hc.Test {
+		test[idx] = i.interpolate(name, "healthcheck.test", hc.Test[idx])
+	}
+	var cmd string
+	switch {
+	case hc.Test[0] == "CMD" && len(hc.Test) > 1:
+		cmd = util.JoinShellWords(test[1:])
+	case hc.Test[0] == "CMD-SHELL" && len(hc.Test) == 2:
+		cmd = util.JoinShellWords([]string{"/bin/sh", "-c", test[1]})
+	case len(hc.Test) == 1 && hc.Test[0] != "CMD" && hc.Test[0] != "CMD-SHELL":
+		cmd = util.JoinShellWords([]string{"/bin/sh", "-c", test[0]})
+	default:
+		i.warnings.add(name, "healthcheck.test", "invalid test %v, the health check is ignored", []string(hc.Test))
+		return
+	}
+	retries := hc.Retries
+	if retries <= 0 {
+		retries = defaultHealthcheckRetries
+	}
+	// the health check of docker marks the container unhealthy without restarting it, it works as readiness probe
+	com.Probes = append(com.Probes, v1alpha1.ComponentProbe{
+		Mode:               v1alpha1.ReadinessProbeMode,
+		Scheme:             v1alpha1.CmdProbeScheme,
+		Cmd:                cmd,
+		IsUsed:             true,
+		InitialDelaySecond: i.seconds(name, "healthcheck.start_period", hc.StartPeriod, 0),
+		PeriodSecond:       i.seconds(name, "healthcheck.interval", hc.Interval, defaultHealthcheckInterval),
+		TimeoutSecond:      i.seconds(name, "healthcheck.timeout", hc.Timeout, defaultHealthcheckTimeout),
+		FailureThreshold:   retries,
+		SuccessThreshold:   1,
+	})
+}
+
+// seconds the duration in seconds, the partial second is rounded up
+func (i *Importer) seconds(name, key, value string, def int) int {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		i.warnings.add(name, key, "invalid duration %s, the default %d seconds is used", value, def)
+		return def
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+func (i *Importer) importResources(com *v1alpha1.Component, name string, svc *Service) {
+	rule := v1alpha1.DefaultExtendMethodRule()
+	replicas := 1
+	if svc.Scale > 0 {
+		replicas = svc.Scale
+	}
+	var limits, reservations Resource
+	if svc.Deploy != nil {
+		if svc.Deploy.Replicas != nil {
+			replicas = *svc.Deploy.Replicas
+		}
+		if res := svc.Deploy.Resources; res != nil && res.Limits != nil {
+			limits = *res.Limits
+		}
+		if res := svc.Deploy.Resources; res != nil && res.Reservations != nil {
+			reservations = *res.Reservations
+		}
+	}
+	switch {
+	case replicas < rule.MinNode:
+		i.warnings.add(name, "deploy.replicas", "replicas %d is raised to %d", replicas, rule.MinNode)
+		replicas = rule.MinNode
+	case replicas > rule.MaxNode:
+		i.warnings.add(name, "deploy.replicas", "replicas %d is limited to %d", replicas, rule.MaxNode)
+		replicas = rule.MaxNode
+	}
+	rule.MinNode = replicas
+	com.ExtendMethodRule = rule
+	// the limits are preferred, the container is limited to the memory and requests the cpu
+	for _, memory := range []struct {
+		key   string
+		value Scalar
+	}{{"deploy.resources.limits.memory", limits.Memory}, {"mem_limit", svc.MemLimit}, {"deploy.resources.reservations.memory", reservations.Memory}} {
+		if memory.value == "" {
+			continue
+		}
+		mb, err := parseMemory(string(memory.value))
+		if err != nil {
+			i.warnings.add(name, memory.key, "%v, it is ignored", err)
+			continue
+		}
+		com.Memory = mb
+		break
+	}
+	for _, cpu := range []struct {
+		key   string
+		value Scalar
+	}{{"deploy.resources.limits.cpus", limits.Cpus}, {"cpus", svc.Cpus}, {"deploy.resources.reservations.cpus", reservations.Cpus}} {
+		if cpu.value == "" {
+			continue
+		}
+		cores, err := strconv.ParseFloat(string(cpu.value), 64)
+		if err != nil || cores < 0 {
+			i.warnings.add(name, cpu.key, "invalid cpus %s, it is ignored", cpu.value)
+			continue
+		}
+		com.CPU = int(math.Ceil(cores))
+		if float64(com.CPU) != cores {
+			i.warnings.add(name, cpu.key, "cpus %s is rounded up to %d", cpu.value, com.CPU)
+		}
+		break
+	}
+}
+
+// parseMemory parse the byte value such as 512m, 1gb, 1073741824, return the MiB rounded up
+func parseMemory(value string) (int, error) {
+	match := byteValueRegexp.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, fmt.Errorf("invalid memory %s", value)
+	}
+	size, _ := strconv.ParseFloat(match[1], 64)
+	switch strings.ToLower(match[2]) {
+	case "k":
+		size *= 1 << 10
+	case "m":
+		size *= 1 << 20
+	case "g":
+		size *= 1 << 30
+	case "t":
+		size *= 1 << 40
+	}
+	return int(math.Ceil(size / (1 << 20))), nil
+}
+
+// importVolumes the named volume used by one service is local, the named volume used by several services is
+// shared by the owner, the bind mounted file becomes config file
+func (i *Importer) importVolumes(name string, svc *Service) {
+	com := i.coms[name]
+	names := map[string]bool{}
+	volumeName := func(base string) string {
+		base = serviceAlias(base, com.ServiceKey)
+		candidate := base
+		for n := 1; names[candidate]; n++ {
+			candidate = fmt.Sprintf("%s-%d", base, n)
+		}
+		names[candidate] = true
+		return candidate
+	}
+	for idx, mount := range svc.Volumes {
+		key := fmt.Sprintf("volumes[%d]", idx)
+		switch mount.Type {
+		case TmpfsMountType:
+			com.ServiceVolumeMapList = append(com.ServiceVolumeMapList, v1alpha1.ComponentVolume{
+				VolumeName:      volumeName(mount.Target),
+				VolumeMountPath: mount.Target,
+				VolumeType:      v1alpha1.MemoryFSVolumeType,
+			})
+		case BindMountType:
+			i.importBindMount(com, name, key, mount, volumeName)
+		case VolumeMountType:
+			if mount.Source == "" {
+				com.ServiceVolumeMapList = append(com.ServiceVolumeMapList, v1alpha1.ComponentVolume{
+					VolumeName:      volumeName(mount.Target),
+					VolumeMountPath: mount.Target,
+					VolumeType:      v1alpha1.LocalVolumeType,
+					AccessMode:      v1alpha1.RWOAccessMode,
+				})
+				continue
+			}
+			if volume := i.file.Volumes[mount.Source]; volume != nil && (volume.External || volume.Driver != "") {
+				i.warnings.add(name, key, "the external volume or the volume driver of %s is not supported, a new volume is created", mount.Source)
+			}
+			i.importNamedVolume(com, name, key, mount, volumeName)
+		default:
+			i.warnings.add(name, key, "the mount type %s is not supported, the mount is skipped", mount.Type)
+		}
+	}
+	for _, target := range svc.Tmpfs {
+		target = strings.SplitN(target, ":", 2)[0]
+		com.ServiceVolumeMapList = append(com.ServiceVolumeMapList, v1alpha1.ComponentVolume{
+			VolumeName:      volumeName(target),
+			VolumeMountPath: target,
+			VolumeType:      v1alpha1.MemoryFSVolumeType,
+		})
+	}
+}
+
+func (i *Importer) importNamedVolume(com *v1alpha1.Component, name, key string, mount Mount, volumeName func(string) string) {
+	owner := i.owners[mount.Source]
+	shared := false
+	for other, svc := range i.file.Services {
+		if other == owner || i.coms[other] == nil {
+			continue
+		}
+		for _, m := range svc.Volumes {
+			if m.Type == VolumeMountType && m.Source == mount.Source {
+				shared = true
+			}
+		}
+	}
+	if owner != name {
+		ownerCom := i.coms[owner]
+		if ownerCom == nil {
+			i.warnings.add(name, key, "volume %s is not owned by any service, the mount is skipped", mount.Source)
+			return
+		}
+		com.MntReleationList = append(com.MntReleationList, v1alpha1.ComponentShareVolume{
+			VolumeName:       i.volumes[mount.Source],
+			VolumeMountDir:   mount.Target,
+			ShareServiceUUID: ownerCom.ServiceShareID,
+		})
+		if mount.ReadOnly {
+			i.warnings.add(name, key, "the shared volume %s is mounted writable", mount.Source)
+		}
+		return
+	}
+	if _, ok := i.volumes[mount.Source]; ok {
+		i.warnings.add(name, key, "volume %s is mounted more than once, only the first mount is kept", mount.Source)
+		return
+	}
+	volume := v1alpha1.ComponentVolume{
+		VolumeName:      volumeName(mount.Source),
+		VolumeMountPath: mount.Target,
+		VolumeType:      v1alpha1.LocalVolumeType,
+		AccessMode:      v1alpha1.RWOAccessMode,
+	}
+	i.volumes[mount.Source] = volume.VolumeName
+	if shared {
+		volume.VolumeType = v1alpha1.ShareFileVolumeType
+		volume.AccessMode = v1alpha1.RWXAccessMode
+	} else if mount.ReadOnly {
+		i.warnings.add(name, key, "the local volume %s is mounted writable", mount.Source)
+	}
+	com.ServiceVolumeMapList = append(com.ServiceVolumeMapList, volume)
+}
+
+// importBindMount the file of the host becomes config file, the directory of the host becomes shared volume without the content
+func (i *Importer) importBindMount(com *v1alpha1.Component, name, key string, mount Mount, volumeName func(string) string) {
+	if i.Dir != "" && !strings.HasPrefix(mount.Source, "~") {
+		path, inDir := i.resolvePath(mount.Source)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			if !inDir {
+				i.warnings.add(name, key, "the host file %s is out of the directory of the compose file, an empty config file is mounted", mount.Source)
+				com.ServiceVolumeMapList = append(com.ServiceVolumeMapList, v1alpha1.ComponentVolume{
+					VolumeName:      volumeName(filepath.Base(mount.Target)),
+					VolumeMountPath: mount.Target,
+					VolumeType:      v1alpha1.ConfigFileVolumeType,
+				})
+				return
+			}
+			content, err := ioutil.ReadFile(path)
+			if err == nil {
+				com.ServiceVolumeMapList = append(com.ServiceVolumeMapList, v1alpha1.ComponentVolume{
+					VolumeName:      volumeName(filepath.Base(mount.Target)),
+					VolumeMountPath: mount.Target,
+					VolumeType:      v1alpha1.ConfigFileVolumeType,
+					FileConent:      string(content),
+				})
+				if !mount.ReadOnly {
+					i.warnings.add(name, key, "the config file %s is mounted read only", mount.Source)
+				}
+				return
+			}
+		}
+	}
+	i.warnings.add(name, key, "the content of the host path %s is not imported, an empty shared volume is mounted", mount.Source)
+	volume := v1alpha1.ComponentVolume{
+		VolumeName:      volumeName(filepath.Base(mount.Target)),
+		VolumeMountPath: mount.Target,
+		VolumeType:      v1alpha1.ShareFileVolumeType,
+		AccessMode:      v1alpha1.RWXAccessMode,
+	}
+	if mount.ReadOnly {
+		volume.AccessMode = v1alpha1.ROXAccessMode
+	}
+	com.ServiceVolumeMapList = append(com.ServiceVolumeMapList, volume)
+}
+
+// resolveDeployType the component with local volumes is stateful
+func (i *Importer) resolveDeployType(com *v1alpha1.Component) {
+	stateful := false
+	for _, volume := range com.ServiceVolumeMapList {
+		if volume.VolumeType == v1alpha1.LocalVolumeType {
+			stateful = true
+		}
+	}
+	switch {
+	case stateful && com.ExtendMethodRule.MinNode <= 1:
+		com.DeployType = v1alpha1.StateSingletonDeployType
+	case stateful:
+		com.DeployType = v1alpha1.StateMultipleDeployType
+	default:
+		com.DeployType = v1alpha1.StatelessMultipleDeployType
+	}
+}
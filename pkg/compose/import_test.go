@@ -0,0 +1,272 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package compose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goodrain/rainbond-oam/pkg/oam"
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+)
+
+var testComposeFile = `
+version: "3.8"
+services:
+  db:
+    image: mysql:5.7
+    container_name: mysql
+    environment:
+      MYSQL_ROOT_PASSWORD: secret
+      MYSQL_DATABASE: wordpress
+      MYSQL_PORT: 3306
+      MYSQL_PASSWORD: $${NOT_A_VARIABLE}
+      MYSQL_USER: ${DB_USER:-wordpress}
+    expose:
+      - "3306"
+    volumes:
+      - db_data:/var/lib/mysql
+      - uploads:/srv/uploads:ro
+    healthcheck:
+      test: ["CMD", "mysqladmin", "ping", "-h", "localhost"]
+      interval: 10s
+      timeout: 5s
+      retries: 5
+  wordpress:
+    image: wordpress:5
+    command: ["docker-entrypoint.sh", "apache2-foreground"]
+    depends_on:
+      db:
+        condition: service_healthy
+    links:
+      - db:mysql
+    ports:
+      - "8000:80"
+      - "443/tcp"
+    environment:
+      - WORDPRESS_DB_HOST=db:3306
+      - WORDPRESS_DEBUG
+    env_file: wordpress.env
+    volumes:
+      - uploads:/var/www/html/wp-content/uploads
+      - ./php.ini:/usr/local/etc/php/php.ini:ro
+      - type: tmpfs
+        target: /tmp
+    healthcheck:
+      test: curl -f http://localhost/ || exit 1
+      start_period: 1m30s
+    deploy:
+      replicas: 2
+      placement:
+        constraints: [node.role == worker]
+      resources:
+        limits:
+          cpus: "0.5"
+          memory: 512M
+    networks:
+      - front
+volumes:
+  db_data: {}
+  uploads: {}
+networks:
+  front: {}
+`
+
+func TestImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "php.ini"), []byte("upload_max_filesize = 64M\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "wordpress.env"), []byte("# wordpress\nWORDPRESS_DB_USER=\"root\"\nWORDPRESS_DB_HOST=localhost\n"), 0644)
+	importer := &Importer{AppName: "wordpress", Dir: dir}
+	ram, warnings, err := importer.Import([]byte(testComposeFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ram.Components) != 2 {
+		t.Fatalf("expect 2 components, got %d", len(ram.Components))
+	}
+	db, wp := ram.Components[0], ram.Components[1]
+	if db.ServiceCname != "db" || wp.ServiceCname != "wordpress" {
+		t.Fatalf("the components are not sorted by name: %s %s", db.ServiceCname, wp.ServiceCname)
+	}
+	if db.DeployType != v1alpha1.StateSingletonDeployType || wp.DeployType != v1alpha1.StatelessMultipleDeployType {
+		t.Fatalf("unexpected deploy types %s %s", db.DeployType, wp.DeployType)
+	}
+	if len(db.Ports) != 1 || db.Ports[0].ContainerPort != 3306 || db.Ports[0].IsOuter {
+		t.Fatalf("unexpected db ports %+v", db.Ports)
+	}
+	if len(wp.Ports) != 2 || wp.Ports[0].ContainerPort != 80 || !wp.Ports[0].IsOuter || wp.Ports[1].ContainerPort != 443 || wp.Ports[1].IsOuter {
+		t.Fatalf("unexpected wordpress ports %+v", wp.Ports)
+	}
+	envs := map[string]string{}
+	for _, env := range wp.Envs {
+		envs[env.AttrName] = env.AttrValue
+	}
+	if !reflect.DeepEqual(envs, map[string]string{"WORDPRESS_DB_HOST": "db:3306", "WORDPRESS_DB_USER": "root", "WORDPRESS_DEBUG": ""}) {
+		t.Fatalf("unexpected wordpress envs %v", envs)
+	}
+	for _, env := range db.Envs {
+		if (env.AttrName == "MYSQL_PASSWORD" && env.AttrValue != "${NOT_A_VARIABLE}") || (env.AttrName == "MYSQL_USER" && env.AttrValue != "wordpress") {
+			t.Fatalf("unexpected interpolated env %+v", env)
+		}
+	}
+	if len(wp.DepServiceMapList) != 1 || wp.DepServiceMapList[0].DepServiceKey != db.ServiceKey {
+		t.Fatalf("unexpected dependencies %+v", wp.DepServiceMapList)
+	}
+	if wp.Cmd != "docker-entrypoint.sh apache2-foreground" {
+		t.Fatalf("unexpected cmd %s", wp.Cmd)
+	}
+	if wp.ExtendMethodRule.MinNode != 2 || wp.Memory != 512 || wp.CPU != 1 {
+		t.Fatalf("unexpected resources: replicas %d memory %d cpu %d", wp.ExtendMethodRule.MinNode, wp.Memory, wp.CPU)
+	}
+	volumes := map[string]v1alpha1.ComponentVolume{}
+	for _, volume := range append(db.ServiceVolumeMapList, wp.ServiceVolumeMapList...) {
+		volumes[volume.VolumeMountPath] = volume
+	}
+	if volumes["/var/lib/mysql"].VolumeType != v1alpha1.LocalVolumeType || volumes["/srv/uploads"].VolumeType != v1alpha1.ShareFileVolumeType {
+		t.Fatalf("unexpected db volumes %+v", db.ServiceVolumeMapList)
+	}
+	if volumes["/tmp"].VolumeType != v1alpha1.MemoryFSVolumeType || volumes["/usr/local/etc/php/php.ini"].FileConent != "upload_max_filesize = 64M\n" {
+		t.Fatalf("unexpected wordpress volumes %+v", wp.ServiceVolumeMapList)
+	}
+	if len(wp.MntReleationList) != 1 || wp.MntReleationList[0].ShareServiceUUID != db.ServiceShareID || wp.MntReleationList[0].VolumeName != "uploads" {
+		t.Fatalf("unexpected shared volumes %+v", wp.MntReleationList)
+	}
+	if len(db.Probes) != 1 || db.Probes[0].Cmd != "mysqladmin ping -h localhost" || db.Probes[0].PeriodSecond != 10 || db.Probes[0].FailureThreshold != 5 {
+		t.Fatalf("unexpected db probes %+v", db.Probes)
+	}
+	if len(wp.Probes) != 1 || wp.Probes[0].Cmd != "/bin/sh -c 'curl -f http://localhost/ || exit 1'" || wp.Probes[0].InitialDelaySecond != 90 {
+		t.Fatalf("unexpected wordpress probes %+v", wp.Probes)
+	}
+	var keys []string
+	for _, w := range warnings {
+		keys = append(keys, w.Service+" "+w.Key)
+	}
+	for _, expect := range []string{" networks", "db container_name", "wordpress deploy.placement", "wordpress networks", "wordpress links[0]", "wordpress environment.WORDPRESS_DEBUG", "wordpress deploy.resources.limits.cpus", "db environment.MYSQL_USER"} {
+		if !strings.Contains(strings.Join(keys, "\n")+"\n", expect+"\n") {
+			t.Errorf("expect warning of %q, got %v", expect, keys)
+		}
+	}
+	if err := ram.Validation(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := oam.NewKubernetesBuilder(*ram).Build(); err != nil {
+		t.Fatalf("the imported application can not be built: %v", err)
+	}
+	// the keys are stable
+	again, _, err := (&Importer{AppName: "wordpress", Dir: dir}).Import([]byte(testComposeFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ram, again) {
+		t.Fatal("importing the same file again produces a different application")
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	for spec, expect := range map[string][]Port{
+		"80":                  {{Target: 80}},
+		"8080:80":             {{Target: 80, Published: "8080"}},
+		"127.0.0.1:53:53/udp": {{Target: 53, Published: "53", HostIP: "127.0.0.1", Protocol: "udp"}},
+		"3000-3001":           {{Target: 3000}, {Target: 3001}},
+		"9090-9091:8080-8081": {{Target: 8080, Published: "9090"}, {Target: 8081, Published: "9091"}},
+		"[::1]:8080:80":       {{Target: 80, Published: "8080", HostIP: "::1"}},
+	} {
+		ports, err := ParsePort(spec)
+		if err != nil {
+			t.Errorf("parse port %s failure %s", spec, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(ports, expect) {
+			t.Errorf("parse port %s expect %+v, got %+v", spec, expect, ports)
+		}
+	}
+	for _, spec := range []string{"", "abc", "70000", "80-70", "1-2:3-5"} {
+		if _, err := ParsePort(spec); err == nil {
+			t.Errorf("parse port %q expect error", spec)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	for value, expect := range map[string]int{"512m": 512, "512M": 512, "1g": 1024, "1.5GB": 1536, "1048576": 1, "1000k": 1} {
+		mb, err := parseMemory(value)
+		if err != nil || mb != expect {
+			t.Errorf("parse memory %s expect %d, got %d %v", value, expect, mb, err)
+		}
+	}
+}
+
+func TestImportUnsupportedAndOutsideVolumes(t *testing.T) {
+	root, err := ioutil.TempDir("", "compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "app")
+	os.Mkdir(dir, 0755)
+	ioutil.WriteFile(filepath.Join(root, "secret"), []byte("host secret"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app.conf"), []byte("debug=true"), 0644)
+	os.Symlink(filepath.Join(root, "secret"), filepath.Join(dir, "link"))
+	body := `
+services:
+  app:
+    image: nginx
+    volumes:
+      - type: npipe
+        source: \\.\pipe\docker_engine
+        target: \\.\pipe\docker_engine
+      - ` + filepath.Join(root, "secret") + `:/etc/absolute:ro
+      - ../secret:/etc/relative:ro
+      - ./link:/etc/link:ro
+      - ./app.conf:/etc/app.conf:ro
+`
+	ram, warnings, err := (&Importer{Dir: dir}).Import([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes := map[string]v1alpha1.ComponentVolume{}
+	for _, volume := range ram.Components[0].ServiceVolumeMapList {
+		volumes[volume.VolumeMountPath] = volume
+	}
+	if len(volumes) != 4 || volumes["/etc/app.conf"].FileConent != "debug=true" {
+		t.Fatalf("unexpected volumes %+v", volumes)
+	}
+	for _, target := range []string{"/etc/absolute", "/etc/relative", "/etc/link"} {
+		if volume := volumes[target]; volume.VolumeType != v1alpha1.ConfigFileVolumeType || volume.FileConent != "" {
+			t.Fatalf("the host file out of the directory is read into %+v", volume)
+		}
+	}
+	reported := map[string]bool{}
+	for _, w := range warnings {
+		reported[w.Key] = true
+	}
+	for _, key := range []string{"volumes[0]", "volumes[1]", "volumes[2]", "volumes[3]"} {
+		if !reported[key] {
+			t.Fatalf("expect %s reported, got %v", key, warnings)
+		}
+	}
+}
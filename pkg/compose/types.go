@@ -0,0 +1,446 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goodrain/rainbond-oam/pkg/util"
+)
+
+//File the docker-compose file, only the keys can be represented by the rainbond application config are defined
+type File struct {
+	Version  string              `json:"version,omitempty"`
+	Name     string              `json:"name,omitempty"`
+	Services map[string]*Service `json:"services"`
+	Volumes  map[string]*Volume  `json:"volumes,omitempty"`
+}
+
+//Service the service of the compose file
+type Service struct {
+	Image       string       `json:"image,omitempty"`
+	Command     Command      `json:"command,omitempty"`
+	Environment Environment  `json:"environment,omitempty"`
+	EnvFile     StringList   `json:"env_file,omitempty"`
+	Ports       Ports        `json:"ports,omitempty"`
+	Expose      StringList   `json:"expose,omitempty"`
+	Volumes     []Mount      `json:"volumes,omitempty"`
+	Tmpfs       StringList   `json:"tmpfs,omitempty"`
+	DependsOn   DependsOn    `json:"depends_on,omitempty"`
+	Links       StringList   `json:"links,omitempty"`
+	Healthcheck *Healthcheck `json:"healthcheck,omitempty"`
+	Deploy      *Deploy      `json:"deploy,omitempty"`
+	Scale       int          `json:"scale,omitempty"`
+	MemLimit    Scalar       `json:"mem_limit,omitempty"`
+	Cpus        Scalar       `json:"cpus,omitempty"`
+	Restart     string       `json:"restart,omitempty"`
+}
+
+//Volume the named volume of the compose file
+type Volume struct {
+	External bool   `json:"external,omitempty"`
+	Driver   string `json:"driver,omitempty"`
+}
+
+//UnmarshalJSON accept the legacy external form {name: ...}
+func (v *Volume) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		External json.RawMessage `json:"external"`
+		Driver   string          `json:"driver"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("invalid volume %s: %v", string(data), err)
+	}
+	v.Driver = raw.Driver
+	external := strings.TrimSpace(string(raw.External))
+	v.External = external != "" && external != "false" && external != "null"
+	return nil
+}
+
+//Healthcheck the health check of the service
+type Healthcheck struct {
+	Test        StringList `json:"test,omitempty"`
+	Interval    string     `json:"interval,omitempty"`
+	Timeout     string     `json:"timeout,omitempty"`
+	StartPeriod string     `json:"start_period,omitempty"`
+	Retries     int        `json:"retries,omitempty"`
+	Disable     bool       `json:"disable,omitempty"`
+}
+
+//Deploy the deploy config of the service
+type Deploy struct {
+	Replicas  *int       `json:"replicas,omitempty"`
+	Resources *Resources `json:"resources,omitempty"`
+}
+
+//Resources the resource limits and reservations of the service
+type Resources struct {
+	Limits       *Resource `json:"limits,omitempty"`
+	Reservations *Resource `json:"reservations,omitempty"`
+}
+
+//Resource cpus is the count of cores, memory is the byte value such as 512m
+type Resource struct {
+	Cpus   Scalar `json:"cpus,omitempty"`
+	Memory Scalar `json:"memory,omitempty"`
+}
+
+//Scalar a string, number or bool value, it is kept as string
+type Scalar string
+
+//UnmarshalJSON accept any scalar value
+func (s *Scalar) UnmarshalJSON(data []byte) error {
+	value, err := scalarString(data)
+	if err != nil {
+		return err
+	}
+	if value != nil {
+		*s = Scalar(*value)
+	}
+	return nil
+}
+
+// scalarString the string of the scalar value, nil for null
+func scalarString(data []byte) (*string, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &v, nil
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		return &s, nil
+	case bool:
+		s := strconv.FormatBool(v)
+		return &s, nil
+	default:
+		return nil, fmt.Errorf("expect a scalar value, got %s", string(data))
+	}
+}
+
+//StringList a list of scalar values, a single value is accepted as a list of one item
+type StringList []string
+
+//UnmarshalJSON accept a scalar or a list of scalars
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		items = []json.RawMessage{data}
+	}
+	*l = nil
+	for _, item := range items {
+		value, err := scalarString(item)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			*l = append(*l, *value)
+		}
+	}
+	return nil
+}
+
+//Command the command line of the service, the list form is joined with the shell quoting
+type Command string
+
+//UnmarshalJSON accept the shell form and the list form
+func (c *Command) UnmarshalJSON(data []byte) error {
+	var line string
+	if err := json.Unmarshal(data, &line); err == nil {
+		*c = Command(line)
+		return nil
+	}
+	var words StringList
+	if err := json.Unmarshal(data, &words); err != nil {
+		return fmt.Errorf("command must be a string or a list: %v", err)
+	}
+	*c = Command(util.JoinShellWords(words))
+	return nil
+}
+
+//Environment the environment of the service, the value of the env without value is nil
+type Environment map[string]*string
+
+//UnmarshalJSON accept the map form and the list form of KEY=VALUE
+func (e *Environment) UnmarshalJSON(data []byte) error {
+	env := Environment{}
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		for _, item := range list {
+			if i := strings.Index(item, "="); i >= 0 {
+				value := item[i+1:]
+				env[item[:i]] = &value
+			} else {
+				env[item] = nil
+			}
+		}
+		*e = env
+		return nil
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("environment must be a map or a list: %v", err)
+	}
+	for name, raw := range values {
+		value, err := scalarString(raw)
+		if err != nil {
+			return fmt.Errorf("environment %s: %v", name, err)
+		}
+		env[name] = value
+	}
+	*e = env
+	return nil
+}
+
+//Names the sorted env names
+func (e Environment) Names() []string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//DependsOn the services the service depends on
+type DependsOn []string
+
+//UnmarshalJSON accept the list form and the map form with conditions, the conditions are ignored
+func (d *DependsOn) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*d = list
+		return nil
+	}
+	var conditions map[string]json.RawMessage
+	if err := json.Unmarshal(data, &conditions); err != nil {
+		return fmt.Errorf("depends_on must be a list or a map: %v", err)
+	}
+	*d = nil
+	for name := range conditions {
+		*d = append(*d, name)
+	}
+	sort.Strings(*d)
+	return nil
+}
+
+//Port the port of the service, published is empty if the port is not published to the host
+type Port struct {
+	Target    int    `json:"target"`
+	Published string `json:"published,omitempty"`
+	HostIP    string `json:"host_ip,omitempty"`
+	Protocol  string `json:"protocol,omitempty"`
+}
+
+//Ports the ports of the service
+type Ports []Port
+
+//UnmarshalJSON accept the short syntax such as 127.0.0.1:8080:80/udp, the port ranges are expanded, and the long syntax
+func (p *Ports) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("ports must be a list: %v", err)
+	}
+	*p = nil
+	for _, item := range items {
+		var long struct {
+			Target    int    `json:"target"`
+			Published Scalar `json:"published"`
+			HostIP    string `json:"host_ip"`
+			Protocol  string `json:"protocol"`
+		}
+		if err := json.Unmarshal(item, &long); err == nil {
+			if long.Target <= 0 {
+				return fmt.Errorf("port %s has no target", string(item))
+			}
+			*p = append(*p, Port{Target: long.Target, Published: string(long.Published), HostIP: long.HostIP, Protocol: long.Protocol})
+			continue
+		}
+		value, err := scalarString(item)
+		if err != nil || value == nil {
+			return fmt.Errorf("invalid port %s", string(item))
+		}
+		ports, err := ParsePort(*value)
+		if err != nil {
+			return err
+		}
+		*p = append(*p, ports...)
+	}
+	return nil
+}
+
+// the count of ports a range can be expanded to
+const maxPortRange = 100
+
+//ParsePort parse the short syntax of the port, [[host_ip:]published:]target[/protocol]
+func ParsePort(spec string) ([]Port, error) {
+	protocol := ""
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		spec, protocol = spec[:i], strings.ToLower(spec[i+1:])
+	}
+	var hostIP, published, target string
+	// the host ip may be an ipv6 address in brackets
+	if i := strings.LastIndex(spec, "]:"); strings.HasPrefix(spec, "[") && i > 0 {
+		hostIP, spec = spec[1:i], spec[i+2:]
+	}
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 1:
+		target = parts[0]
+	case 2:
+		published, target = parts[0], parts[1]
+	case 3:
+		hostIP, published, target = parts[0], parts[1], parts[2]
+	default:
+		return nil, fmt.Errorf("invalid port %s", spec)
+	}
+	targets, err := portRange(target)
+	if err != nil {
+		return nil, err
+	}
+	var publishes []int
+	if published != "" {
+		if publishes, err = portRange(published); err != nil {
+			return nil, err
+		}
+		if len(publishes) != len(targets) && len(publishes) != 1 {
+			return nil, fmt.Errorf("published port range %s does not match the target port range %s", published, target)
+		}
+	}
+	var ports []Port
+	for i, t := range targets {
+		port := Port{Target: t, HostIP: hostIP, Protocol: protocol}
+		switch {
+		case len(publishes) == len(targets):
+			port.Published = strconv.Itoa(publishes[i])
+		case len(publishes) == 1:
+			port.Published = strconv.Itoa(publishes[0])
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func portRange(spec string) ([]int, error) {
+	bounds := strings.SplitN(spec, "-", 2)
+	start, err := strconv.Atoi(bounds[0])
+	if err != nil || start <= 0 || start > 65535 {
+		return nil, fmt.Errorf("invalid port %s", spec)
+	}
+	end := start
+	if len(bounds) == 2 {
+		if end, err = strconv.Atoi(bounds[1]); err != nil || end < start || end > 65535 {
+			return nil, fmt.Errorf("invalid port range %s", spec)
+		}
+	}
+	if end-start >= maxPortRange {
+		return nil, fmt.Errorf("port range %s is larger than %d", spec, maxPortRange)
+	}
+	var ports []int
+	for port := start; port <= end; port++ {
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+//Mount types
+var (
+	//VolumeMountType the named or anonymous volume
+	VolumeMountType = "volume"
+	//BindMountType the path of the host
+	BindMountType = "bind"
+	//TmpfsMountType the memory file system
+	TmpfsMountType = "tmpfs"
+)
+
+//Mount the volume of the service
+type Mount struct {
+	Type     string `json:"type"`
+	Source   string `json:"source,omitempty"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+//UnmarshalJSON accept the short syntax such as ./conf:/etc/conf:ro and the long syntax
+func (m *Mount) UnmarshalJSON(data []byte) error {
+	var spec string
+	if err := json.Unmarshal(data, &spec); err == nil {
+		mount, err := ParseMount(spec)
+		if err != nil {
+			return err
+		}
+		*m = mount
+		return nil
+	}
+	type mount Mount
+	var long mount
+	if err := json.Unmarshal(data, &long); err != nil {
+		return fmt.Errorf("invalid volume %s: %v", string(data), err)
+	}
+	if long.Target == "" {
+		return fmt.Errorf("volume %s has no target", string(data))
+	}
+	if long.Type == "" {
+		long.Type = VolumeMountType
+	}
+	*m = Mount(long)
+	return nil
+}
+
+//ParseMount parse the short syntax of the volume, [source:]target[:mode]
+func ParseMount(spec string) (Mount, error) {
+	parts := strings.Split(spec, ":")
+	var mount Mount
+	switch len(parts) {
+	case 1:
+		mount.Target = parts[0]
+	case 2:
+		if strings.HasPrefix(parts[1], "/") {
+			mount.Source, mount.Target = parts[0], parts[1]
+		} else {
+			mount.Target = parts[0]
+			mount.ReadOnly = parts[1] == "ro"
+		}
+	case 3:
+		mount.Source, mount.Target = parts[0], parts[1]
+		for _, mode := range strings.Split(parts[2], ",") {
+			if mode == "ro" {
+				mount.ReadOnly = true
+			}
+		}
+	default:
+		return mount, fmt.Errorf("invalid volume %s", spec)
+	}
+	if mount.Target == "" {
+		return mount, fmt.Errorf("volume %s has no target", spec)
+	}
+	mount.Type = VolumeMountType
+	if strings.HasPrefix(mount.Source, ".") || strings.HasPrefix(mount.Source, "/") || strings.HasPrefix(mount.Source, "~") {
+		mount.Type = BindMountType
+	}
+	return mount, nil
+}
@@ -0,0 +1,63 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"strings"
+
+	"github.com/goodrain/rainbond-oam/pkg/util"
+)
+
+// kubeCommandMapper escape the words for the container command and args of kubernetes, the references
+// of envs are converted to $(NAME) which is expanded by kubelet, a literal $ is escaped as $$.
+var kubeCommandMapper = util.ShellWordsMapper{
+	Literal:   func(text string) string { return strings.Replace(text, "$", "$$", -1) },
+	Reference: func(name string) string { return "$(" + name + ")" },
+}
+
+// buildCommand the Cmd of the component replaces the CMD of the image, same as Rainbond does. All the
+// words of Cmd become the args of the container and the command is always empty, so the ENTRYPOINT of the
+// image is kept and receives the args. An empty Cmd returns no args to keep the CMD of the image.
+func buildCommand(cmd string) (command, args []string) {
+	args, err := kubeCommandMapper.Split(cmd)
+	if err != nil {
+		// the command has been validated, keep the raw words if it is built without validation
+		return nil, strings.Fields(cmd)
+	}
+	return nil, args
+}
+
+// buildExecProbeCommand the probe command is executed directly without a shell and kubelet does not expand
+// the envs, so a command referencing envs is run by /bin/sh -c.
+func buildExecProbeCommand(cmd string) []string {
+	var reference bool
+	words, err := util.ShellWordsMapper{
+		Reference: func(name string) string {
+			reference = true
+			return "${" + name + "}"
+		},
+	}.Split(cmd)
+	if err != nil {
+		return []string{"/bin/sh", "-c", cmd}
+	}
+	if reference {
+		return []string{"/bin/sh", "-c", strings.TrimSpace(cmd)}
+	}
+	return words
+}
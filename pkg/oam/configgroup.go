@@ -0,0 +1,193 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//ConfigGroupMountDir the config items of file injection groups are mounted as <dir>/<group>/<item>
+var ConfigGroupMountDir = "/etc/config"
+
+// config group injection types
+var (
+	envInjection  = "env"
+	fileInjection = "file"
+)
+
+//NewConfigGroupConfigMap create the configmap of the app config group
+func NewConfigGroupConfigMap(group v1alpha1.AppConfigGroup) *core.ConfigMap {
+	data := make(map[string]string, len(group.ConfigItems))
+	for k, v := range group.ConfigItems {
+		data[k] = v
+	}
+	return &core.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: configGroupName(group),
+			Annotations: map[string]string{
+				"app.rainbond.io/config-group": group.Name,
+			},
+		},
+		Data: data,
+	}
+}
+
+func configGroupName(group v1alpha1.AppConfigGroup) string {
+	name := sanitizeName(group.Name)
+	if name == "" || name != strings.ToLower(group.Name) {
+		// the group name is not a valid resource name, such as chinese name
+		sum := sha256.Sum256([]byte(group.Name))
+		name = strings.Trim(name+fmt.Sprintf("-%x", sum[:4]), "-")
+	}
+	return "config-group-" + name
+}
+
+func configGroupMountPath(group v1alpha1.AppConfigGroup, item string) string {
+	return path.Join(ConfigGroupMountDir, group.Name, item)
+}
+
+func isEnvInjection(group v1alpha1.AppConfigGroup) bool {
+	return strings.ToLower(group.InjectionType) == envInjection
+}
+
+func configItemKeys(group v1alpha1.AppConfigGroup) []string {
+	return sortedKeys(group.ConfigItems)
+}
+
+// buildConfigGroup validate the config groups and create their configmaps
+func (b *builder) buildConfigGroup() error {
+	for _, group := range b.ram.AppConfigGroups {
+		switch strings.ToLower(group.InjectionType) {
+		case envInjection, fileInjection:
+		default:
+			return fmt.Errorf("config group %s has unknown injection type %s", group.Name, group.InjectionType)
+		}
+		for _, key := range group.ComponentKeys {
+			if b.getComponent(key) == nil {
+				return fmt.Errorf("config group %s refers to unknown component %s", group.Name, key)
+			}
+		}
+		b.addResource(NewConfigGroupConfigMap(group))
+	}
+	for _, com := range b.ram.Components {
+		if err := validateConfigGroupEnvs(com, componentConfigGroups(b.ram.AppConfigGroups, com.ServiceKey)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateConfigGroupEnvs the env injected by config groups must not collide with the envs of the component
+func validateConfigGroupEnvs(com *v1alpha1.Component, groups []v1alpha1.AppConfigGroup) error {
+	owners := make(map[string]string)
+	for _, env := range com.Envs {
+		owners[env.AttrName] = "component " + com.ServiceCname
+	}
+	for _, group := range groups {
+		if !isEnvInjection(group) {
+			continue
+		}
+		for _, name := range configItemKeys(group) {
+			if owner, ok := owners[name]; ok {
+				return fmt.Errorf("env %s of config group %s collides with the env of %s", name, group.Name, owner)
+			}
+			owners[name] = "config group " + group.Name
+		}
+	}
+	return nil
+}
+
+// componentConfigGroups the config groups the component is a member of
+func componentConfigGroups(groups []v1alpha1.AppConfigGroup, componentKey string) []v1alpha1.AppConfigGroup {
+	var re []v1alpha1.AppConfigGroup
+	for _, group := range groups {
+		for _, key := range group.ComponentKeys {
+			if key == componentKey {
+				re = append(re, group)
+				break
+			}
+		}
+	}
+	return re
+}
+
+// injectConfigGroups inject the config groups into the oam container, the values are inlined
+// because oam containers can not refer to configmaps
+func injectConfigGroups(container *v1alpha2.Container, groups []v1alpha1.AppConfigGroup) {
+	for _, group := range groups {
+		for _, name := range configItemKeys(group) {
+			value := group.ConfigItems[name]
+			if isEnvInjection(group) {
+				container.Environment = append(container.Environment, v1alpha2.ContainerEnvVar{Name: name, Value: &value})
+			} else {
+				container.ConfigFiles = append(container.ConfigFiles, v1alpha2.ContainerConfigFile{
+					Path:  configGroupMountPath(group, name),
+					Value: &value,
+				})
+			}
+		}
+	}
+}
+
+// injectKubeConfigGroups inject the config groups into the kubernetes container by the configmaps of groups
+func injectKubeConfigGroups(container *core.Container, groups []v1alpha1.AppConfigGroup) (volumes []core.Volume) {
+	for _, group := range groups {
+		name := configGroupName(group)
+		if isEnvInjection(group) {
+			for _, key := range configItemKeys(group) {
+				container.Env = append(container.Env, core.EnvVar{
+					Name: key,
+					ValueFrom: &core.EnvVarSource{
+						ConfigMapKeyRef: &core.ConfigMapKeySelector{
+							LocalObjectReference: core.LocalObjectReference{Name: name},
+							Key:                  key,
+						},
+					},
+				})
+			}
+			continue
+		}
+		volumes = append(volumes, core.Volume{
+			Name: name,
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: core.LocalObjectReference{Name: name},
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
+			Name:      name,
+			MountPath: path.Join(ConfigGroupMountDir, group.Name),
+			ReadOnly:  true,
+		})
+	}
+	return
+}
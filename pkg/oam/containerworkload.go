@@ -20,36 +20,59 @@ package oam
 
 import (
 	"fmt"
-	"strings"
 
 	v1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
 	v1alpha1 "github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
 type containerWorkloadBuilder struct {
-	com     v1alpha1.Component
-	plugins []v1alpha1.Plugin
-	output  []v1alpha2.DataOutput
+	com       v1alpha1.Component
+	plugins   []v1alpha1.Plugin
+	output    []v1alpha2.DataOutput
+	input     []v1alpha2.DataInput
+	resources []runtime.Object
+	options   *options
+	// the config groups are injected by the caller
+	skipConfigGroups bool
 }
 
-func (c *containerWorkloadBuilder) Build() runtime.RawExtension {
+func (c *containerWorkloadBuilder) Build() (runtime.RawExtension, error) {
+	c.output = nil
+	c.input = nil
+	c.resources = nil
+	if c.options == nil {
+		c.options = newOptions(nil)
+	}
+	if err := diagnoseComponent(&c.com, c.plugins, c.options.diagnostics); err != nil {
+		return runtime.RawExtension{}, err
+	}
+	containers := c.buildContainers()
+	for i := range containers {
+		c.injectDependencyEnv(&containers[i], fmt.Sprintf("spec.containers[%d]", i))
+	}
 	oamOS := v1alpha2.OperatingSystemLinux
 	oamCPU := v1alpha2.CPUArchitectureAMD64
 	var cw = &v1alpha2.ContainerizedWorkload{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       v1alpha2.ContainerizedWorkloadKind,
+		},
+		// the oam runtime copies the labels of the workload to the pods, the services select the pods by name
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        c.com.ServiceCname,
-			Labels:      map[string]string{},
+			Name:        componentName(&c.com),
+			Labels:      map[string]string{"name": componentName(&c.com)},
 			Annotations: map[string]string{},
 		},
 		Spec: v1alpha2.ContainerizedWorkloadSpec{
 			OperatingSystem: &oamOS,
 			CPUArchitecture: &oamCPU,
-			Containers:      c.buildContainers(),
+			Containers:      containers,
 		},
 	}
-	return runtime.RawExtension{Object: cw}
+	return runtime.RawExtension{Object: cw}, nil
 }
 
 func (c *containerWorkloadBuilder) Kind() string {
@@ -59,11 +82,67 @@ func (c *containerWorkloadBuilder) Output() []v1alpha2.DataOutput {
 	return c.output
 }
 
+func (c *containerWorkloadBuilder) sharedVolumes() []SharedVolume {
+	if c.options == nil {
+		return nil
+	}
+	return c.options.sharedVolumes
+}
+
+func (c *containerWorkloadBuilder) Input() []v1alpha2.DataInput {
+	return c.input
+}
+
+// injectDependencyEnv declare the envs of dependent components in the container, their values are
+// filled by the data inputs. the env defined by the container itself takes precedence.
+func (c *containerWorkloadBuilder) injectDependencyEnv(container *v1alpha2.Container, path string) {
+	exists := make(map[string]bool, len(container.Environment))
+	for _, env := range container.Environment {
+		exists[env.Name] = true
+	}
+	for _, dep := range c.options.dependencyEnvs {
+		if exists[dep.Name] {
+			continue
+		}
+		exists[dep.Name] = true
+		container.Environment = append(container.Environment, v1alpha2.ContainerEnvVar{Name: dep.Name, Value: dep.Value})
+		if dep.Value != nil {
+			continue
+		}
+		c.input = appendDataInput(c.input, dep.OutputName, fmt.Sprintf("%s.env[%d].value", path, len(container.Environment)-1))
+	}
+}
+
+func (c *containerWorkloadBuilder) Resources() []runtime.Object {
+	return c.resources
+}
+
 func (c *containerWorkloadBuilder) buildContainers() []v1alpha2.Container {
 	com := c.com
 	var containers []v1alpha2.Container
-	mainContainer := v1alpha2.Container{
-		Name:  com.ServiceName,
+	containers = append(containers, c.buildMainContainer())
+	//plugin container
+	for i, pluginConfig := range com.ServicePluginConfigs {
+		plugin := c.getPlugin(pluginConfig.PluginKey)
+		if plugin == nil {
+			continue
+		}
+		// the oam containerized workload has no init containers, the init plugin must not run as a sidecar
+		if plugin.Category == v1alpha1.InitPluginCategory {
+			c.options.diagnostics.Warnf(fmt.Sprintf("service_related_plugin_config[%d].plugin_key", i), UnsupportedInitPluginCode,
+				"init plugin %s is not run, the containerized workload has no init containers, use the kubernetes builder", plugin.PluginKey)
+			continue
+		}
+		containers = append(containers, c.buildPluginContainer(*plugin, pluginConfig, com))
+	}
+	return containers
+}
+
+func (c *containerWorkloadBuilder) buildMainContainer() v1alpha2.Container {
+	com := c.com
+	command, args := buildCommand(com.Cmd)
+	container := v1alpha2.Container{
+		Name:  componentName(&com),
 		Image: com.Image,
 		Resources: &v1alpha2.ContainerResources{
 			Memory: v1alpha2.MemoryResources{
@@ -72,35 +151,30 @@ func (c *containerWorkloadBuilder) buildContainers() []v1alpha2.Container {
 			CPU: v1alpha2.CPUResources{
 				Required: NewCPUQuantity(com.CPU),
 			},
-			Volumes: c.buildVolumes(com.ServiceVolumeMapList, com.MntReleationList),
+			Volumes: c.buildVolumes(com.ServiceVolumeMapList, c.sharedVolumes()),
 		},
-		Command:         strings.Split(com.Cmd, " "),
+		Command:         command,
+		Arguments:       args,
 		Environment:     c.buildEnv(com.Envs, com.ServiceConnectInfoMapList, true),
-		ConfigFiles:     c.buildConfigFile(com.ServiceVolumeMapList),
+		ConfigFiles:     c.buildConfigFile(com.ServiceVolumeMapList, c.sharedVolumes()),
 		Ports:           c.buildPorts(com.Ports),
-		LivenessProbe:   c.buildLivenessProbe(com.Probes),
-		ReadinessProbe:  c.buildReadinessProbe(com.Probes),
-		ImagePullSecret: c.buildImagePullSecret(com.AppImage),
+		LivenessProbe:   buildProbe(com.Probes, v1alpha1.LivenessProbeMode),
+		ReadinessProbe:  buildProbe(com.Probes, v1alpha1.ReadinessProbeMode),
+		ImagePullSecret: c.buildImagePullSecret(com.Image, com.AppImage),
 	}
-	containers = append(containers, mainContainer)
-	//plugin container
-	for _, pluginConfig := range com.ServicePluginConfigs {
-		plugin := c.getPlugin(pluginConfig.PluginKey)
-		if plugin != nil {
-			containers = append(containers, c.buildPluginContainer(*plugin, pluginConfig, com))
-		}
+	if !c.skipConfigGroups && c.options != nil {
+		injectConfigGroups(&container, componentConfigGroups(c.options.configGroups, com.ServiceKey))
 	}
-	return containers
+	return container
 }
 
-//TODO: share volume
-func (c *containerWorkloadBuilder) buildVolumes(volumes v1alpha1.ComponentVolumeList, shareVolume []v1alpha1.ComponentShareVolume) (re []v1alpha2.VolumeResource) {
+func (c *containerWorkloadBuilder) buildVolumes(volumes v1alpha1.ComponentVolumeList, shareVolume []SharedVolume) (re []v1alpha2.VolumeResource) {
 	for _, volume := range volumes {
-		if volume.VolumeType == v1alpha1.ConfigFileVolumeType {
+		if volume.VolumeType == v1alpha1.ConfigFileVolumeType || ownedSharedVolume(shareVolume, volume.VolumeName) != nil {
 			continue
 		}
 		vr := v1alpha2.VolumeResource{
-			Name:          volume.VolumeName,
+			Name:          sanitizeName(volume.VolumeName),
 			MountPath:     volume.VolumeMountPath,
 			AccessMode:    NewVolumeAccess(volume.AccessMode),
 			SharingPolicy: NewSharingPolicy(volume.SharingPolicy),
@@ -111,12 +185,40 @@ func (c *containerWorkloadBuilder) buildVolumes(volumes v1alpha1.ComponentVolume
 		}
 		re = append(re, vr)
 	}
+	// the name of shared volume is the name of the shared claim
+	share := v1alpha2.VolumeSharingPolicyShared
+	for _, sv := range shareVolume {
+		if sv.Volume.VolumeType == v1alpha1.ConfigFileVolumeType {
+			continue
+		}
+		vr := v1alpha2.VolumeResource{
+			Name:          sv.ClaimName,
+			MountPath:     sv.MountPath,
+			AccessMode:    NewVolumeAccess(sv.Volume.AccessMode),
+			SharingPolicy: &share,
+			Disk:          &v1alpha2.DiskResource{},
+		}
+		if sv.Volume.VolumeCapacity > 0 {
+			vr.Disk.Required = NewDiskQuantity(sv.Volume.VolumeCapacity)
+		}
+		re = append(re, vr)
+	}
 	return
 }
 
-//TODO: share config file
-func (c *containerWorkloadBuilder) buildConfigFile(volumes v1alpha1.ComponentVolumeList) (re []v1alpha2.ContainerConfigFile) {
-	for _, volume := range volumes {
+func (c *containerWorkloadBuilder) buildConfigFile(volumes v1alpha1.ComponentVolumeList, shareVolume []SharedVolume) (re []v1alpha2.ContainerConfigFile) {
+	// shared config files are copied from the owner component
+	for i := range shareVolume {
+		if shareVolume[i].Volume.VolumeType != v1alpha1.ConfigFileVolumeType {
+			continue
+		}
+		re = append(re, v1alpha2.ContainerConfigFile{
+			Path:  shareVolume[i].MountPath,
+			Value: &shareVolume[i].Volume.FileConent,
+		})
+	}
+	for i := range volumes {
+		volume := &volumes[i]
 		if volume.VolumeType != v1alpha1.ConfigFileVolumeType {
 			continue
 		}
@@ -130,21 +232,21 @@ func (c *containerWorkloadBuilder) buildConfigFile(volumes v1alpha1.ComponentVol
 }
 
 func (c *containerWorkloadBuilder) buildEnv(envs, connect []v1alpha1.ComponentEnv, insetOutput bool) (re []v1alpha2.ContainerEnvVar) {
-	for _, env := range envs {
+	for i := range envs {
 		re = append(re, v1alpha2.ContainerEnvVar{
-			Name:  env.AttrName,
-			Value: &env.AttrValue,
+			Name:  envs[i].AttrName,
+			Value: &envs[i].AttrValue,
 		})
 	}
-	for _, out := range connect {
+	for i := range connect {
 		re = append(re, v1alpha2.ContainerEnvVar{
-			Name:  out.AttrName,
-			Value: &out.AttrValue,
+			Name:  connect[i].AttrName,
+			Value: &connect[i].AttrValue,
 		})
 		if insetOutput {
 			c.output = append(c.output, v1alpha2.DataOutput{
-				Name:      out.AttrName,
-				FieldPath: fmt.Sprintf("spec.container[0].env[%d].value", len(re)-1),
+				Name:      outputName(componentName(&c.com), connect[i].AttrName),
+				FieldPath: fmt.Sprintf("spec.containers[0].env[%d].value", len(re)-1),
 			})
 		}
 	}
@@ -155,7 +257,7 @@ func (c *containerWorkloadBuilder) buildEnv(envs, connect []v1alpha1.ComponentEn
 func (c *containerWorkloadBuilder) buildPorts(ports []v1alpha1.ComponentPort) (re []v1alpha2.ContainerPort) {
 	for _, p := range ports {
 		re = append(re, v1alpha2.ContainerPort{
-			Name:     strings.ToLower(p.PortAlias),
+			Name:     portName(p.PortAlias),
 			Port:     int32(p.ContainerPort),
 			Protocol: NewTransportProtocol(p.Protocol),
 		})
@@ -163,33 +265,38 @@ func (c *containerWorkloadBuilder) buildPorts(ports []v1alpha1.ComponentPort) (r
 	return
 }
 
-//TODO: build secret
-func (c *containerWorkloadBuilder) buildImagePullSecret(info v1alpha1.ImageInfo) *string {
-	var secret string
-	return &secret
-}
-
-func (c *containerWorkloadBuilder) buildLivenessProbe(probes []v1alpha1.ComponentProbe) *v1alpha2.ContainerHealthProbe {
-	for _, probe := range probes {
-		if probe.Mode == "livebess" {
-			return createProbe(probe)
-		}
+func (c *containerWorkloadBuilder) buildImagePullSecret(image string, info v1alpha1.ImageInfo) *string {
+	secret := NewImagePullSecret(image, info)
+	if secret == nil {
+		return nil
 	}
-	return nil
-}
-
-func (c *containerWorkloadBuilder) buildReadinessProbe(probes []v1alpha1.ComponentProbe) *v1alpha2.ContainerHealthProbe {
-	for _, probe := range probes {
-		if probe.Mode == "readiness" {
-			return createProbe(probe)
+	for _, res := range c.resources {
+		if exist, ok := res.(*core.Secret); ok && exist.GetName() == secret.GetName() {
+			return &exist.Name
 		}
 	}
-	return nil
+	c.resources = append(c.resources, secret)
+	return &secret.Name
 }
 
+// buildPluginContainer the sidecar runs the image of the plugin with its own entrypoint, it only
+// receives the envs generated from the plugin config and the volumes its config points into.
 func (c *containerWorkloadBuilder) buildPluginContainer(plugin v1alpha1.Plugin, pluginConfig v1alpha1.ComponentPluginConfig, com v1alpha1.Component) v1alpha2.Container {
+	envs := buildPluginEnv(plugin, pluginConfig, com)
+	var volumes []v1alpha2.VolumeResource
+	for _, volume := range c.buildVolumes(com.ServiceVolumeMapList, c.sharedVolumes()) {
+		if pluginNeedPath(envs, volume.MountPath) {
+			volumes = append(volumes, volume)
+		}
+	}
+	var configFiles []v1alpha2.ContainerConfigFile
+	for _, file := range c.buildConfigFile(com.ServiceVolumeMapList, c.sharedVolumes()) {
+		if pluginNeedPath(envs, file.Path) {
+			configFiles = append(configFiles, file)
+		}
+	}
 	return v1alpha2.Container{
-		Name:  plugin.PluginName,
+		Name:  pluginContainerName(plugin),
 		Image: plugin.Image,
 		Resources: &v1alpha2.ContainerResources{
 			Memory: v1alpha2.MemoryResources{
@@ -198,71 +305,11 @@ func (c *containerWorkloadBuilder) buildPluginContainer(plugin v1alpha1.Plugin,
 			CPU: v1alpha2.CPUResources{
 				Required: NewCPUQuantity(pluginConfig.CPURequired),
 			},
-			Volumes: c.buildVolumes(com.ServiceVolumeMapList, com.MntReleationList),
+			Volumes: volumes,
 		},
-		Command:         strings.Split(com.Cmd, " "),
-		Environment:     c.buildEnv(c.com.Envs, c.com.ServiceConnectInfoMapList, false),
-		ConfigFiles:     c.buildConfigFile(c.com.ServiceVolumeMapList),
-		ImagePullSecret: c.buildImagePullSecret(plugin.PluginImage),
-	}
-}
-
-func createProbe(probe v1alpha1.ComponentProbe) *v1alpha2.ContainerHealthProbe {
-	return &v1alpha2.ContainerHealthProbe{
-		Exec: func() *v1alpha2.ExecProbe {
-			if probe.Cmd != "" {
-				return &v1alpha2.ExecProbe{
-					Command: strings.Split(probe.Cmd, " "),
-				}
-			}
-			return nil
-		}(),
-		HTTPGet: func() *v1alpha2.HTTPGetProbe {
-			if probe.Scheme == "http" {
-				return &v1alpha2.HTTPGetProbe{
-					Path: probe.Path,
-					Port: int32(probe.Port),
-					HTTPHeaders: func() []v1alpha2.HTTPHeader {
-						if probe.HTTPHeader == "" {
-							return nil
-						}
-						hds := strings.Split(probe.HTTPHeader, ",")
-						var headers []v1alpha2.HTTPHeader
-						for _, hd := range hds {
-							kv := strings.Split(hd, "=")
-							if len(kv) == 1 {
-								header := v1alpha2.HTTPHeader{
-									Name:  kv[0],
-									Value: "",
-								}
-								headers = append(headers, header)
-							} else if len(kv) == 2 {
-								header := v1alpha2.HTTPHeader{
-									Name:  kv[0],
-									Value: kv[1],
-								}
-								headers = append(headers, header)
-							}
-						}
-						return headers
-					}(),
-				}
-			}
-			return nil
-		}(),
-		TCPSocket: func() *v1alpha2.TCPSocketProbe {
-			if probe.Scheme == "tcp" {
-				return &v1alpha2.TCPSocketProbe{
-					Port: int32(probe.Port),
-				}
-			}
-			return nil
-		}(),
-		InitialDelaySeconds: Int32(probe.InitialDelaySecond),
-		PeriodSeconds:       Int32(probe.PeriodSecond),
-		TimeoutSeconds:      Int32(probe.TimeoutSecond),
-		SuccessThreshold:    Int32(probe.SuccessThreshold),
-		FailureThreshold:    Int32(probe.FailureThreshold),
+		Environment:     envs,
+		ConfigFiles:     configFiles,
+		ImagePullSecret: c.buildImagePullSecret(plugin.Image, plugin.PluginImage),
 	}
 }
 
@@ -19,119 +19,436 @@
 package oam
 
 import (
+	"fmt"
+	"strings"
+
+	runtimev1alpha1 "github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
 	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type builder struct {
-	oamApp *v1alpha2.ApplicationConfiguration
-	ram    v1alpha1.RainbondApplicationConfig
+	app     *Application
+	ram     v1alpha1.RainbondApplicationConfig
+	opts    []Option
+	options *options
+	// component key -> oam component name
+	names map[string]string
+	// kubernetes render plain kubernetes objects instead of the oam application
+	kubernetes bool
 }
 
 //Builder oam application model builder
 type Builder interface {
 	// build oam application
-	Build() *v1alpha2.ApplicationConfiguration
+	Build() (*Application, error)
 }
 
 //WorkloadBuilder workload builder
 type WorkloadBuilder interface {
-	Build() runtime.RawExtension
+	Build() (runtime.RawExtension, error)
 	Output() []v1alpha2.DataOutput
+	// Input data inputs inject the outputs of dependent components into the workload
+	Input() []v1alpha2.DataInput
 	Kind() string
+	// Resources kubernetes resources the workload depends on, such as configmaps and services
+	Resources() []runtime.Object
+}
+
+//Application oam application bundle, holds the application configuration
+//and every object it references
+type Application struct {
+	AppConfiguration *v1alpha2.ApplicationConfiguration
+	Components       []v1alpha2.Component
+	// Traits the trait objects embedded in the application configuration,
+	// they are created by the oam runtime and not returned by Objects
+	Traits []runtime.Object
+	Scopes []runtime.Object
+	// Resources kubernetes resources required by the workloads
+	Resources []runtime.Object
+	// Definitions workload, trait and scope definitions used by the application
+	Definitions []runtime.Object
+	// Diagnostics the fields of the rainbond application config converted with the default values
+	Diagnostics []Diagnostic
+}
+
+//Objects return all objects that need to be applied, in apply order
+func (a *Application) Objects() []runtime.Object {
+	var objects []runtime.Object
+	objects = append(objects, a.Definitions...)
+	objects = append(objects, a.Scopes...)
+	objects = append(objects, a.Resources...)
+	for i := range a.Components {
+		objects = append(objects, &a.Components[i])
+	}
+	if a.AppConfiguration != nil {
+		objects = append(objects, a.AppConfiguration)
+	}
+	return objects
 }
 
 //NewBuilder new oam model builder
-func NewBuilder(ram v1alpha1.RainbondApplicationConfig) Builder {
-	var oam v1alpha2.ApplicationConfiguration
+func NewBuilder(ram v1alpha1.RainbondApplicationConfig, opts ...Option) Builder {
 	return &builder{
-		oamApp: &oam,
-		ram:    ram,
+		ram:  ram,
+		opts: opts,
 	}
 }
 
-//NewWorkloadBuilder new workload builder
-func NewWorkloadBuilder(com v1alpha1.Component, plugins []v1alpha1.Plugin) WorkloadBuilder {
+//NewWorkloadBuilder new workload builder, the component of unknown deploy type is built as stateless component.
+//The fields converted with the default values are recorded into the diagnostics set by WithDiagnostics.
+func NewWorkloadBuilder(com v1alpha1.Component, plugins []v1alpha1.Plugin, opts ...Option) WorkloadBuilder {
 	switch com.DeployType {
 	case v1alpha1.StateMultipleDeployType, v1alpha1.StateSingletonDeployType:
 		return &statefulWorkloadBuilder{
 			com:     com,
 			plugins: plugins,
-		}
-	case v1alpha1.StatelessMultipleDeployType, v1alpha1.StatelessSingletionDeployType:
-		return &containerWorkloadBuilder{
-			com:     com,
-			plugins: plugins,
+			options: newOptions(opts),
 		}
 	default:
 		return &containerWorkloadBuilder{
 			com:     com,
 			plugins: plugins,
+			options: newOptions(opts),
 		}
 	}
 }
 
-func (b *builder) Build() *v1alpha2.ApplicationConfiguration {
-	return b.oamApp
+func (b *builder) Build() (*Application, error) {
+	if err := b.ram.ConversionValidation(); err != nil {
+		return nil, err
+	}
+	b.app = &Application{}
+	b.options = newOptions(b.opts)
+	if b.options.diagnostics == nil {
+		b.options.diagnostics = NewDiagnostics()
+	}
+	b.names = make(map[string]string, len(b.ram.Components))
+	if !b.kubernetes {
+		b.buildApplication()
+	}
+	if err := b.buildConfigGroup(); err != nil {
+		return nil, err
+	}
+	if err := b.buildComponent(); err != nil {
+		// the invalid fields are reported with their paths
+		if derr := b.options.diagnostics.Err(); derr != nil {
+			return nil, derr
+		}
+		return nil, err
+	}
+	if !b.kubernetes {
+		b.buildScope()
+	}
+	if err := b.buildIngress(); err != nil {
+		return nil, err
+	}
+	if err := b.buildStreamRoute(); err != nil {
+		return nil, err
+	}
+	if err := b.buildMonitor(); err != nil {
+		return nil, err
+	}
+	b.app.Diagnostics = b.options.diagnostics.Items()
+	return b.app, nil
 }
 
 func (b *builder) buildApplication() {
-	b.oamApp.Name = b.ram.AppName
+	b.app.AppConfiguration = &v1alpha2.ApplicationConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       v1alpha2.ApplicationConfigurationKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   appName(&b.ram),
+			Labels: map[string]string{},
+			Annotations: map[string]string{
+				"app.rainbond.io/name":    b.ram.AppName,
+				"app.rainbond.io/version": b.ram.AppVersion,
+			},
+		},
+		Spec: v1alpha2.ApplicationConfigurationSpec{
+			Components: []v1alpha2.ApplicationConfigurationComponent{},
+		},
+	}
 }
 
-func (b *builder) buildComponent() {
-	var components []v1alpha2.Component
-	var configurationComponents []v1alpha2.ApplicationConfigurationComponent
+func (b *builder) buildComponent() error {
+	used := make(map[string]string, len(b.ram.Components))
+	for _, rcom := range b.ram.Components {
+		name := componentName(rcom)
+		if other, ok := used[name]; ok {
+			return fmt.Errorf("component %s and %s have the same name %s", other, rcom.ServiceCname, name)
+		}
+		used[name] = rcom.ServiceCname
+		b.names[rcom.ServiceKey] = name
+	}
+	shared, err := b.buildShareVolume()
+	if err != nil {
+		return err
+	}
 	for i := range b.ram.Components {
 		rcom := b.ram.Components[i]
-		builder := NewWorkloadBuilder(*rcom, b.ram.Plugins)
-		cw := builder.Build()
+		deps, err := b.dependencyEnvs(rcom)
+		if err != nil {
+			return err
+		}
+		opts := append([]Option{
+			WithDependencyEnvs(deps...),
+			WithConfigGroups(b.ram.AppConfigGroups...),
+			WithSharedVolumes(shared[rcom.ServiceKey]...),
+		}, b.opts...)
+		opts = append(opts, WithDiagnostics(b.options.diagnostics.At(fmt.Sprintf("apps[%d]", i))))
+		if b.kubernetes {
+			if err := b.buildKubeWorkload(rcom, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		builder := NewWorkloadBuilder(*rcom, b.ram.Plugins, opts...)
+		cw, err := builder.Build()
+		if err != nil {
+			return fmt.Errorf("build workload of component %s failure %s", rcom.ServiceCname, err.Error())
+		}
+		b.addWorkloadDefinition(cw.Object)
+		for _, res := range builder.Resources() {
+			b.addResource(res)
+		}
+		if name := b.serviceName(rcom); name != b.names[rcom.ServiceKey] {
+			if svc := b.buildKubeService(rcom, name); svc != nil {
+				b.addResource(svc)
+			}
+		}
 		output := builder.Output()
 		component := v1alpha2.Component{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1alpha2.SchemeGroupVersion.String(),
+				Kind:       v1alpha2.ComponentKind,
+			},
 			ObjectMeta: metav1.ObjectMeta{
-				Name:        rcom.ServiceCname,
-				Labels:      map[string]string{},
-				Annotations: map[string]string{},
+				Name:   b.names[rcom.ServiceKey],
+				Labels: map[string]string{},
+				Annotations: map[string]string{
+					"app.rainbond.io/component-name": rcom.ServiceCname,
+					"app.rainbond.io/component-key":  rcom.ServiceKey,
+				},
 			},
 			Spec: v1alpha2.ComponentSpec{
 				Workload: cw,
 			},
 		}
-		components = append(components, component)
+		b.app.Components = append(b.app.Components, component)
 		var acc = v1alpha2.ApplicationConfigurationComponent{
 			ComponentName: component.GetName(),
 			DataOutputs:   output,
+			DataInputs:    builder.Input(),
 		}
-		// Handle dependencies between components
-		for _, dep := range rcom.DepServiceMapList {
-			for _, env := range b.getDepComponentConnectionInfo(dep.DepServiceKey) {
-				acc.DataInputs = append(acc.DataInputs, v1alpha2.DataInput{
-					ValueFrom: v1alpha2.DataInputValueFrom{
-						DataOutputName: env.AttrName,
-					},
-					//TODO:
-					ToFieldPaths: func() []string {
-						return []string{""}
-					}(),
-				})
+		if err := b.buildTrait(&acc, rcom, cw.Object, b.options.diagnostics.At(fmt.Sprintf("apps[%d]", i))); err != nil {
+			return err
+		}
+		b.app.AppConfiguration.Spec.Components = append(b.app.AppConfiguration.Spec.Components, acc)
+	}
+	return nil
+}
+
+// dependencyEnvs the connection envs of the components the component depends on
+func (b *builder) dependencyEnvs(com *v1alpha1.Component) ([]DependencyEnv, error) {
+	var envs []DependencyEnv
+	for _, dep := range com.DepServiceMapList {
+		depCom := b.getComponent(dep.DepServiceKey)
+		if depCom == nil {
+			return nil, fmt.Errorf("component %s depends on unknown component %s", com.ServiceCname, dep.DepServiceKey)
+		}
+		for _, env := range depCom.ServiceConnectInfoMapList {
+			dep := DependencyEnv{
+				OutputName: outputName(b.names[depCom.ServiceKey], env.AttrName),
+				Name:       env.AttrName,
+			}
+			// there is no data input without the oam runtime, the value is set directly
+			if b.kubernetes {
+				value := env.AttrValue
+				dep.Value = &value
 			}
+			envs = append(envs, dep)
 		}
-		configurationComponents = append(configurationComponents, acc)
 	}
-	b.oamApp.Spec.Components = configurationComponents
+	return envs, nil
 }
 
-func (b *builder) getDepComponentConnectionInfo(componentKey string) []v1alpha1.ComponentEnv {
+func (b *builder) getComponent(componentKey string) *v1alpha1.Component {
 	for _, com := range b.ram.Components {
 		if com.ServiceKey == componentKey {
-			return com.ServiceConnectInfoMapList
+			return com
 		}
 	}
 	return nil
 }
 
-func (b *builder) buildTrait() {
+// buildTrait the autoscaler scales the workload by the scale subresource, the containerized workload has
+// no scale subresource, so the manual scaler is kept instead of the autoscaler
+func (b *builder) buildTrait(acc *v1alpha2.ApplicationConfigurationComponent, com *v1alpha1.Component, workload runtime.Object, d *Diagnostics) error {
+	var autoscalerSkipped, manualScaler bool
+	for _, tb := range b.options.traitBuilders {
+		traits, err := tb.Build(com)
+		if err != nil {
+			return fmt.Errorf("build trait of component %s failure %s", com.ServiceCname, err.Error())
+		}
+		for _, trait := range traits {
+			switch trait.Object.(type) {
+			case *autoscaling.HorizontalPodAutoscaler:
+				if !scalable(workload) {
+					d.Warnf("extend_method_map.max_node", UnsupportedAutoscalerCode, "%s can not be autoscaled, the replicas are fixed, use the kubernetes builder to autoscale the component",
+						workload.GetObjectKind().GroupVersionKind().Kind)
+					autoscalerSkipped = true
+					continue
+				}
+			case *v1alpha2.ManualScalerTrait:
+				manualScaler = true
+			}
+			b.addTrait(acc, trait)
+		}
+	}
+	if autoscalerSkipped && !manualScaler {
+		traits, err := NewManualScalerTraitBuilder().Build(com)
+		if err != nil {
+			return fmt.Errorf("build trait of component %s failure %s", com.ServiceCname, err.Error())
+		}
+		for _, trait := range traits {
+			b.addTrait(acc, trait)
+		}
+	}
+	return nil
+}
 
+// scalable the workloads with the scale subresource
+func scalable(workload runtime.Object) bool {
+	gvk := workload.GetObjectKind().GroupVersionKind()
+	return gvk.Group == apps.GroupName && (gvk.Kind == "Deployment" || gvk.Kind == "StatefulSet")
+}
+
+func (b *builder) addTrait(acc *v1alpha2.ApplicationConfigurationComponent, trait Trait) {
+	acc.Traits = append(acc.Traits, v1alpha2.ComponentTrait{
+		Trait: runtime.RawExtension{Object: trait.Object},
+	})
+	b.app.Traits = append(b.app.Traits, trait.Object)
+	name := definitionName(trait.Object.GetObjectKind().GroupVersionKind())
+	b.addDefinition(&v1alpha2.TraitDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       v1alpha2.TraitDefinitionKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: v1alpha2.TraitDefinitionSpec{
+			Reference:       v1alpha2.DefinitionReference{Name: name},
+			WorkloadRefPath: trait.WorkloadRefPath,
+		},
+	})
+}
+
+// buildScope all components of the application share one health scope
+func (b *builder) buildScope() {
+	scope := &v1alpha2.HealthScope{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       v1alpha2.HealthScopeKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: b.app.AppConfiguration.GetName() + "-health",
+		},
+		Spec: v1alpha2.HealthScopeSpec{
+			WorkloadReferences: []runtimev1alpha1.TypedReference{},
+		},
+	}
+	for i := range b.app.AppConfiguration.Spec.Components {
+		acc := &b.app.AppConfiguration.Spec.Components[i]
+		acc.Scopes = append(acc.Scopes, v1alpha2.ComponentScope{
+			ScopeReference: runtimev1alpha1.TypedReference{
+				APIVersion: scope.APIVersion,
+				Kind:       scope.Kind,
+				Name:       scope.GetName(),
+			},
+		})
+	}
+	b.app.Scopes = append(b.app.Scopes, scope)
+	b.addDefinition(&v1alpha2.ScopeDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       v1alpha2.ScopeDefinitionKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: definitionName(v1alpha2.SchemeGroupVersion.WithKind(v1alpha2.HealthScopeKind)),
+		},
+		Spec: v1alpha2.ScopeDefinitionSpec{
+			Reference:        v1alpha2.DefinitionReference{Name: definitionName(v1alpha2.SchemeGroupVersion.WithKind(v1alpha2.HealthScopeKind))},
+			WorkloadRefsPath: "spec.workloadRefs",
+		},
+	})
+}
+
+// addResource add a resource if no resource with the same kind and name exists,
+// such as image pull secrets shared by components
+func (b *builder) addResource(res runtime.Object) {
+	if sameObjectExists(b.app.Resources, res) {
+		return
+	}
+	b.app.Resources = append(b.app.Resources, res)
+}
+
+func (b *builder) addWorkloadDefinition(obj runtime.Object) {
+	if obj == nil {
+		return
+	}
+	name := definitionName(obj.GetObjectKind().GroupVersionKind())
+	b.addDefinition(&v1alpha2.WorkloadDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha2.SchemeGroupVersion.String(),
+			Kind:       v1alpha2.WorkloadDefinitionKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: v1alpha2.WorkloadDefinitionSpec{
+			Reference: v1alpha2.DefinitionReference{Name: name},
+		},
+	})
+}
+
+// addDefinition add a definition if no definition with the same kind and name exists
+func (b *builder) addDefinition(def runtime.Object) {
+	if sameObjectExists(b.app.Definitions, def) {
+		return
+	}
+	b.app.Definitions = append(b.app.Definitions, def)
+}
+
+func sameObjectExists(objects []runtime.Object, obj runtime.Object) bool {
+	acc, ok := obj.(metav1.Object)
+	if !ok {
+		return false
+	}
+	for _, exist := range objects {
+		if exist.GetObjectKind().GroupVersionKind() != obj.GetObjectKind().GroupVersionKind() {
+			continue
+		}
+		if existAcc, ok := exist.(metav1.Object); ok && existAcc.GetName() == acc.GetName() {
+			return true
+		}
+	}
+	return false
+}
+
+// definitionName the definition name is the CRD name of the referenced kind, e.g. statefulsets.apps
+func definitionName(gvk schema.GroupVersionKind) string {
+	name := strings.ToLower(gvk.Kind) + "s"
+	if gvk.Group == "" {
+		return name
+	}
+	return name + "." + gvk.Group
 }
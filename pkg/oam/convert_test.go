@@ -0,0 +1,801 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newTestRAM() v1alpha1.RainbondApplicationConfig {
+	return v1alpha1.RainbondApplicationConfig{
+		AppKeyID:   "5d8a5fc1d2b44a4dbc8c6a1e0c9d5e11",
+		AppName:    "wordpress",
+		AppVersion: "1.0",
+		Components: []*v1alpha1.Component{
+			{
+				ServiceKey:   "a1b2c3d4e5f6",
+				ServiceCname: "MySQL",
+				ServiceAlias: "gr7c3d4e",
+				Image:        "mysql:5.7",
+				Memory:       512,
+				DeployType:   v1alpha1.StateSingletonDeployType,
+				Ports: []v1alpha1.ComponentPort{
+					{PortAlias: "MYSQL", Protocol: "mysql", ContainerPort: 3306, IsInner: true},
+				},
+				ServiceConnectInfoMapList: []v1alpha1.ComponentEnv{
+					{AttrName: "MYSQL_HOST", AttrValue: "127.0.0.1"},
+					{AttrName: "MYSQL_PORT", AttrValue: "3306"},
+				},
+				ExtendMethodRule: v1alpha1.ComponentExtendMethodRule{MinNode: 1, MaxNode: 1},
+			},
+			{
+				ServiceKey:   "f6e5d4c3b2a1",
+				ServiceCname: "WordPress",
+				ServiceAlias: "gr9a8b7c",
+				Image:        "wordpress:5",
+				Memory:       256,
+				DeployType:   v1alpha1.StatelessMultipleDeployType,
+				Ports: []v1alpha1.ComponentPort{
+					{PortAlias: "HTTP", Protocol: "http", ContainerPort: 80, IsOuter: true},
+				},
+				Envs: []v1alpha1.ComponentEnv{
+					{AttrName: "WORDPRESS_DB_NAME", AttrValue: "wordpress"},
+				},
+				DepServiceMapList: []v1alpha1.ComponentDep{{DepServiceKey: "a1b2c3d4e5f6"}},
+				ExtendMethodRule:  v1alpha1.ComponentExtendMethodRule{MinNode: 2, MaxNode: 4},
+			},
+		},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	app, err := NewBuilder(newTestRAM()).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.AppConfiguration.GetName() != "wordpress" {
+		t.Fatalf("app name is %s", app.AppConfiguration.GetName())
+	}
+	if len(app.Components) != 2 || len(app.AppConfiguration.Spec.Components) != 2 {
+		t.Fatalf("expect 2 components, got %d", len(app.Components))
+	}
+	for i, acc := range app.AppConfiguration.Spec.Components {
+		if acc.ComponentName != app.Components[i].GetName() {
+			t.Fatalf("component %s is not referenced", app.Components[i].GetName())
+		}
+		if len(acc.Scopes) != 1 {
+			t.Fatalf("component %s has no scope", acc.ComponentName)
+		}
+	}
+	if len(app.Scopes) != 1 {
+		t.Fatalf("expect 1 scope, got %d", len(app.Scopes))
+	}
+	for _, obj := range app.Objects() {
+		if obj.GetObjectKind().GroupVersionKind().Kind == "" {
+			t.Fatalf("object %T has no kind", obj)
+		}
+	}
+	var definitions []string
+	for _, def := range app.Definitions {
+		if wd, ok := def.(*v1alpha2.WorkloadDefinition); ok {
+			definitions = append(definitions, wd.GetName())
+		}
+	}
+	if len(definitions) != 2 || definitions[0] != "statefulsets.apps" || definitions[1] != "containerizedworkloads.core.oam.dev" {
+		t.Fatalf("unexpected workload definitions %v", definitions)
+	}
+}
+
+func TestBuildError(t *testing.T) {
+	if _, err := NewBuilder(v1alpha1.RainbondApplicationConfig{}).Build(); err == nil {
+		t.Fatal("expect error for template without components")
+	}
+	ram := newTestRAM()
+	ram.Components[1].DepServiceMapList = []v1alpha1.ComponentDep{{DepServiceKey: "unknown"}}
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for unknown dependency")
+	}
+	ram = newTestRAM()
+	ram.Components[1].ServiceAlias = ram.Components[0].ServiceAlias
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for duplicate component name")
+	}
+}
+
+func TestBuildImagePullSecret(t *testing.T) {
+	ram := newTestRAM()
+	hub := v1alpha1.ImageInfo{HubURL: "https://hub.example.com", HubUser: "admin", HubPassword: "secret"}
+	for _, com := range ram.Components {
+		com.AppImage = hub
+		com.Image = "hub.example.com/library/" + com.Image
+	}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secrets []*core.Secret
+	for _, res := range app.Resources {
+		if secret, ok := res.(*core.Secret); ok {
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(secrets) != 1 || secrets[0].Type != core.SecretTypeDockerConfigJson {
+		t.Fatalf("expect one shared docker config secret, got %d", len(secrets))
+	}
+	if !strings.Contains(string(secrets[0].Data[core.DockerConfigJsonKey]), `"hub.example.com"`) {
+		t.Fatalf("unexpected docker config %s", secrets[0].Data[core.DockerConfigJsonKey])
+	}
+	sts := app.Components[0].Spec.Workload.Object.(*apps.StatefulSet)
+	if len(sts.Spec.Template.Spec.ImagePullSecrets) != 1 || sts.Spec.Template.Spec.ImagePullSecrets[0].Name != secrets[0].Name {
+		t.Fatalf("statefulset does not reference the secret: %+v", sts.Spec.Template.Spec.ImagePullSecrets)
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	if secret := cw.Spec.Containers[0].ImagePullSecret; secret == nil || *secret != secrets[0].Name {
+		t.Fatalf("container does not reference the secret: %v", secret)
+	}
+}
+
+// resolveDataInputs fill the data inputs of the components like the oam runtime does
+func resolveDataInputs(t *testing.T, app *Application) []map[string]interface{} {
+	var workloads []map[string]interface{}
+	sources := map[string]interface{}{}
+	for i, acc := range app.AppConfiguration.Spec.Components {
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(app.Components[i].Spec.Workload.Object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		workloads = append(workloads, obj)
+		for _, out := range acc.DataOutputs {
+			value, err := fieldpath.Pave(obj).GetValue(out.FieldPath)
+			if err != nil {
+				t.Fatalf("data output %s: %v", out.Name, err)
+			}
+			sources[out.Name] = value
+		}
+	}
+	for i, acc := range app.AppConfiguration.Spec.Components {
+		paved := fieldpath.Pave(workloads[i])
+		for _, in := range acc.DataInputs {
+			value, ok := sources[in.ValueFrom.DataOutputName]
+			if !ok {
+				t.Fatalf("data output %s not exist", in.ValueFrom.DataOutputName)
+			}
+			for _, path := range in.ToFieldPaths {
+				if err := paved.SetValue(path, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	return workloads
+}
+
+func TestBuildDependencyEnv(t *testing.T) {
+	ram := newTestRAM()
+	ram.Plugins = []v1alpha1.Plugin{{PluginKey: "perf", PluginName: "perf-analyze", Image: "goodrain.me/tcm"}}
+	ram.Components[1].ServicePluginConfigs = []v1alpha1.ComponentPluginConfig{{PluginKey: "perf"}}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(app.AppConfiguration.Spec.Components[0].DataInputs) != 0 {
+		t.Fatal("mysql does not depend on any component")
+	}
+	workloads := resolveDataInputs(t, app)
+	var cw v1alpha2.ContainerizedWorkload
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(workloads[1], &cw); err != nil {
+		t.Fatal(err)
+	}
+	if len(cw.Spec.Containers) != 2 {
+		t.Fatalf("expect 2 containers, got %d", len(cw.Spec.Containers))
+	}
+	for _, container := range cw.Spec.Containers {
+		envs := map[string]string{}
+		for _, env := range container.Environment {
+			if env.Value != nil {
+				envs[env.Name] = *env.Value
+			}
+		}
+		if envs["MYSQL_HOST"] != "127.0.0.1" || envs["MYSQL_PORT"] != "3306" {
+			t.Fatalf("container %s does not receive the mysql connection envs: %v", container.Name, envs)
+		}
+	}
+}
+
+func TestBuildPluginContainer(t *testing.T) {
+	ram := newTestRAM()
+	ram.Plugins = []v1alpha1.Plugin{{
+		PluginKey:  "log",
+		PluginName: "Log Collector",
+		Image:      "goodrain.me/logtail",
+		ConfigGroups: []v1alpha1.PluginConfigGroup{
+			{ServiceMetaType: v1alpha1.UnDefineMetaType, Injection: v1alpha1.EnvPluginInjection, Options: []v1alpha1.PluginConfigGroupOption{
+				{AttrName: "LOG_PATH", AttrDefaultValue: "/var/log"},
+				{AttrName: "LOG_LEVEL", AttrDefaultValue: "info"},
+			}},
+			{ServiceMetaType: v1alpha1.UpstreamPortMetaType, Injection: v1alpha1.EnvPluginInjection, Options: []v1alpha1.PluginConfigGroupOption{
+				{AttrName: "LIMIT", AttrDefaultValue: "100", Protocol: "http"},
+				{AttrName: "TIMEOUT", AttrDefaultValue: "3", Protocol: "mysql"},
+			}},
+			{ServiceMetaType: v1alpha1.DownstreamPortMetaType, Injection: v1alpha1.EnvPluginInjection, Options: []v1alpha1.PluginConfigGroupOption{
+				{AttrName: "RETRY", AttrDefaultValue: "1"},
+			}},
+			{ServiceMetaType: v1alpha1.UnDefineMetaType, Injection: v1alpha1.AutoPluginInjection, Options: []v1alpha1.PluginConfigGroupOption{
+				{AttrName: "DISCOVERED", AttrDefaultValue: "x"},
+			}},
+		},
+	}}
+	ram.Components[1].Cmd = "apache2-foreground"
+	ram.Components[1].ServiceVolumeMapList = v1alpha1.ComponentVolumeList{
+		{VolumeName: "logs", VolumeMountPath: "/data/logs", VolumeType: v1alpha1.ShareFileVolumeType},
+		{VolumeName: "html", VolumeMountPath: "/var/www/html", VolumeType: v1alpha1.ShareFileVolumeType},
+	}
+	ram.Components[1].ServicePluginConfigs = []v1alpha1.ComponentPluginConfig{{
+		PluginKey: "log",
+		Attr: []map[string]interface{}{
+			{"service_meta_type": "un_define", "attrs": `{"LOG_PATH":"/data/logs/access"}`},
+			{"service_meta_type": "upstream_port", "container_port": float64(80), "attrs": map[string]interface{}{"LIMIT": "200"}},
+			{"service_meta_type": "downstream_port", "dest_service_alias": "gr7c3d4e", "container_port": float64(3306), "protocol": "mysql", "attrs": map[string]interface{}{"RETRY": float64(5)}},
+		},
+	}}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	if len(cw.Spec.Containers) != 2 {
+		t.Fatalf("expect 2 containers, got %d", len(cw.Spec.Containers))
+	}
+	sidecar := cw.Spec.Containers[1]
+	if sidecar.Name != "logcollector" || sidecar.Image != "goodrain.me/logtail" || len(sidecar.Command) != 0 {
+		t.Fatalf("unexpected sidecar %s %s %v", sidecar.Name, sidecar.Image, sidecar.Command)
+	}
+	envs := map[string]string{}
+	for _, env := range sidecar.Environment {
+		if env.Value != nil {
+			envs[env.Name] = *env.Value
+		}
+	}
+	expect := map[string]string{
+		"LOG_PATH":            "/data/logs/access",
+		"LOG_LEVEL":           "info",
+		"LIMIT_80":            "200",
+		"RETRY_GR7C3D4E_3306": "5",
+	}
+	for name, value := range expect {
+		if envs[name] != value {
+			t.Fatalf("expect env %s=%s, got %v", name, value, envs)
+		}
+	}
+	for _, name := range []string{"WORDPRESS_DB_NAME", "TIMEOUT_80", "DISCOVERED"} {
+		if _, ok := envs[name]; ok {
+			t.Fatalf("unexpected env %s", name)
+		}
+	}
+	if volumes := sidecar.Resources.Volumes; len(volumes) != 1 || volumes[0].Name != "logs" {
+		t.Fatalf("the sidecar should only mount the logs volume: %+v", volumes)
+	}
+}
+
+func TestBuildCommand(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[1].Probes = []v1alpha1.ComponentProbe{
+		{Mode: "readiness", Cmd: `test -f  "/var/www/html/wp config.php"`, IsUsed: true},
+	}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	main := cw.Spec.Containers[0]
+	if main.Command != nil || main.Arguments != nil {
+		t.Fatalf("empty cmd must keep the image entrypoint: %q %q", main.Command, main.Arguments)
+	}
+	if cmd := main.ReadinessProbe.Exec.Command; len(cmd) != 3 || cmd[2] != "/var/www/html/wp config.php" {
+		t.Fatalf("unexpected probe command %q", cmd)
+	}
+
+	ram.Components[1].Cmd = `apache2-foreground -D "SERVER NAME=$HOSTNAME" '$(literal)'`
+	ram.Components[1].Probes[0].Cmd = "check --port $PORT"
+	app, err = NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw = app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	main = cw.Spec.Containers[0]
+	expect := []string{"apache2-foreground", "-D", "SERVER NAME=$(HOSTNAME)", "$$(literal)"}
+	if main.Command != nil || strings.Join(main.Arguments, "|") != strings.Join(expect, "|") {
+		t.Fatalf("unexpected command %q args %q", main.Command, main.Arguments)
+	}
+	if cmd := main.ReadinessProbe.Exec.Command; strings.Join(cmd, "|") != "/bin/sh|-c|check --port $PORT" {
+		t.Fatalf("unexpected probe command %q", cmd)
+	}
+
+	ram.Components[1].Cmd = `echo "unterminated`
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for unterminated quote")
+	}
+}
+
+func TestBuildTrait(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[0].DeployType = v1alpha1.StateMultipleDeployType
+	ram.Components[0].ExtendMethodRule = v1alpha1.ComponentExtendMethodRule{MinNode: 1, MaxNode: 3}
+	app, err := NewBuilder(ram, WithAutoscaler(80)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mysql, wordpress := app.AppConfiguration.Spec.Components[0], app.AppConfiguration.Spec.Components[1]
+	if len(mysql.Traits) != 1 || len(wordpress.Traits) != 1 {
+		t.Fatalf("unexpected traits %d %d", len(mysql.Traits), len(wordpress.Traits))
+	}
+	// the autoscaled statefulset has no manual scaler, the controllers would fight over the replicas
+	hpa, ok := mysql.Traits[0].Trait.Object.(*autoscaling.HorizontalPodAutoscaler)
+	if !ok {
+		t.Fatalf("expect only the autoscaler, got %T", mysql.Traits[0].Trait.Object)
+	}
+	if *hpa.Spec.MinReplicas != 1 || hpa.Spec.MaxReplicas != 3 {
+		t.Fatalf("unexpected autoscaler bounds %+v", hpa.Spec)
+	}
+	// the containerized workload has no scale subresource, the replicas are fixed by the manual scaler
+	if scaler, ok := wordpress.Traits[0].Trait.Object.(*v1alpha2.ManualScalerTrait); !ok || scaler.Spec.ReplicaCount != 2 {
+		t.Fatalf("expect the manual scaler of the containerized workload, got %+v", wordpress.Traits[0].Trait.Object)
+	}
+	var diagnosed bool
+	for _, d := range app.Diagnostics {
+		diagnosed = diagnosed || (d.Code == UnsupportedAutoscalerCode && d.Path == "apps[1].extend_method_map.max_node")
+	}
+	if !diagnosed {
+		t.Fatalf("the skipped autoscaler is not diagnosed %v", app.Diagnostics)
+	}
+	var definitions []string
+	for _, def := range app.Definitions {
+		if td, ok := def.(*v1alpha2.TraitDefinition); ok {
+			definitions = append(definitions, td.GetName()+":"+td.Spec.WorkloadRefPath)
+		}
+	}
+	if strings.Join(definitions, ",") != "horizontalpodautoscalers.autoscaling:spec.scaleTargetRef,manualscalertraits.core.oam.dev:spec.workloadRef" {
+		t.Fatalf("unexpected trait definitions %v", definitions)
+	}
+
+	app, err = NewBuilder(newTestRAM()).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wordpress = app.AppConfiguration.Spec.Components[1]
+	if scaler, ok := wordpress.Traits[0].Trait.Object.(*v1alpha2.ManualScalerTrait); len(wordpress.Traits) != 1 || !ok || scaler.Spec.ReplicaCount != 2 {
+		t.Fatalf("expect the manual scaler of 2 replicas without autoscaler, got %+v", wordpress.Traits)
+	}
+
+	ram = newTestRAM()
+	ram.Components[1].ExtendMethodRule.MaxNode = v1alpha1.DefaultExtendMethodRule().MaxNode + 1
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for max node out of range")
+	}
+}
+
+func TestBuildIngress(t *testing.T) {
+	ram := newTestRAM()
+	ram.IngressHTTPRoutes = []v1alpha1.IngressHTTPRoute{{
+		DefaultDomain:        true,
+		Location:             "/blog",
+		SSL:                  true,
+		ResponseTimeout:      120,
+		RequestBodySizeLimit: 10,
+		Websocket:            true,
+		ProxyHeader:          map[string]string{"X-Forwarded-Proto": "https"},
+		TargetComponent:      v1alpha1.TargetComponent{ComponentKey: "f6e5d4c3b2a1", Port: 80},
+	}}
+	app, err := NewBuilder(ram, WithIngressDomain("apps.example.com")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ing *networking.Ingress
+	for _, res := range app.Resources {
+		if i, ok := res.(*networking.Ingress); ok {
+			ing = i
+		}
+	}
+	if ing == nil {
+		t.Fatal("no ingress created")
+	}
+	rule := ing.Spec.Rules[0]
+	if rule.Host != "80.gr9a8b7c.apps.example.com" || rule.HTTP.Paths[0].Path != "/blog" {
+		t.Fatalf("unexpected rule %+v", rule)
+	}
+	if backend := rule.HTTP.Paths[0].Backend.Service; backend.Name != "gr9a8b7c-clusterip" || backend.Port.Number != 80 {
+		t.Fatalf("unexpected backend %+v", backend)
+	}
+	if len(ing.Spec.TLS) != 1 {
+		t.Fatal("ssl route has no tls")
+	}
+	expect := map[string]string{
+		"nginx.ingress.kubernetes.io/proxy-read-timeout":    "120",
+		"nginx.ingress.kubernetes.io/proxy-send-timeout":    "3600",
+		"nginx.ingress.kubernetes.io/proxy-body-size":       "10m",
+		"nginx.ingress.kubernetes.io/configuration-snippet": `proxy_set_header X-Forwarded-Proto "https";`,
+	}
+	for k, v := range expect {
+		if ing.Annotations[k] != v {
+			t.Fatalf("annotation %s is %q, expect %q", k, ing.Annotations[k], v)
+		}
+	}
+
+	ram.IngressHTTPRoutes[0].Port = 8080
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for undefined port")
+	}
+}
+
+func TestBuildIngressSecondPort(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[1].Ports = append(ram.Components[1].Ports, v1alpha1.ComponentPort{PortAlias: "ADMIN", Protocol: "http", ContainerPort: 8080, IsOuter: true})
+	ram.IngressHTTPRoutes = []v1alpha1.IngressHTTPRoute{{
+		Location:        "/admin",
+		TargetComponent: v1alpha1.TargetComponent{ComponentKey: "f6e5d4c3b2a1", Port: 8080},
+	}}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var backend *networking.IngressServiceBackend
+	services := map[string]*core.Service{}
+	for _, res := range app.Resources {
+		switch obj := res.(type) {
+		case *networking.Ingress:
+			backend = obj.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+		case *core.Service:
+			services[obj.GetName()] = obj
+		}
+	}
+	if backend == nil {
+		t.Fatal("no ingress created")
+	}
+	svc := services[backend.Name]
+	if svc == nil {
+		t.Fatalf("the backend service %s is not created", backend.Name)
+	}
+	if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].Port != backend.Port.Number {
+		t.Fatalf("the backend service %s does not expose port %d: %+v", backend.Name, backend.Port.Number, svc.Spec.Ports)
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	for k, v := range svc.Spec.Selector {
+		if cw.GetLabels()[k] != v {
+			t.Fatalf("selector %v does not match the pods labelled %v", svc.Spec.Selector, cw.GetLabels())
+		}
+	}
+}
+
+func TestBuildStreamRoute(t *testing.T) {
+	ram := newTestRAM()
+	ram.IngressSreamRoutes = []v1alpha1.IngressStreamRoute{
+		{Protocol: "tcp", ConnectionTimeout: 60, TargetComponent: v1alpha1.TargetComponent{ComponentKey: "a1b2c3d4e5f6", Port: 3306}},
+	}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var services []*core.Service
+	for _, res := range app.Resources {
+		if svc, ok := res.(*core.Service); ok && svc.Spec.Type == core.ServiceTypeLoadBalancer {
+			services = append(services, svc)
+		}
+	}
+	if len(services) != 1 || services[0].Spec.Ports[0].Port != 3306 || services[0].Spec.Ports[0].Protocol != core.ProtocolTCP {
+		t.Fatalf("unexpected load balancer services %+v", services)
+	}
+
+	app, err = NewBuilder(ram, WithStreamRouteMode(NginxConfigMapStreamRoute), WithNamespace("wp")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, res := range app.Resources {
+		if cm, ok := res.(*core.ConfigMap); ok && cm.GetName() == "tcp-services" {
+			found = cm.Data["3306"] == "wp/gr7c3d4e:3306"
+		}
+	}
+	if !found {
+		t.Fatal("no tcp services configmap")
+	}
+
+	ram.IngressSreamRoutes = append(ram.IngressSreamRoutes, ram.IngressSreamRoutes[0])
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for conflicting external ports")
+	}
+}
+
+func TestBuildStatelessStreamRoute(t *testing.T) {
+	ram := newTestRAM()
+	ram.IngressSreamRoutes = []v1alpha1.IngressStreamRoute{
+		{Protocol: "tcp", TargetComponent: v1alpha1.TargetComponent{ComponentKey: "f6e5d4c3b2a1", Port: 80}},
+	}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var selector map[string]string
+	for _, res := range app.Resources {
+		if svc, ok := res.(*core.Service); ok && svc.Spec.Type == core.ServiceTypeLoadBalancer {
+			selector = svc.Spec.Selector
+		}
+	}
+	if selector == nil {
+		t.Fatal("no load balancer service")
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	for k, v := range selector {
+		if cw.GetLabels()[k] != v {
+			t.Fatalf("selector %v does not match the pods labelled %v", selector, cw.GetLabels())
+		}
+	}
+}
+
+func TestBuildConfigGroup(t *testing.T) {
+	ram := newTestRAM()
+	ram.AppConfigGroups = []v1alpha1.AppConfigGroup{
+		{Name: "db", InjectionType: "env", ConfigItems: map[string]string{"DB_USER": "root"}, ComponentKeys: []string{"a1b2c3d4e5f6", "f6e5d4c3b2a1"}},
+		{Name: "nginx", InjectionType: "file", ConfigItems: map[string]string{"default.conf": "server {}"}, ComponentKeys: []string{"a1b2c3d4e5f6", "f6e5d4c3b2a1"}},
+	}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var configMaps []string
+	for _, res := range app.Resources {
+		if cm, ok := res.(*core.ConfigMap); ok {
+			configMaps = append(configMaps, cm.GetName())
+		}
+	}
+	if !strings.Contains(strings.Join(configMaps, ","), "config-group-db,config-group-nginx") {
+		t.Fatalf("unexpected configmaps %v", configMaps)
+	}
+	sts := app.Components[0].Spec.Workload.Object.(*apps.StatefulSet)
+	main := sts.Spec.Template.Spec.Containers[0]
+	var envFromConfigMap, mounted bool
+	for _, env := range main.Env {
+		envFromConfigMap = envFromConfigMap || (env.Name == "DB_USER" && env.ValueFrom.ConfigMapKeyRef.Name == "config-group-db")
+	}
+	for _, mount := range main.VolumeMounts {
+		mounted = mounted || (mount.Name == "config-group-nginx" && mount.MountPath == "/etc/config/nginx")
+	}
+	if !envFromConfigMap || !mounted {
+		t.Fatalf("config groups are not injected into the statefulset: %+v", main)
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	container := cw.Spec.Containers[0]
+	if len(container.ConfigFiles) != 1 || container.ConfigFiles[0].Path != "/etc/config/nginx/default.conf" {
+		t.Fatalf("unexpected config files %+v", container.ConfigFiles)
+	}
+
+	ram.AppConfigGroups[0].ConfigItems["WORDPRESS_DB_NAME"] = "wp"
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for env collision")
+	}
+	ram.AppConfigGroups[0].ConfigItems = map[string]string{"DB_USER": "root"}
+	ram.AppConfigGroups[0].ComponentKeys = []string{"unknown"}
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for unknown component key")
+	}
+}
+
+func TestBuildShareVolume(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[0].ServiceShareID = "mysql-share-id"
+	ram.Components[0].ServiceVolumeMapList = v1alpha1.ComponentVolumeList{
+		{VolumeName: "backup", VolumeMountPath: "/backup", VolumeType: v1alpha1.ShareFileVolumeType, VolumeCapacity: 5},
+		{VolumeName: "data", VolumeMountPath: "/var/lib/mysql", VolumeType: v1alpha1.LocalVolumeType},
+		{VolumeName: "tmp", VolumeMountPath: "/tmp", VolumeType: v1alpha1.MemoryFSVolumeType},
+	}
+	ram.Components[1].MntReleationList = []v1alpha1.ComponentShareVolume{
+		{VolumeName: "backup", VolumeMountDir: "/mnt/backup", ShareServiceUUID: "mysql-share-id"},
+	}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claim *core.PersistentVolumeClaim
+	for _, res := range app.Resources {
+		if c, ok := res.(*core.PersistentVolumeClaim); ok {
+			claim = c
+		}
+	}
+	if claim == nil || claim.GetName() != "gr7c3d4e-backup" || claim.Spec.AccessModes[0] != core.ReadWriteMany {
+		t.Fatalf("unexpected shared claim %+v", claim)
+	}
+	sts := app.Components[0].Spec.Workload.Object.(*apps.StatefulSet)
+	if len(sts.Spec.VolumeClaimTemplates) != 1 || sts.Spec.VolumeClaimTemplates[0].GetName() != "data" {
+		t.Fatalf("the shared volume must not be a claim template: %+v", sts.Spec.VolumeClaimTemplates)
+	}
+	var ownerMounted bool
+	for _, v := range sts.Spec.Template.Spec.Volumes {
+		ownerMounted = ownerMounted || (v.PersistentVolumeClaim != nil && v.PersistentVolumeClaim.ClaimName == claim.GetName())
+	}
+	if !ownerMounted {
+		t.Fatal("the owner does not mount the shared claim")
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	volumes := cw.Spec.Containers[0].Resources.Volumes
+	if len(volumes) != 1 || volumes[0].Name != claim.GetName() || volumes[0].MountPath != "/mnt/backup" {
+		t.Fatalf("unexpected volumes %+v", volumes)
+	}
+
+	for _, name := range []string{"data", "tmp", "unknown"} {
+		ram.Components[1].MntReleationList[0].VolumeName = name
+		if _, err := NewBuilder(ram).Build(); err == nil {
+			t.Fatalf("expect error for sharing volume %s", name)
+		}
+	}
+}
+
+func TestBuildMonitor(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[0].ComponentMonitor = []v1alpha1.ComponentMonitor{{Name: "mysqld", Port: 3306, Path: "/metrics", Interval: "30s"}}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var monitors, services int
+	for _, res := range app.Resources {
+		switch obj := res.(type) {
+		case *unstructured.Unstructured:
+			if obj.GetKind() == "ServiceMonitor" && obj.GetName() == "gr7c3d4e-mysqld" {
+				monitors++
+			}
+		case *core.Service:
+			if obj.GetName() == "gr7c3d4e-metrics" && obj.Spec.Ports[0].Name == "metrics-3306" {
+				services++
+			}
+		}
+	}
+	if monitors != 1 || services != 1 {
+		t.Fatalf("expect one service monitor and one metrics service, got %d %d", monitors, services)
+	}
+
+	app, err = NewBuilder(ram, WithMonitorMode(ScrapeConfigMode)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scrape string
+	for _, res := range app.Resources {
+		if cm, ok := res.(*core.ConfigMap); ok && cm.GetName() == "wordpress-scrape-configs" {
+			scrape = cm.Data[ScrapeConfigKey]
+		}
+	}
+	if !strings.Contains(scrape, "job_name: gr7c3d4e-mysqld") || !strings.Contains(scrape, "scrape_interval: 30s") {
+		t.Fatalf("unexpected scrape configs %s", scrape)
+	}
+
+	ram.Components[0].ComponentMonitor[0].Interval = "30 seconds"
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for invalid interval")
+	}
+	ram.Components[0].ComponentMonitor[0].Interval = "30s"
+	ram.Components[0].ComponentMonitor[0].Port = 9104
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for undefined port")
+	}
+}
+
+func TestBuildStatelessMonitor(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[1].ComponentMonitor = []v1alpha1.ComponentMonitor{{Name: "wordpress", Port: 80, Path: "/metrics"}}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var svc *core.Service
+	for _, res := range app.Resources {
+		if s, ok := res.(*core.Service); ok && s.GetName() == "gr9a8b7c-metrics" {
+			svc = s
+		}
+	}
+	if svc == nil {
+		t.Fatal("no metrics service")
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	for k, v := range svc.Spec.Selector {
+		if cw.GetLabels()[k] != v {
+			t.Fatalf("selector %v does not match the pods labelled %v", svc.Spec.Selector, cw.GetLabels())
+		}
+	}
+}
+
+func TestBuildMonitorsOfComponents(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[0].ComponentMonitor = []v1alpha1.ComponentMonitor{{Name: "metrics", Port: 3306}}
+	ram.Components[1].ComponentMonitor = []v1alpha1.ComponentMonitor{{Name: "metrics", Port: 80}}
+	for _, mode := range []MonitorMode{ServiceMonitorMode, ScrapeConfigMode} {
+		app, err := NewBuilder(ram, WithMonitorMode(mode)).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := map[string]bool{}
+		for _, res := range app.Resources {
+			switch obj := res.(type) {
+			case *unstructured.Unstructured:
+				if obj.GetKind() == "ServiceMonitor" {
+					names[obj.GetName()] = true
+				}
+			case *core.ConfigMap:
+				for _, job := range []string{"gr7c3d4e-metrics", "gr9a8b7c-metrics"} {
+					if strings.Contains(obj.Data[ScrapeConfigKey], "job_name: "+job+"\n") {
+						names[job] = true
+					}
+				}
+			}
+		}
+		if len(names) != 2 || !names["gr7c3d4e-metrics"] || !names["gr9a8b7c-metrics"] {
+			t.Fatalf("%s: expect the monitors of both components, got %v", mode, names)
+		}
+	}
+
+	ram.Components[1].ComponentMonitor = append(ram.Components[1].ComponentMonitor, v1alpha1.ComponentMonitor{Name: "Metrics", Port: 80})
+	if _, err := NewBuilder(ram).Build(); err == nil {
+		t.Fatal("expect error for the monitors with the same name")
+	}
+}
+
+func TestBuildIngressSnippet(t *testing.T) {
+	ram := newTestRAM()
+	ram.IngressHTTPRoutes = []v1alpha1.IngressHTTPRoute{{
+		Headers:         map[string]string{"X-Env": `a"b\$c`, "x;} location / { deny all; }#": "v"},
+		Cookies:         map[string]string{"session": "1.0", "s; }": "v"},
+		ProxyHeader:     map[string]string{"X-Forwarded-Proto": "https", "X-Real-IP": "$remote_addr", "X-Bad name": "v"},
+		TargetComponent: v1alpha1.TargetComponent{ComponentKey: "f6e5d4c3b2a1", Port: 80},
+	}}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snippet string
+	for _, res := range app.Resources {
+		if ing, ok := res.(*networking.Ingress); ok {
+			snippet = ing.Annotations["nginx.ingress.kubernetes.io/configuration-snippet"]
+		}
+	}
+	expect := strings.Join([]string{
+		`if ($http_x_env !~ "^a\"b\\\\\\$c$") { return 404; }`,
+		`if ($cookie_session !~ "^1\\.0$") { return 404; }`,
+		`proxy_set_header X-Forwarded-Proto "https";`,
+	}, "\n")
+	if snippet != expect {
+		t.Fatalf("unexpected snippet\n%s\nexpect\n%s", snippet, expect)
+	}
+	var diagnosed int
+	for _, d := range app.Diagnostics {
+		if d.Code == InvalidHeaderCode && strings.HasPrefix(d.Path, "ingress_http_routes[0].") {
+			diagnosed++
+		}
+	}
+	if diagnosed != 4 {
+		t.Fatalf("expect 4 skipped entries diagnosed, got %v", app.Diagnostics)
+	}
+}
@@ -0,0 +1,90 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	v1alpha1 "github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// deploymentWorkloadBuilder build the stateless component as a deployment, the pod template is built
+// by the statefulWorkloadBuilder so that the containers of both workloads never drift
+type deploymentWorkloadBuilder struct {
+	statefulWorkloadBuilder
+}
+
+func newDeploymentWorkloadBuilder(com v1alpha1.Component, plugins []v1alpha1.Plugin, opts ...Option) *deploymentWorkloadBuilder {
+	return &deploymentWorkloadBuilder{
+		statefulWorkloadBuilder: statefulWorkloadBuilder{
+			com:              com,
+			plugins:          plugins,
+			options:          newOptions(opts),
+			standaloneClaims: true,
+		},
+	}
+}
+
+func (d *deploymentWorkloadBuilder) Build() (runtime.RawExtension, error) {
+	d.output = nil
+	d.input = nil
+	d.resources = nil
+	d.claims = nil
+	if d.options == nil {
+		d.options = newOptions(nil)
+	}
+	if err := diagnoseComponent(&d.com, d.plugins, d.options.diagnostics); err != nil {
+		return runtime.RawExtension{}, err
+	}
+	replicas, err := componentReplicas(&d.com)
+	if err != nil {
+		return runtime.RawExtension{}, err
+	}
+	template, err := d.buildPodTemplate()
+	if err != nil {
+		return runtime.RawExtension{}, err
+	}
+	var deployment = &apps.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apps.SchemeGroupVersion.String(),
+			Kind:       "Deployment",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        componentName(&d.com),
+			Labels:      d.podLabels(),
+			Annotations: map[string]string{},
+		},
+		Spec: apps.DeploymentSpec{
+			Replicas: &replicas,
+			Template: template,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: d.podLabels(),
+			},
+			Strategy: apps.DeploymentStrategy{
+				Type: apps.RollingUpdateDeploymentStrategyType,
+			},
+		},
+	}
+	return runtime.RawExtension{Object: deployment}, nil
+}
+
+func (d *deploymentWorkloadBuilder) Kind() string {
+	return "DeploymentWorkload"
+}
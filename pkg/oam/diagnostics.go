@@ -0,0 +1,262 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+//DiagnosticSeverity the severity of the diagnostic
+type DiagnosticSeverity string
+
+//ErrorSeverity the field can not be converted, the conversion fails
+var ErrorSeverity DiagnosticSeverity = "error"
+
+//WarningSeverity the field is converted with the default value
+var WarningSeverity DiagnosticSeverity = "warning"
+
+//DiagnosticCode identify the kind of the diagnostic
+type DiagnosticCode string
+
+//InvalidQuantityCode the memory, cpu or capacity is invalid
+var InvalidQuantityCode DiagnosticCode = "invalid_quantity"
+
+//InvalidVolumeNameCode the volume name can not be the name of the pod volume
+var InvalidVolumeNameCode DiagnosticCode = "invalid_volume_name"
+
+//UnknownDeployTypeCode the deploy type is unknown, the component is deployed as stateless
+var UnknownDeployTypeCode DiagnosticCode = "unknown_deploy_type"
+
+//UnknownProtocolCode the protocol is unknown, the port uses tcp
+var UnknownProtocolCode DiagnosticCode = "unknown_protocol"
+
+//UnknownSharingPolicyCode the sharing policy is unknown, the volume is shared
+var UnknownSharingPolicyCode DiagnosticCode = "unknown_sharing_policy"
+
+//UnknownAccessModeCode the access mode is unknown, the access mode of the volume type is used
+var UnknownAccessModeCode DiagnosticCode = "unknown_access_mode"
+
+//UnknownVolumeTypeCode the volume type is unknown, the volume is claimed with the storage class of the resolver
+var UnknownVolumeTypeCode DiagnosticCode = "unknown_volume_type"
+
+//UnsupportedAutoscalerCode the workload can not be autoscaled, the manual scaler is used
+var UnsupportedAutoscalerCode DiagnosticCode = "unsupported_autoscaler"
+
+//UnsupportedInitPluginCode the init plugin of the containerized workload is not run
+var UnsupportedInitPluginCode DiagnosticCode = "unsupported_init_plugin"
+
+//InvalidHeaderCode the header, the cookie or the proxy header of the http route can not be written into the nginx snippet, it is skipped
+var InvalidHeaderCode DiagnosticCode = "invalid_header"
+
+//UnknownPluginCode the plugin config refers to unknown plugin, the plugin is not run
+var UnknownPluginCode DiagnosticCode = "unknown_plugin"
+
+// the protocols of the component ports, the application protocols are served by tcp
+var knownProtocols = map[string]bool{"": true, "tcp": true, "udp": true, "http": true, "https": true, "grpc": true, "mysql": true}
+
+//Diagnostic a field of the rainbond application config that is degraded or can not be converted, the path
+//points at the field in the json of the config, such as apps[3].port_map_list[1].protocol
+type Diagnostic struct {
+	Severity DiagnosticSeverity `json:"severity"`
+	Code     DiagnosticCode     `json:"code"`
+	Path     string             `json:"path"`
+	Message  string             `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s)", d.Severity, d.Path, d.Message, d.Code)
+}
+
+//Diagnostics collect the diagnostics of the conversion. The collector returned by At shares the
+//diagnostics and prefixes the paths, the methods of nil collector do nothing.
+type Diagnostics struct {
+	items  *[]Diagnostic
+	prefix string
+}
+
+//NewDiagnostics new diagnostics collector
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{items: &[]Diagnostic{}}
+}
+
+//At the collector of the field, such as apps[3] or port_map_list[1]
+func (d *Diagnostics) At(path string) *Diagnostics {
+	if d == nil {
+		return nil
+	}
+	return &Diagnostics{items: d.items, prefix: joinPath(d.prefix, path)}
+}
+
+func joinPath(prefix, path string) string {
+	switch {
+	case prefix == "":
+		return path
+	case path == "":
+		return prefix
+	case strings.HasPrefix(path, "["):
+		return prefix + path
+	default:
+		return prefix + "." + path
+	}
+}
+
+func (d *Diagnostics) add(severity DiagnosticSeverity, path string, code DiagnosticCode, format string, args ...interface{}) {
+	if d == nil {
+		return
+	}
+	*d.items = append(*d.items, Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Path:     joinPath(d.prefix, path),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+//Warnf record the field converted with the default value
+func (d *Diagnostics) Warnf(path string, code DiagnosticCode, format string, args ...interface{}) {
+	d.add(WarningSeverity, path, code, format, args...)
+}
+
+//Errorf record the field can not be converted
+func (d *Diagnostics) Errorf(path string, code DiagnosticCode, format string, args ...interface{}) {
+	d.add(ErrorSeverity, path, code, format, args...)
+}
+
+//Items all the diagnostics in the order they are recorded
+func (d *Diagnostics) Items() []Diagnostic {
+	if d == nil {
+		return nil
+	}
+	return append([]Diagnostic(nil), *d.items...)
+}
+
+//HasErrors whether any error is recorded
+func (d *Diagnostics) HasErrors() bool {
+	if d == nil {
+		return false
+	}
+	for _, item := range *d.items {
+		if item.Severity == ErrorSeverity {
+			return true
+		}
+	}
+	return false
+}
+
+//Err return the DiagnosticsError holds all the diagnostics if any error is recorded
+func (d *Diagnostics) Err() error {
+	if !d.HasErrors() {
+		return nil
+	}
+	return &DiagnosticsError{Diagnostics: d.Items()}
+}
+
+//DiagnosticsError the conversion fails for the errors in the diagnostics
+type DiagnosticsError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *DiagnosticsError) Error() string {
+	var errs []string
+	for _, d := range e.Diagnostics {
+		if d.Severity == ErrorSeverity {
+			errs = append(errs, fmt.Sprintf("%s: %s", d.Path, d.Message))
+		}
+	}
+	return strings.Join(errs, "; ")
+}
+
+// diagnoseComponent record the fields of the component the workload builders convert with the default
+// values, the paths are relative to the component. The invalid fields are returned as error.
+func diagnoseComponent(com *v1alpha1.Component, plugins []v1alpha1.Plugin, d *Diagnostics) error {
+	var errs []string
+	switch com.DeployType {
+	case v1alpha1.StateMultipleDeployType, v1alpha1.StateSingletonDeployType, v1alpha1.StatelessMultipleDeployType, v1alpha1.StatelessSingletionDeployType:
+	default:
+		d.Warnf("extend_method", UnknownDeployTypeCode, "unknown deploy type %q, the component is deployed as %s", com.DeployType, v1alpha1.StatelessMultipleDeployType)
+	}
+	diagnoseQuantity := func(path string, value int, parse func(int) (resource.Quantity, error)) {
+		if _, err := parse(value); err != nil {
+			d.Errorf(path, InvalidQuantityCode, "%v", err)
+			errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	diagnoseQuantity("memory", com.Memory, ParseMemoryQuantity)
+	diagnoseQuantity("cpu", com.CPU, ParseCPUQuantity)
+	for i, port := range com.Ports {
+		if !knownProtocols[strings.ToLower(port.Protocol)] {
+			d.Warnf(fmt.Sprintf("port_map_list[%d].protocol", i), UnknownProtocolCode, "unknown protocol %q of port %d, tcp is used", port.Protocol, port.ContainerPort)
+		}
+	}
+	volumeNames := map[string]int{}
+	for i, volume := range com.ServiceVolumeMapList {
+		path := fmt.Sprintf("service_volume_map_list[%d]", i)
+		// the pod volumes and the claims are named by the sanitized volume names
+		if volume.VolumeType != v1alpha1.ConfigFileVolumeType {
+			name := sanitizeName(volume.VolumeName)
+			var err error
+			if name == "" {
+				err = fmt.Errorf("volume name %q has no letter or digit", volume.VolumeName)
+			} else if other, ok := volumeNames[name]; ok {
+				err = fmt.Errorf("volume name %q conflicts with service_volume_map_list[%d] as %s", volume.VolumeName, other, name)
+			}
+			if err != nil {
+				d.Errorf(path+".volume_name", InvalidVolumeNameCode, "%v", err)
+				errs = append(errs, fmt.Sprintf("%s.volume_name: %v", path, err))
+			} else {
+				volumeNames[name] = i
+			}
+		}
+		switch volume.VolumeType {
+		case v1alpha1.ShareFileVolumeType, v1alpha1.LocalVolumeType, v1alpha1.MemoryFSVolumeType, v1alpha1.ConfigFileVolumeType:
+		default:
+			d.Warnf(path+".volume_type", UnknownVolumeTypeCode, "unknown volume type %q, volume %s is claimed as a persistent volume with the storage class of the resolver", volume.VolumeType, volume.VolumeName)
+		}
+		switch volume.AccessMode {
+		case "", v1alpha1.RWOAccessMode, v1alpha1.RWXAccessMode, v1alpha1.ROXAccessMode:
+		default:
+			d.Warnf(path+".access_mode", UnknownAccessModeCode, "unknown access mode %q, the access mode of volume type %s is used", volume.AccessMode, volume.VolumeType)
+		}
+		if volume.SharingPolicy != "" && !knownSharingPolicy(volume.SharingPolicy) {
+			d.Warnf(path+".sharing_policy", UnknownSharingPolicyCode, "unknown sharing policy %q, the volume is shared", volume.SharingPolicy)
+		}
+		diagnoseQuantity(path+".volume_capacity", volume.VolumeCapacity, ParseDiskQuantity)
+	}
+	for i, config := range com.ServicePluginConfigs {
+		path := fmt.Sprintf("service_related_plugin_config[%d]", i)
+		found := false
+		for _, plugin := range plugins {
+			found = found || plugin.PluginKey == config.PluginKey
+		}
+		if !found {
+			d.Warnf(path+".plugin_key", UnknownPluginCode, "unknown plugin %q, the plugin is not run", config.PluginKey)
+			continue
+		}
+		diagnoseQuantity(path+".memory_required", config.MemoryRequired, ParseMemoryQuantity)
+		diagnoseQuantity(path+".cpu_required", config.CPURequired, ParseCPUQuantity)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
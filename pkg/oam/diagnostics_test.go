@@ -0,0 +1,126 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	apps "k8s.io/api/apps/v1"
+)
+
+func TestBuildDiagnostics(t *testing.T) {
+	ram := newTestRAM()
+	wordpress := ram.Components[1]
+	wordpress.DeployType = "unknown"
+	wordpress.Ports[0].Protocol = "sctp"
+	wordpress.ServiceVolumeMapList = []v1alpha1.ComponentVolume{
+		{VolumeName: "data", VolumeMountPath: "/data", VolumeType: v1alpha1.LocalVolumeType, SharingPolicy: "exclusive"},
+		{VolumeName: "cache", VolumeMountPath: "/cache", VolumeType: v1alpha1.ShareFileVolumeType, SharingPolicy: "private", AccessMode: "RWA"},
+	}
+	wordpress.ServicePluginConfigs = []v1alpha1.ComponentPluginConfig{{PluginKey: "missing"}}
+	for _, builder := range []Builder{NewBuilder(ram), NewKubernetesBuilder(ram)} {
+		app, err := builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var codes = map[string]DiagnosticCode{}
+		for _, d := range app.Diagnostics {
+			if d.Severity != WarningSeverity {
+				t.Fatalf("unexpected diagnostic %s", d)
+			}
+			codes[d.Path] = d.Code
+		}
+		expect := map[string]DiagnosticCode{
+			"apps[1].extend_method":                               UnknownDeployTypeCode,
+			"apps[1].port_map_list[0].protocol":                   UnknownProtocolCode,
+			"apps[1].service_volume_map_list[1].sharing_policy":   UnknownSharingPolicyCode,
+			"apps[1].service_volume_map_list[1].access_mode":      UnknownAccessModeCode,
+			"apps[1].service_related_plugin_config[0].plugin_key": UnknownPluginCode,
+		}
+		if len(codes) != len(expect) {
+			t.Fatalf("expect diagnostics %v, got %v", expect, app.Diagnostics)
+		}
+		for path, code := range expect {
+			if codes[path] != code {
+				t.Fatalf("expect %s at %s, got %v", code, path, app.Diagnostics)
+			}
+		}
+	}
+}
+
+func TestBuildInvalidQuantity(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[0].Memory = -1
+	diagnostics := NewDiagnostics()
+	_, err := NewBuilder(ram, WithDiagnostics(diagnostics)).Build()
+	derr, ok := err.(*DiagnosticsError)
+	if !ok {
+		t.Fatalf("expect diagnostics error, got %v", err)
+	}
+	if len(derr.Diagnostics) != 1 || derr.Diagnostics[0].Path != "apps[0].memory" || derr.Diagnostics[0].Code != InvalidQuantityCode {
+		t.Fatalf("unexpected diagnostics %v", derr.Diagnostics)
+	}
+	if !diagnostics.HasErrors() {
+		t.Fatal("the error is not recorded into the collector")
+	}
+	if q := NewMemoryQuantity(-1); !q.IsZero() {
+		t.Fatalf("expect zero quantity, got %s", q.String())
+	}
+}
+
+func TestWorkloadBuilderDiagnostics(t *testing.T) {
+	ram := newTestRAM()
+	diagnostics := NewDiagnostics()
+	com := *ram.Components[0]
+	com.DeployType = ""
+	if _, err := NewWorkloadBuilder(com, nil, WithDiagnostics(diagnostics.At("apps[0]"))).Build(); err != nil {
+		t.Fatal(err)
+	}
+	items := diagnostics.Items()
+	if len(items) != 1 || items[0].Path != "apps[0].extend_method" {
+		t.Fatalf("unexpected diagnostics %v", items)
+	}
+	// nil collector records nothing
+	var none *Diagnostics
+	none.At("apps[0]").Warnf("memory", InvalidQuantityCode, "ignored")
+	if none.Items() != nil || none.Err() != nil {
+		t.Fatal("nil collector should be empty")
+	}
+}
+
+func TestBuildUnknownVolumeType(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[0].ServiceVolumeMapList = []v1alpha1.ComponentVolume{
+		{VolumeName: "data", VolumeMountPath: "/var/lib/mysql", VolumeType: "ceph-rbd"},
+	}
+	app, err := NewBuilder(ram, WithStorageClassResolver(StorageClassMap{"ceph-rbd": "rbd"})).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(app.Diagnostics) != 1 || app.Diagnostics[0].Code != UnknownVolumeTypeCode || !strings.Contains(app.Diagnostics[0].Message, "claimed") {
+		t.Fatalf("unexpected diagnostics %v", app.Diagnostics)
+	}
+	sts := app.Components[0].Spec.Workload.Object.(*apps.StatefulSet)
+	claims := sts.Spec.VolumeClaimTemplates
+	if len(claims) != 1 || claims[0].Spec.StorageClassName == nil || *claims[0].Spec.StorageClassName != "rbd" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
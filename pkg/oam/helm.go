@@ -0,0 +1,355 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+//HelmChartAPIVersion the api version of the chart
+var HelmChartAPIVersion = "v2"
+
+//DefaultHelmChartVersion the chart version used when the application version is not a semantic version
+var DefaultHelmChartVersion = "0.1.0"
+
+// the versions can be completed to a semantic version, such as v1, 1.0, 1.0.0-rc1
+var chartVersionRegexp = regexp.MustCompile(`^v?([0-9]+)(\.[0-9]+)?(\.[0-9]+)?([-+][0-9A-Za-z.+-]+)?$`)
+
+// the placeholders of the template expressions in the marshaled objects
+var helmPlaceholderRegexp = regexp.MustCompile(`__helm_value_[0-9]+__`)
+
+// the template delimiters in the user data, such as the envs and the config files
+var helmDelimiterRegexp = regexp.MustCompile(`\{\{|\}\}`)
+
+// the modification time of the archive entries, the same chart is always packaged as the same archive
+var helmArchiveModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+//HelmChart the helm chart of the application, the files are keyed by the path relative to the chart directory
+type HelmChart struct {
+	Name    string
+	Version string
+	Files   map[string][]byte
+	// Diagnostics the fields of the rainbond application config converted with the default values
+	Diagnostics []Diagnostic
+}
+
+type helmChartMeta struct {
+	APIVersion  string `json:"apiVersion"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	AppVersion  string `json:"appVersion,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type"`
+}
+
+//helmComponentValues the values of a component, memory is in MiB
+type helmComponentValues struct {
+	Image    string            `json:"image"`
+	Replicas int32             `json:"replicas"`
+	Memory   int               `json:"memory"`
+	CPU      int               `json:"cpu"`
+	Env      map[string]string `json:"env,omitempty"`
+}
+
+//helmEnv a changeable env can be set by the values
+type helmEnv struct {
+	// the values name of the component owns the env
+	owner string
+	value string
+	// the env is not changeable, the later envs of the same name are ignored by the workload
+	fixed bool
+}
+
+type helmTemplater struct {
+	expressions []string
+}
+
+//NewHelmChart render the application as a helm chart. The templates render the same objects as the
+//kubernetes backend, the image, replicas, memory, cpu and the changeable envs of the components are
+//exposed by values.yaml, the dependency envs follow the values of the component they depend on.
+func NewHelmChart(ram v1alpha1.RainbondApplicationConfig, opts ...Option) (*HelmChart, error) {
+	b := &builder{
+		ram:        ram,
+		opts:       opts,
+		kubernetes: true,
+	}
+	app, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	meta := helmChartMeta{
+		APIVersion:  HelmChartAPIVersion,
+		Name:        appName(&ram),
+		Version:     chartVersion(ram.AppVersion),
+		AppVersion:  ram.AppVersion,
+		Description: fmt.Sprintf("Helm chart of the rainbond application %s", ram.AppName),
+		Type:        "application",
+	}
+	chart := &HelmChart{
+		Name:        meta.Name,
+		Version:     meta.Version,
+		Files:       map[string][]byte{},
+		Diagnostics: app.Diagnostics,
+	}
+	if chart.Files["Chart.yaml"], err = yaml.Marshal(meta); err != nil {
+		return nil, err
+	}
+	values := map[string]*helmComponentValues{}
+	var templater helmTemplater
+	for _, obj := range app.Objects() {
+		content, err := toUnstructuredContent(obj)
+		if err != nil {
+			return nil, err
+		}
+		u := &unstructured.Unstructured{Object: content}
+		if com := b.getComponent(u.GetAnnotations()["app.rainbond.io/component-key"]); com != nil {
+			if err := templater.templateWorkload(b, com, u, values); err != nil {
+				return nil, err
+			}
+		}
+		body, err := yaml.Marshal(u.Object)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %s %s failure %s", u.GetKind(), u.GetName(), err.Error())
+		}
+		path := fmt.Sprintf("templates/%s-%s.yaml", strings.ToLower(u.GetKind()), u.GetName())
+		for i := 1; chart.Files[path] != nil; i++ {
+			path = fmt.Sprintf("templates/%s-%s-%d.yaml", strings.ToLower(u.GetKind()), u.GetName(), i)
+		}
+		chart.Files[path] = templater.replace(body)
+	}
+	if chart.Files["values.yaml"], err = yaml.Marshal(map[string]interface{}{"components": values}); err != nil {
+		return nil, err
+	}
+	return chart, nil
+}
+
+// templateWorkload replace the values of the workload of the component by the template expressions
+func (h *helmTemplater) templateWorkload(b *builder, com *v1alpha1.Component, u *unstructured.Unstructured, values map[string]*helmComponentValues) error {
+	name := b.names[com.ServiceKey]
+	ref := fmt.Sprintf("(index .Values.components %q)", name)
+	value := &helmComponentValues{Memory: com.Memory, CPU: com.CPU, Env: map[string]string{}}
+	values[name] = value
+	if replicas, ok, _ := unstructured.NestedInt64(u.Object, "spec", "replicas"); ok {
+		value.Replicas = int32(replicas)
+		if err := unstructured.SetNestedField(u.Object, h.placeholder(ref+".replicas"), "spec", "replicas"); err != nil {
+			return err
+		}
+	}
+	owned := b.changeableEnvs(com)
+	deps := map[string]helmEnv{}
+	for _, dep := range com.DepServiceMapList {
+		depCom := b.getComponent(dep.DepServiceKey)
+		for name, env := range b.changeableEnvs(depCom) {
+			if _, ok := deps[name]; !ok {
+				deps[name] = env
+			}
+		}
+	}
+	for _, field := range []string{"containers", "initContainers"} {
+		containers, ok, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", field)
+		if !ok {
+			continue
+		}
+		for i := range containers {
+			container, ok := containers[i].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			main := field == "containers" && i == 0
+			if main {
+				value.Image, _, _ = unstructured.NestedString(container, "image")
+				container["image"] = h.placeholder(fmt.Sprintf(`printf "%%q" (printf "%%v" %s.image)`, ref))
+				h.templateResources(container, ref)
+			}
+			envs, _, _ := unstructured.NestedSlice(container, "env")
+			seen := map[string]bool{}
+			for j := range envs {
+				env, ok := envs[j].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				envName, _, _ := unstructured.NestedString(env, "name")
+				envValue, has, _ := unstructured.NestedString(env, "value")
+				if !has || seen[envName] {
+					continue
+				}
+				seen[envName] = true
+				candidate, ok := deps[envName]
+				if own, isOwned := owned[envName]; main && isOwned {
+					candidate, ok = own, true
+				}
+				if !ok || candidate.fixed || candidate.value != envValue {
+					continue
+				}
+				if candidate.owner == name {
+					value.Env[envName] = envValue
+				}
+				env["value"] = h.placeholder(fmt.Sprintf(`printf "%%q" (printf "%%v" (index (index .Values.components %q).env %q))`, candidate.owner, envName))
+			}
+			if len(envs) > 0 {
+				container["env"] = envs
+			}
+			containers[i] = container
+		}
+		if err := unstructured.SetNestedSlice(u.Object, containers, "spec", "template", "spec", field); err != nil {
+			return err
+		}
+	}
+	// the changeable envs are exposed even if they are overridden in the workload
+	for envName, env := range owned {
+		if _, ok := value.Env[envName]; !ok && !env.fixed {
+			value.Env[envName] = env.value
+		}
+	}
+	return nil
+}
+
+// templateResources template the memory and cpu of the main container, the resource absent in the workload is not templated
+func (h *helmTemplater) templateResources(container map[string]interface{}, ref string) {
+	memory := h.placeholder(fmt.Sprintf(`printf "%%q" (printf "%%vMi" %s.memory)`, ref))
+	cpu := h.placeholder(fmt.Sprintf(`printf "%%q" (printf "%%v" %s.cpu)`, ref))
+	for _, path := range [][]string{{"resources", "requests", "memory"}, {"resources", "limits", "memory"}, {"resources", "requests", "cpu"}} {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(container, path...); !ok {
+			continue
+		}
+		if path[2] == "memory" {
+			_ = unstructured.SetNestedField(container, memory, path...)
+		} else {
+			_ = unstructured.SetNestedField(container, cpu, path...)
+		}
+	}
+}
+
+// changeableEnvs the envs of the component in the order injected into the main container, the first env of a name wins
+func (b *builder) changeableEnvs(com *v1alpha1.Component) map[string]helmEnv {
+	envs := map[string]helmEnv{}
+	if com == nil {
+		return envs
+	}
+	for _, list := range [][]v1alpha1.ComponentEnv{com.Envs, com.ServiceConnectInfoMapList} {
+		for _, env := range list {
+			if _, ok := envs[env.AttrName]; ok {
+				continue
+			}
+			envs[env.AttrName] = helmEnv{owner: b.names[com.ServiceKey], value: env.AttrValue, fixed: !env.IsChange}
+		}
+	}
+	return envs
+}
+
+func (h *helmTemplater) placeholder(expression string) string {
+	h.expressions = append(h.expressions, "{{ "+expression+" }}")
+	return fmt.Sprintf("__helm_value_%d__", len(h.expressions)-1)
+}
+
+// replace escape the template delimiters of the user data as string literals, then replace the placeholders
+// by the template expressions
+func (h *helmTemplater) replace(body []byte) []byte {
+	body = helmDelimiterRegexp.ReplaceAllFunc(body, func(delim []byte) []byte {
+		return []byte(fmt.Sprintf("{{ %q }}", delim))
+	})
+	return helmPlaceholderRegexp.ReplaceAllFunc(body, func(token []byte) []byte {
+		var i int
+		fmt.Sscanf(string(token), "__helm_value_%d__", &i)
+		return []byte(h.expressions[i])
+	})
+}
+
+// chartVersion complete the application version to a semantic version
+func chartVersion(version string) string {
+	match := chartVersionRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return DefaultHelmChartVersion
+	}
+	for i := 2; i <= 3; i++ {
+		if match[i] == "" {
+			match[i] = ".0"
+		}
+	}
+	return strings.Join(match[1:], "")
+}
+
+//ArchiveName the file name of the packaged chart
+func (c *HelmChart) ArchiveName() string {
+	return fmt.Sprintf("%s-%s.tgz", c.Name, c.Version)
+}
+
+func (c *HelmChart) paths() []string {
+	paths := make([]string, 0, len(c.Files))
+	for path := range c.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+//WriteDir write the chart into the directory named after the chart under dir, return the chart directory
+func (c *HelmChart) WriteDir(dir string) (string, error) {
+	root := filepath.Join(dir, c.Name)
+	for _, path := range c.paths() {
+		file := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(file, c.Files[path], 0644); err != nil {
+			return "", err
+		}
+	}
+	return root, nil
+}
+
+//WriteArchive write the chart as a gzipped tarball, the same layout as helm package
+func (c *HelmChart) WriteArchive(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	for _, path := range c.paths() {
+		header := &tar.Header{
+			Name:     c.Name + "/" + path,
+			Mode:     0644,
+			Size:     int64(len(c.Files[path])),
+			ModTime:  helmArchiveModTime,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, bytes.NewReader(c.Files[path])); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,216 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// renderHelmChart render the templates with the values as helm does, the documents are keyed by the template path
+func renderHelmChart(t *testing.T, chart *HelmChart, values map[string]interface{}) map[string]interface{} {
+	docs := map[string]interface{}{}
+	for path, body := range chart.Files {
+		if !strings.HasPrefix(path, "templates/") {
+			continue
+		}
+		tpl, err := template.New(path).Option("missingkey=error").Parse(string(body))
+		if err != nil {
+			t.Fatalf("parse template %s failure %s", path, err.Error())
+		}
+		var out bytes.Buffer
+		if err := tpl.Execute(&out, map[string]interface{}{"Values": values}); err != nil {
+			t.Fatalf("render template %s failure %s", path, err.Error())
+		}
+		var doc interface{}
+		if err := yaml.Unmarshal(out.Bytes(), &doc); err != nil {
+			t.Fatalf("unmarshal rendered %s failure %s\n%s", path, err.Error(), out.String())
+		}
+		docs[path] = doc
+	}
+	return docs
+}
+
+func TestHelmChart(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[0].ServiceConnectInfoMapList[0].IsChange = true
+	ram.Components[1].Envs[0].IsChange = true
+	chart, err := NewHelmChart(ram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta map[string]interface{}
+	if err := yaml.Unmarshal(chart.Files["Chart.yaml"], &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta["name"] != "wordpress" || meta["version"] != "1.0.0" || meta["appVersion"] != "1.0" {
+		t.Fatalf("unexpected chart meta %v", meta)
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(chart.Files["values.yaml"], &values); err != nil {
+		t.Fatal(err)
+	}
+	// the default values render the objects of the kubernetes backend
+	app, err := NewKubernetesBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := renderHelmChart(t, chart, values)
+	if len(docs) != len(app.Objects()) {
+		t.Fatalf("expect %d templates, got %d", len(app.Objects()), len(docs))
+	}
+	for _, obj := range app.Objects() {
+		content, err := toUnstructuredContent(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := json.Marshal(content)
+		var expect interface{}
+		json.Unmarshal(body, &expect)
+		var found bool
+		for _, doc := range docs {
+			if reflect.DeepEqual(doc, expect) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("object %s is not rendered by the chart:\n%s", obj.GetObjectKind().GroupVersionKind().Kind, body)
+		}
+	}
+	// the values override the workloads, the dependency envs follow the values of the dependency
+	components := values["components"].(map[string]interface{})
+	mysql := components["gr7c3d4e"].(map[string]interface{})
+	wordpress := components["gr9a8b7c"].(map[string]interface{})
+	if wordpress["replicas"] != float64(2) || wordpress["memory"] != float64(256) || wordpress["image"] == "" {
+		t.Fatalf("unexpected wordpress values %v", wordpress)
+	}
+	if env := mysql["env"].(map[string]interface{}); len(env) != 1 || env["MYSQL_HOST"] != "127.0.0.1" {
+		t.Fatalf("only the changeable envs are exposed: %v", env)
+	}
+	wordpress["replicas"] = 3
+	wordpress["image"] = "wordpress:6"
+	wordpress["env"].(map[string]interface{})["WORDPRESS_DB_NAME"] = "blog"
+	mysql["env"].(map[string]interface{})["MYSQL_HOST"] = "mysql.example.com"
+	deployment := renderHelmChart(t, chart, values)["templates/deployment-gr9a8b7c.yaml"].(map[string]interface{})
+	spec := deployment["spec"].(map[string]interface{})
+	container := spec["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	envs := map[string]interface{}{}
+	for _, env := range container["env"].([]interface{}) {
+		envs[env.(map[string]interface{})["name"].(string)] = env.(map[string]interface{})["value"]
+	}
+	if spec["replicas"] != float64(3) || container["image"] != "wordpress:6" || envs["WORDPRESS_DB_NAME"] != "blog" || envs["MYSQL_HOST"] != "mysql.example.com" || envs["MYSQL_PORT"] != "3306" {
+		t.Fatalf("the values are not applied: replicas %v image %v envs %v", spec["replicas"], container["image"], envs)
+	}
+
+	var archive bytes.Buffer
+	if err := chart.WriteArchive(&archive); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	var files int
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(header.Name, "wordpress/") {
+			t.Fatalf("unexpected archive entry %s", header.Name)
+		}
+		files++
+	}
+	if files != len(chart.Files) || chart.ArchiveName() != "wordpress-1.0.0.tgz" {
+		t.Fatalf("unexpected archive %s with %d files", chart.ArchiveName(), files)
+	}
+}
+
+func TestChartVersion(t *testing.T) {
+	for version, expect := range map[string]string{
+		"1.0":        "1.0.0",
+		"v2":         "2.0.0",
+		"1.2.3-rc.1": "1.2.3-rc.1",
+		"1.2-beta":   "1.2.0-beta",
+		"latest":     DefaultHelmChartVersion,
+		"":           DefaultHelmChartVersion,
+	} {
+		if got := chartVersion(version); got != expect {
+			t.Errorf("chart version of %q expect %s, got %s", version, expect, got)
+		}
+	}
+}
+
+func TestHelmChartEscape(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[0].ServiceVolumeMapList = []v1alpha1.ComponentVolume{
+		{VolumeName: "conf", VolumeMountPath: "/etc/mysql/my.cnf", VolumeType: v1alpha1.ConfigFileVolumeType, FileConent: "name = {{ .Values }}\n"},
+	}
+	ram.Components[1].Envs[0].AttrValue = "}}{{"
+	chart, err := NewHelmChart(ram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(chart.Files["values.yaml"], &values); err != nil {
+		t.Fatal(err)
+	}
+	docs := renderHelmChart(t, chart, values)
+	var content string
+	for _, doc := range docs {
+		data, _ := doc.(map[string]interface{})["data"].(map[string]interface{})
+		for _, value := range data {
+			content, _ = value.(string)
+		}
+	}
+	if content != "name = {{ .Values }}\n" {
+		t.Fatalf("the config file is not rendered literally: %q", content)
+	}
+	container := docs["templates/deployment-gr9a8b7c.yaml"].(map[string]interface{})["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	if env := container["env"].([]interface{})[0].(map[string]interface{}); env["value"] != "}}{{" {
+		t.Fatalf("the env is not rendered literally: %v", env)
+	}
+
+	// the archive is reproducible
+	var first, second bytes.Buffer
+	if err := chart.WriteArchive(&first); err != nil {
+		t.Fatal(err)
+	}
+	if err := chart.WriteArchive(&second); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("the same chart is packaged as different archives")
+	}
+}
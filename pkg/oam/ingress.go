@@ -0,0 +1,237 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//IngressAnnotationDialect convert the settings of http route to the annotations of an ingress controller
+type IngressAnnotationDialect interface {
+	// IngressClass the ingress class name of the controller, empty means the default class
+	IngressClass() string
+	Annotations(route v1alpha1.IngressHTTPRoute) map[string]string
+}
+
+//NginxIngressDialect annotation dialect of ingress-nginx
+type NginxIngressDialect struct{}
+
+const nginxAnnotationPrefix = "nginx.ingress.kubernetes.io/"
+
+//IngressClass -
+func (NginxIngressDialect) IngressClass() string {
+	return "nginx"
+}
+
+//Annotations -
+func (NginxIngressDialect) Annotations(route v1alpha1.IngressHTTPRoute) map[string]string {
+	annotations := map[string]string{}
+	set := func(key string, value interface{}) {
+		annotations[nginxAnnotationPrefix+key] = fmt.Sprint(value)
+	}
+	if route.ConnectionTimeout > 0 {
+		set("proxy-connect-timeout", route.ConnectionTimeout)
+	}
+	if route.RequestTimeout > 0 {
+		set("proxy-send-timeout", route.RequestTimeout)
+	}
+	if route.ResponseTimeout > 0 {
+		set("proxy-read-timeout", route.ResponseTimeout)
+	}
+	// websocket connections are long-lived, nginx closes them after the read timeout
+	if route.Websocket {
+		if route.RequestTimeout <= 0 {
+			set("proxy-send-timeout", 3600)
+		}
+		if route.ResponseTimeout <= 0 {
+			set("proxy-read-timeout", 3600)
+		}
+	}
+	if route.RequestBodySizeLimit > 0 {
+		set("proxy-body-size", fmt.Sprintf("%dm", route.RequestBodySizeLimit))
+	}
+	if route.ProxyBuffer {
+		set("proxy-buffering", "on")
+	} else {
+		set("proxy-buffering", "off")
+	}
+	if route.SSL {
+		set("ssl-redirect", "true")
+	}
+	switch route.LoadBalancing {
+	case "cookie-session-affinity":
+		set("affinity", "cookie")
+	case "round-robin":
+		set("load-balance", "round_robin")
+	}
+	var snippet []string
+	// requests not matching the headers and cookies of the route are rejected, the values are matched by
+	// the quoted regular expressions because the variables are not expanded in the regular expressions
+	for _, name := range sortedKeys(route.Headers) {
+		if !httpTokenRegexp.MatchString(name) {
+			continue
+		}
+		variable := "$http_" + strings.ToLower(strings.Replace(name, "-", "_", -1))
+		snippet = append(snippet, fmt.Sprintf("if (%s !~ %s) { return 404; }", variable, nginxQuote("^"+regexp.QuoteMeta(route.Headers[name])+"$")))
+	}
+	for _, name := range sortedKeys(route.Cookies) {
+		if !httpTokenRegexp.MatchString(name) {
+			continue
+		}
+		snippet = append(snippet, fmt.Sprintf("if ($cookie_%s !~ %s) { return 404; }", name, nginxQuote("^"+regexp.QuoteMeta(route.Cookies[name])+"$")))
+	}
+	for _, name := range sortedKeys(route.ProxyHeader) {
+		if !httpTokenRegexp.MatchString(name) || !validProxyHeaderValue(route.ProxyHeader[name]) {
+			continue
+		}
+		snippet = append(snippet, fmt.Sprintf("proxy_set_header %s %s;", name, nginxQuote(route.ProxyHeader[name])))
+	}
+	if len(snippet) > 0 {
+		set("configuration-snippet", strings.Join(snippet, "\n"))
+	}
+	return annotations
+}
+
+// httpTokenRegexp the names of the headers and the cookies written into the nginx snippet
+var httpTokenRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// nginxQuote quote the string of the nginx config, the backslashes and the double quotes are escaped
+func nginxQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// validProxyHeaderValue nginx expands the variables of the quoted string and the dollar can not be escaped,
+// the values with dollars or control characters are not written into the snippet
+func validProxyHeaderValue(value string) bool {
+	return !strings.Contains(value, "$") && strings.IndexFunc(value, unicode.IsControl) < 0
+}
+
+// diagnoseSnippet record the headers, the cookies and the proxy headers of the route the nginx snippet skips
+func diagnoseSnippet(route v1alpha1.IngressHTTPRoute, d *Diagnostics) {
+	for _, name := range sortedKeys(route.Headers) {
+		if !httpTokenRegexp.MatchString(name) {
+			d.Warnf("headers", InvalidHeaderCode, "header name %q is not a http token, the header is not matched", name)
+		}
+	}
+	for _, name := range sortedKeys(route.Cookies) {
+		if !httpTokenRegexp.MatchString(name) {
+			d.Warnf("cookies", InvalidHeaderCode, "cookie name %q is not a http token, the cookie is not matched", name)
+		}
+	}
+	for _, name := range sortedKeys(route.ProxyHeader) {
+		switch {
+		case !httpTokenRegexp.MatchString(name):
+			d.Warnf("proxy_header", InvalidHeaderCode, "proxy header name %q is not a http token, the header is not set", name)
+		case !validProxyHeaderValue(route.ProxyHeader[name]):
+			d.Warnf("proxy_header", InvalidHeaderCode, "the value of proxy header %s has dollars or control characters, the header is not set", name)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// buildIngress create ingress for the http routes, the backend is the clusterip service of the target component
+func (b *builder) buildIngress() error {
+	dialect := b.options.ingressDialect
+	for i, route := range b.ram.IngressHTTPRoutes {
+		com := b.getComponent(route.ComponentKey)
+		if com == nil {
+			return fmt.Errorf("http route %s targets unknown component %s", route.Location, route.ComponentKey)
+		}
+		if !hasPort(com, int(route.Port)) {
+			return fmt.Errorf("http route %s targets port %d not defined by component %s", route.Location, route.Port, com.ServiceCname)
+		}
+		switch dialect.(type) {
+		case NginxIngressDialect, *NginxIngressDialect:
+			diagnoseSnippet(route, b.options.diagnostics.At(fmt.Sprintf("ingress_http_routes[%d]", i)))
+		}
+		name := b.names[com.ServiceKey]
+		var host string
+		if route.DefaultDomain && b.options.ingressDomain != "" {
+			host = fmt.Sprintf("%d.%s.%s", route.Port, name, b.options.ingressDomain)
+		}
+		path := route.Location
+		if path == "" {
+			path = "/"
+		}
+		pathType := networking.PathTypePrefix
+		ing := &networking.Ingress{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: networking.SchemeGroupVersion.String(),
+				Kind:       "Ingress",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("%s-%d-%d", name, route.Port, i),
+				Labels:      map[string]string{"name": name},
+				Annotations: dialect.Annotations(route),
+			},
+			Spec: networking.IngressSpec{
+				Rules: []networking.IngressRule{{
+					Host: host,
+					IngressRuleValue: networking.IngressRuleValue{
+						HTTP: &networking.HTTPIngressRuleValue{
+							Paths: []networking.HTTPIngressPath{{
+								Path:     path,
+								PathType: &pathType,
+								Backend: networking.IngressBackend{
+									Service: &networking.IngressServiceBackend{
+										Name: b.serviceName(com),
+										Port: networking.ServiceBackendPort{Number: int32(route.Port)},
+									},
+								},
+							}},
+						},
+					},
+				}},
+			},
+		}
+		if class := dialect.IngressClass(); class != "" {
+			ing.Spec.IngressClassName = &class
+		}
+		if route.SSL && host != "" {
+			ing.Spec.TLS = []networking.IngressTLS{{Hosts: []string{host}}}
+		}
+		b.addResource(ing)
+	}
+	return nil
+}
+
+func hasPort(com *v1alpha1.Component, port int) bool {
+	for _, p := range com.Ports {
+		if p.ContainerPort == port {
+			return true
+		}
+	}
+	return false
+}
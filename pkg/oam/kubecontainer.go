@@ -0,0 +1,230 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"fmt"
+
+	v1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+//kubeContainerConverter convert oam containers to kubernetes containers.
+//config files of all containers are collected into one configmap
+type kubeContainerConverter struct {
+	configMap *core.ConfigMap
+	volumes   []core.Volume
+	// volumes provided by volume claim templates
+	claims map[string]bool
+}
+
+func newKubeContainerConverter(configMapName string) *kubeContainerConverter {
+	return &kubeContainerConverter{
+		configMap: &core.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: configMapName,
+			},
+			Data: map[string]string{},
+		},
+		claims: map[string]bool{},
+	}
+}
+
+//Claim mark the volume is provided by a volume claim template, no pod volume is created for it
+func (k *kubeContainerConverter) Claim(name string) {
+	k.claims[name] = true
+}
+
+//ConfigMap return the configmap holds config files, nil if there is no config file
+func (k *kubeContainerConverter) ConfigMap() *core.ConfigMap {
+	if len(k.configMap.Data) == 0 {
+		return nil
+	}
+	return k.configMap
+}
+
+//Volumes return the pod volumes referenced by converted containers
+func (k *kubeContainerConverter) Volumes() []core.Volume {
+	return k.volumes
+}
+
+func (k *kubeContainerConverter) addVolume(volume core.Volume) {
+	for _, v := range k.volumes {
+		if v.Name == volume.Name {
+			return
+		}
+	}
+	k.volumes = append(k.volumes, volume)
+}
+
+//Convert convert oam container to kubernetes container, volumes is the pod volume source of the oam volume resources
+func (k *kubeContainerConverter) Convert(c v1alpha2.Container, volumes map[string]core.VolumeSource) core.Container {
+	container := core.Container{
+		Name:    c.Name,
+		Image:   c.Image,
+		Command: c.Command,
+		Args:    c.Arguments,
+	}
+	if c.Resources != nil {
+		container.Resources = core.ResourceRequirements{
+			Requests: core.ResourceList{
+				core.ResourceCPU:    c.Resources.CPU.Required,
+				core.ResourceMemory: c.Resources.Memory.Required,
+			},
+			Limits: core.ResourceList{
+				core.ResourceMemory: c.Resources.Memory.Required,
+			},
+		}
+		if c.Resources.CPU.Required.IsZero() {
+			delete(container.Resources.Requests, core.ResourceCPU)
+		}
+		if c.Resources.Memory.Required.IsZero() {
+			delete(container.Resources.Requests, core.ResourceMemory)
+			delete(container.Resources.Limits, core.ResourceMemory)
+		}
+		for _, v := range c.Resources.Volumes {
+			mount := core.VolumeMount{
+				Name:      v.Name,
+				MountPath: v.MountPath,
+			}
+			if v.AccessMode != nil && *v.AccessMode == v1alpha2.VolumeAccessModeRO {
+				mount.ReadOnly = true
+			}
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+			if k.claims[v.Name] {
+				continue
+			}
+			source, ok := volumes[v.Name]
+			if !ok {
+				source = emptyDirVolumeSource(v.Disk)
+			}
+			k.addVolume(core.Volume{Name: v.Name, VolumeSource: source})
+		}
+	}
+	for _, p := range c.Ports {
+		port := core.ContainerPort{
+			Name:          p.Name,
+			ContainerPort: p.Port,
+		}
+		if p.Protocol != nil {
+			port.Protocol = core.Protocol(*p.Protocol)
+		}
+		container.Ports = append(container.Ports, port)
+	}
+	for _, e := range c.Environment {
+		env := core.EnvVar{Name: e.Name}
+		if e.Value != nil {
+			env.Value = *e.Value
+		} else if e.FromSecret != nil {
+			env.ValueFrom = &core.EnvVarSource{
+				SecretKeyRef: &core.SecretKeySelector{
+					Key:                  e.FromSecret.Key,
+					LocalObjectReference: core.LocalObjectReference{Name: e.FromSecret.Name},
+				},
+			}
+		}
+		container.Env = append(container.Env, env)
+	}
+	for _, cf := range c.ConfigFiles {
+		if cf.Value == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s-%d", c.Name, len(k.configMap.Data))
+		k.configMap.Data[key] = *cf.Value
+		container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
+			Name:      "config-file",
+			MountPath: cf.Path,
+			SubPath:   key,
+			ReadOnly:  true,
+		})
+		k.addVolume(core.Volume{
+			Name: "config-file",
+			VolumeSource: core.VolumeSource{
+				ConfigMap: &core.ConfigMapVolumeSource{
+					LocalObjectReference: core.LocalObjectReference{Name: k.configMap.GetName()},
+				},
+			},
+		})
+	}
+	container.LivenessProbe = convertProbe(c.LivenessProbe)
+	container.ReadinessProbe = convertProbe(c.ReadinessProbe)
+	return container
+}
+
+func emptyDirVolumeSource(disk *v1alpha2.DiskResource) core.VolumeSource {
+	source := core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}}
+	if disk != nil && !disk.Required.IsZero() {
+		limit := disk.Required
+		source.EmptyDir.SizeLimit = &limit
+	}
+	return source
+}
+
+func memoryVolumeSource(limit resource.Quantity) core.VolumeSource {
+	source := core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{Medium: core.StorageMediumMemory}}
+	if !limit.IsZero() {
+		source.EmptyDir.SizeLimit = &limit
+	}
+	return source
+}
+
+func convertProbe(p *v1alpha2.ContainerHealthProbe) *core.Probe {
+	if p == nil {
+		return nil
+	}
+	probe := &core.Probe{}
+	if p.InitialDelaySeconds != nil {
+		probe.InitialDelaySeconds = *p.InitialDelaySeconds
+	}
+	if p.TimeoutSeconds != nil {
+		probe.TimeoutSeconds = *p.TimeoutSeconds
+	}
+	if p.PeriodSeconds != nil {
+		probe.PeriodSeconds = *p.PeriodSeconds
+	}
+	if p.SuccessThreshold != nil {
+		probe.SuccessThreshold = *p.SuccessThreshold
+	}
+	if p.FailureThreshold != nil {
+		probe.FailureThreshold = *p.FailureThreshold
+	}
+	// kubernetes only allows one handler, exec takes precedence
+	switch {
+	case p.Exec != nil:
+		probe.Exec = &core.ExecAction{Command: p.Exec.Command}
+	case p.HTTPGet != nil:
+		probe.HTTPGet = &core.HTTPGetAction{
+			Path: p.HTTPGet.Path,
+			Port: intstr.FromInt(int(p.HTTPGet.Port)),
+		}
+		for _, h := range p.HTTPGet.HTTPHeaders {
+			probe.HTTPGet.HTTPHeaders = append(probe.HTTPGet.HTTPHeaders, core.HTTPHeader{Name: h.Name, Value: h.Value})
+		}
+	case p.TCPSocket != nil:
+		probe.TCPSocket = &core.TCPSocketAction{Port: intstr.FromInt(int(p.TCPSocket.Port))}
+	}
+	return probe
+}
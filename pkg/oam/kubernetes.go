@@ -0,0 +1,191 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"fmt"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	v1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	v1alpha1 "github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+//NewKubernetesBuilder new builder renders the application into plain kubernetes objects for the clusters
+//without the oam runtime, the objects are the Resources of the built application: deployments for the
+//stateless components, statefulsets for the stateful components, services, ingresses, configmaps and secrets.
+//The containers are built by the same logic as the oam workloads.
+func NewKubernetesBuilder(ram v1alpha1.RainbondApplicationConfig, opts ...Option) Builder {
+	return &builder{
+		ram:        ram,
+		opts:       opts,
+		kubernetes: true,
+	}
+}
+
+// buildKubeWorkload build the workload, the service and the traits of the component as kubernetes objects
+func (b *builder) buildKubeWorkload(com *v1alpha1.Component, opts []Option) error {
+	name := b.names[com.ServiceKey]
+	var wb WorkloadBuilder
+	switch com.DeployType {
+	case v1alpha1.StateMultipleDeployType, v1alpha1.StateSingletonDeployType:
+		// the service named after the component is the clusterip service
+		wb = &statefulWorkloadBuilder{
+			com:         *com,
+			plugins:     b.ram.Plugins,
+			options:     newOptions(opts),
+			serviceName: name + "-headless",
+		}
+	default:
+		wb = newDeploymentWorkloadBuilder(*com, b.ram.Plugins, opts...)
+	}
+	workload, err := wb.Build()
+	if err != nil {
+		return fmt.Errorf("build workload of component %s failure %s", com.ServiceCname, err.Error())
+	}
+	for _, res := range wb.Resources() {
+		b.addResource(res)
+	}
+	if accessor, err := meta.Accessor(workload.Object); err == nil {
+		annotations := accessor.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations["app.rainbond.io/component-name"] = com.ServiceCname
+		annotations["app.rainbond.io/component-key"] = com.ServiceKey
+		accessor.SetAnnotations(annotations)
+	}
+	b.addResource(workload.Object)
+	if svc := b.buildKubeService(com, b.serviceName(com)); svc != nil {
+		b.addResource(svc)
+	}
+	for _, tb := range b.options.traitBuilders {
+		traits, err := tb.Build(com)
+		if err != nil {
+			return fmt.Errorf("build trait of component %s failure %s", com.ServiceCname, err.Error())
+		}
+		for _, trait := range traits {
+			obj, err := kubeTrait(name, trait, workload.Object)
+			if err != nil {
+				return fmt.Errorf("build trait of component %s failure %s", com.ServiceCname, err.Error())
+			}
+			if obj != nil {
+				b.addResource(obj)
+			}
+		}
+	}
+	return nil
+}
+
+// kubeTrait the trait refers the workload by itself without the oam runtime. The oam traits are
+// skipped, the manual scaler is represented by the replicas of the workload.
+func kubeTrait(name string, trait Trait, workload runtime.Object) (runtime.Object, error) {
+	if trait.Object.GetObjectKind().GroupVersionKind().Group == v1alpha2.Group {
+		return nil, nil
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(trait.Object)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: obj}
+	if u.GetName() == "" {
+		u.SetName(name)
+	}
+	if trait.WorkloadRefPath != "" {
+		gvk := workload.GetObjectKind().GroupVersionKind()
+		ref := map[string]interface{}{
+			"apiVersion": gvk.GroupVersion().String(),
+			"kind":       gvk.Kind,
+			"name":       name,
+		}
+		if err := fieldpath.Pave(u.Object).SetValue(trait.WorkloadRefPath, ref); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// buildKubeService the clusterip service of the inner ports and the ports the routes target
+func (b *builder) buildKubeService(com *v1alpha1.Component, serviceName string) *core.Service {
+	name := b.names[com.ServiceKey]
+	svc := &core.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   serviceName,
+			Labels: map[string]string{"name": name},
+		},
+		Spec: core.ServiceSpec{
+			Type:     core.ServiceTypeClusterIP,
+			Selector: map[string]string{"name": name},
+		},
+	}
+	for _, port := range com.Ports {
+		if !port.IsInner && !b.routed(com, port.ContainerPort) {
+			continue
+		}
+		svc.Spec.Ports = append(svc.Spec.Ports, core.ServicePort{
+			Name:       portName(port.PortAlias),
+			Port:       int32(port.ContainerPort),
+			TargetPort: intstr.FromInt(port.ContainerPort),
+			Protocol:   core.Protocol(*NewTransportProtocol(port.Protocol)),
+		})
+	}
+	if len(svc.Spec.Ports) == 0 {
+		return nil
+	}
+	return svc
+}
+
+func (b *builder) routed(com *v1alpha1.Component, port int) bool {
+	for _, route := range b.ram.IngressHTTPRoutes {
+		if route.ComponentKey == com.ServiceKey && int(route.Port) == port {
+			return true
+		}
+	}
+	// the tcp/udp services configmap of ingress-nginx proxies to the clusterip service
+	for _, route := range b.ram.IngressStreamRoutes() {
+		if route.ComponentKey == com.ServiceKey && int(route.Port) == port {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceName the name of the clusterip service the routes target. The oam runtime injects the service
+// named after the containerized workload with its first port only, so the routes have their own service.
+func (b *builder) serviceName(com *v1alpha1.Component) string {
+	name := b.names[com.ServiceKey]
+	if b.kubernetes {
+		return name
+	}
+	switch com.DeployType {
+	case v1alpha1.StateMultipleDeployType, v1alpha1.StateSingletonDeployType:
+		// the governing service of the statefulset has all the ports
+		return name
+	}
+	return name + "-clusterip"
+}
@@ -0,0 +1,146 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"testing"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestKubernetesBuilder(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[1].AppImage = v1alpha1.ImageInfo{HubURL: "hub.example.com", HubUser: "admin", HubPassword: "secret"}
+	ram.Components[1].Image = "hub.example.com/library/wordpress:5"
+	ram.Components[1].ServiceVolumeMapList = v1alpha1.ComponentVolumeList{
+		{VolumeName: "conf", VolumeMountPath: "/etc/wp.conf", VolumeType: v1alpha1.ConfigFileVolumeType, FileConent: "debug=true"},
+		{VolumeName: "uploads", VolumeMountPath: "/var/www/html/uploads", VolumeType: v1alpha1.ShareFileVolumeType, VolumeCapacity: 2},
+	}
+	ram.IngressHTTPRoutes = []v1alpha1.IngressHTTPRoute{{
+		Location:        "/",
+		TargetComponent: v1alpha1.TargetComponent{ComponentKey: "f6e5d4c3b2a1", Port: 80},
+	}}
+	app, err := NewKubernetesBuilder(ram, WithAutoscaler(80)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.AppConfiguration != nil || len(app.Components) != 0 || len(app.Definitions) != 0 || len(app.Scopes) != 0 {
+		t.Fatal("the kubernetes builder must not create oam objects")
+	}
+	kinds := map[string]int{}
+	var deployment *apps.Deployment
+	var statefulset *apps.StatefulSet
+	services := map[string]*core.Service{}
+	for _, res := range app.Objects() {
+		kinds[res.GetObjectKind().GroupVersionKind().Kind]++
+		switch obj := res.(type) {
+		case *apps.Deployment:
+			deployment = obj
+		case *apps.StatefulSet:
+			statefulset = obj
+		case *core.Service:
+			services[obj.GetName()] = obj
+		case *networking.Ingress:
+			if obj.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name != "gr9a8b7c" {
+				t.Fatalf("unexpected ingress backend %+v", obj.Spec.Rules[0].HTTP.Paths[0].Backend)
+			}
+		case *unstructured.Unstructured:
+			if obj.GetKind() != "HorizontalPodAutoscaler" {
+				t.Fatalf("unexpected object %s", obj.GetKind())
+			}
+			ref, _, _ := unstructured.NestedString(obj.Object, "spec", "scaleTargetRef", "kind")
+			if ref != "Deployment" || obj.GetName() != "gr9a8b7c" {
+				t.Fatalf("unexpected autoscaler %+v", obj.Object)
+			}
+		}
+	}
+	for kind, count := range map[string]int{"Deployment": 1, "StatefulSet": 1, "Ingress": 1, "Secret": 1, "ConfigMap": 1, "PersistentVolumeClaim": 1, "HorizontalPodAutoscaler": 1} {
+		if kinds[kind] != count {
+			t.Fatalf("expect %d %s, got %v", count, kind, kinds)
+		}
+	}
+	if statefulset == nil || statefulset.Spec.ServiceName != "gr7c3d4e-headless" || services["gr7c3d4e-headless"] == nil {
+		t.Fatal("the statefulset must be governed by the headless service")
+	}
+	mysql := services["gr7c3d4e"]
+	if mysql == nil || mysql.Spec.Type != core.ServiceTypeClusterIP || mysql.Spec.Ports[0].Port != 3306 {
+		t.Fatalf("unexpected mysql service %+v", mysql)
+	}
+	if wordpress := services["gr9a8b7c"]; wordpress == nil || wordpress.Spec.Ports[0].Port != 80 {
+		t.Fatal("the port routed by the ingress must be served")
+	}
+	if deployment == nil || *deployment.Spec.Replicas != 2 || deployment.Spec.Template.Labels["name"] != "gr9a8b7c" {
+		t.Fatalf("unexpected deployment %+v", deployment)
+	}
+	envs := map[string]string{}
+	for _, env := range deployment.Spec.Template.Spec.Containers[0].Env {
+		envs[env.Name] = env.Value
+	}
+	if envs["MYSQL_HOST"] != "127.0.0.1" || envs["MYSQL_PORT"] != "3306" {
+		t.Fatalf("the dependency envs must be set directly: %v", envs)
+	}
+	if len(deployment.Spec.Template.Spec.ImagePullSecrets) != 1 {
+		t.Fatal("the deployment has no image pull secret")
+	}
+}
+
+func TestInitPluginOfStatelessComponent(t *testing.T) {
+	ram := newTestRAM()
+	ram.Plugins = []v1alpha1.Plugin{
+		{PluginKey: "migrate", PluginName: "migrate", Image: "goodrain.me/migrate", Category: v1alpha1.InitPluginCategory},
+		{PluginKey: "perf", PluginName: "perf", Image: "goodrain.me/tcm"},
+	}
+	ram.Components[1].ServicePluginConfigs = []v1alpha1.ComponentPluginConfig{{PluginKey: "migrate"}, {PluginKey: "perf"}}
+
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	if len(cw.Spec.Containers) != 2 || cw.Spec.Containers[1].Image != "goodrain.me/tcm" {
+		t.Fatalf("the init plugin runs as a sidecar %+v", cw.Spec.Containers)
+	}
+	var diagnosed bool
+	for _, d := range app.Diagnostics {
+		diagnosed = diagnosed || (d.Code == UnsupportedInitPluginCode && d.Path == "apps[1].service_related_plugin_config[0].plugin_key")
+	}
+	if !diagnosed {
+		t.Fatalf("the skipped init plugin is not diagnosed %v", app.Diagnostics)
+	}
+
+	app, err = NewKubernetesBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range app.Objects() {
+		if deployment, ok := res.(*apps.Deployment); ok {
+			spec := deployment.Spec.Template.Spec
+			if len(spec.InitContainers) != 1 || spec.InitContainers[0].Image != "goodrain.me/migrate" || len(spec.Containers) != 2 {
+				t.Fatalf("unexpected containers %+v init containers %+v", spec.Containers, spec.InitContainers)
+			}
+			return
+		}
+	}
+	t.Fatal("no deployment created")
+}
@@ -0,0 +1,192 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+//MonitorMode how the component monitors are output
+type MonitorMode string
+
+//ServiceMonitorMode create ServiceMonitor of prometheus operator
+var ServiceMonitorMode MonitorMode = "ServiceMonitor"
+
+//ScrapeConfigMode create a configmap holds the scrape_configs fragment of prometheus
+var ScrapeConfigMode MonitorMode = "ScrapeConfig"
+
+//ScrapeConfigKey the key of scrape configs in the configmap
+var ScrapeConfigKey = "scrape_configs.yaml"
+
+// prometheus duration, such as 30s, 1m30s
+var durationRegexp = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|y))+$`)
+
+// label of the metrics services
+const metricsLabel = "app.rainbond.io/metrics"
+
+type scrapeConfig struct {
+	JobName             string                   `json:"job_name"`
+	MetricsPath         string                   `json:"metrics_path,omitempty"`
+	ScrapeInterval      string                   `json:"scrape_interval,omitempty"`
+	KubernetesSDConfigs []map[string]interface{} `json:"kubernetes_sd_configs"`
+	RelabelConfigs      []relabelConfig          `json:"relabel_configs"`
+}
+
+type relabelConfig struct {
+	SourceLabels []string `json:"source_labels"`
+	Action       string   `json:"action"`
+	Regex        string   `json:"regex"`
+}
+
+// buildMonitor create a metrics service for each component has monitors, the monitors become
+// ServiceMonitors or the prometheus scrape configs
+func (b *builder) buildMonitor() error {
+	var scrapeConfigs []scrapeConfig
+	// the monitors are named after the components, the monitors of the components may have the same name
+	monitors := map[string]bool{}
+	for _, com := range b.ram.Components {
+		if len(com.ComponentMonitor) == 0 {
+			continue
+		}
+		name := b.names[com.ServiceKey]
+		svc := &core.Service{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "Service",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name + "-metrics",
+				Labels: map[string]string{"name": name, metricsLabel: "true"},
+			},
+			Spec: core.ServiceSpec{
+				Selector: map[string]string{"name": name},
+			},
+		}
+		for _, monitor := range com.ComponentMonitor {
+			if err := validateMonitor(com, monitor); err != nil {
+				return err
+			}
+			portName := fmt.Sprintf("metrics-%d", monitor.Port)
+			if !hasServicePort(svc, portName) {
+				svc.Spec.Ports = append(svc.Spec.Ports, core.ServicePort{
+					Name:       portName,
+					Port:       int32(monitor.Port),
+					TargetPort: intstr.FromInt(monitor.Port),
+				})
+			}
+			monitorName := fmt.Sprintf("%s-%d", name, monitor.Port)
+			if sanitizeName(monitor.Name) != "" {
+				monitorName = name + "-" + sanitizeName(monitor.Name)
+			}
+			if monitors[monitorName] {
+				return fmt.Errorf("monitor %s of component %s conflicts with the monitor named %s", monitor.Name, com.ServiceCname, monitorName)
+			}
+			monitors[monitorName] = true
+			if b.options.monitorMode == ScrapeConfigMode {
+				scrapeConfigs = append(scrapeConfigs, scrapeConfig{
+					JobName:        monitorName,
+					MetricsPath:    monitor.Path,
+					ScrapeInterval: monitor.Interval,
+					KubernetesSDConfigs: []map[string]interface{}{{
+						"role":       "endpoints",
+						"namespaces": map[string]interface{}{"names": []string{b.options.namespace}},
+					}},
+					RelabelConfigs: []relabelConfig{
+						{SourceLabels: []string{"__meta_kubernetes_service_name"}, Action: "keep", Regex: svc.GetName()},
+						{SourceLabels: []string{"__meta_kubernetes_endpoint_port_name"}, Action: "keep", Regex: portName},
+					},
+				})
+				continue
+			}
+			b.addResource(newServiceMonitor(monitorName, svc, portName, monitor))
+		}
+		b.addResource(svc)
+	}
+	if len(scrapeConfigs) == 0 {
+		return nil
+	}
+	body, err := yaml.Marshal(map[string]interface{}{"scrape_configs": scrapeConfigs})
+	if err != nil {
+		return err
+	}
+	b.addResource(&core.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: appName(&b.ram) + "-scrape-configs",
+		},
+		Data: map[string]string{ScrapeConfigKey: string(body)},
+	})
+	return nil
+}
+
+func newServiceMonitor(name string, svc *core.Service, portName string, monitor v1alpha1.ComponentMonitor) *unstructured.Unstructured {
+	endpoint := map[string]interface{}{"port": portName}
+	if monitor.Path != "" {
+		endpoint["path"] = monitor.Path
+	}
+	if monitor.Interval != "" {
+		endpoint["interval"] = monitor.Interval
+	}
+	sm := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{
+					"name":       svc.Labels["name"],
+					metricsLabel: "true",
+				},
+			},
+			"endpoints": []interface{}{endpoint},
+		},
+	}}
+	sm.SetAPIVersion("monitoring.coreos.com/v1")
+	sm.SetKind("ServiceMonitor")
+	sm.SetName(name)
+	sm.SetLabels(map[string]string{"name": svc.Labels["name"]})
+	return sm
+}
+
+func validateMonitor(com *v1alpha1.Component, monitor v1alpha1.ComponentMonitor) error {
+	if !hasPort(com, monitor.Port) {
+		return fmt.Errorf("monitor %s of component %s uses port %d not defined by the component", monitor.Name, com.ServiceCname, monitor.Port)
+	}
+	if monitor.Interval != "" && !durationRegexp.MatchString(monitor.Interval) {
+		return fmt.Errorf("monitor %s of component %s has invalid interval %s", monitor.Name, com.ServiceCname, monitor.Interval)
+	}
+	return nil
+}
+
+func hasServicePort(svc *core.Service, name string) bool {
+	for _, p := range svc.Spec.Ports {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
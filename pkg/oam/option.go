@@ -0,0 +1,189 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+)
+
+//Option builder option
+type Option func(o *options)
+
+type options struct {
+	storageClassResolver StorageClassResolver
+	dependencyEnvs       []DependencyEnv
+	traitBuilders        []TraitBuilder
+	ingressDialect       IngressAnnotationDialect
+	ingressDomain        string
+	streamRouteMode      StreamRouteMode
+	namespace            string
+	configGroups         []v1alpha1.AppConfigGroup
+	sharedVolumes        []SharedVolume
+	monitorMode          MonitorMode
+	diagnostics          *Diagnostics
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		storageClassResolver: DefaultStorageClassResolver,
+		// the first trait builder is the scaler of the replicas
+		traitBuilders:   []TraitBuilder{NewManualScalerTraitBuilder()},
+		ingressDialect:  NginxIngressDialect{},
+		streamRouteMode: LoadBalancerStreamRoute,
+		namespace:       "default",
+		monitorMode:     ServiceMonitorMode,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+//WithStorageClassResolver set the storage class resolver of volume claims
+func WithStorageClassResolver(resolver StorageClassResolver) Option {
+	return func(o *options) {
+		if resolver != nil {
+			o.storageClassResolver = resolver
+		}
+	}
+}
+
+//WithTraitBuilders add trait builders, the manual scaler trait builder is always used
+func WithTraitBuilders(builders ...TraitBuilder) Option {
+	return func(o *options) {
+		o.traitBuilders = append(o.traitBuilders, builders...)
+	}
+}
+
+//WithAutoscaler create autoscaler traits instead of the manual scaler traits for the components whose
+//max node is greater than min node. Only the deployments and the statefulsets are autoscaled, the
+//containerized workloads of the oam builder keep the manual scaler, use the kubernetes builder for them
+func WithAutoscaler(targetCPUUtilization int32) Option {
+	return func(o *options) {
+		o.traitBuilders[0] = NewScalerTraitBuilder(targetCPUUtilization)
+	}
+}
+
+//WithIngressAnnotationDialect set the annotation dialect of the ingress controller, default is ingress-nginx
+func WithIngressAnnotationDialect(dialect IngressAnnotationDialect) Option {
+	return func(o *options) {
+		if dialect != nil {
+			o.ingressDialect = dialect
+		}
+	}
+}
+
+//WithIngressDomain set the domain suffix of the http routes use the default domain,
+//the host is <port>.<component>.<domain>
+func WithIngressDomain(domain string) Option {
+	return func(o *options) {
+		o.ingressDomain = domain
+	}
+}
+
+//WithStreamRouteMode set how the tcp/udp routes are exposed, default is LoadBalancer service
+func WithStreamRouteMode(mode StreamRouteMode) Option {
+	return func(o *options) {
+		o.streamRouteMode = mode
+	}
+}
+
+//WithNamespace set the namespace the application is installed to, the objects outside
+//the namespace refer to it, such as the stream services configmap of ingress-nginx
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+//WithMonitorMode set how the component monitors are output, default is ServiceMonitor
+func WithMonitorMode(mode MonitorMode) Option {
+	return func(o *options) {
+		o.monitorMode = mode
+	}
+}
+
+//WithDiagnostics record the diagnostics of the conversion into the collector, the builder collects
+//the diagnostics into a new collector if it is not set
+func WithDiagnostics(diagnostics *Diagnostics) Option {
+	return func(o *options) {
+		o.diagnostics = diagnostics
+	}
+}
+
+//WithConfigGroups set the app config groups, the groups the component is a member of are injected into it
+func WithConfigGroups(groups ...v1alpha1.AppConfigGroup) Option {
+	return func(o *options) {
+		o.configGroups = append(o.configGroups, groups...)
+	}
+}
+
+//WithSharedVolumes set the shared volumes the workload mounts
+func WithSharedVolumes(volumes ...SharedVolume) Option {
+	return func(o *options) {
+		o.sharedVolumes = append(o.sharedVolumes, volumes...)
+	}
+}
+
+//WithDependencyEnvs set the envs the workload gets from its dependent components
+func WithDependencyEnvs(envs ...DependencyEnv) Option {
+	return func(o *options) {
+		o.dependencyEnvs = append(o.dependencyEnvs, envs...)
+	}
+}
+
+//DependencyEnv env injected into every container of the workload from the data output of a dependent component
+type DependencyEnv struct {
+	// OutputName the name of the data output
+	OutputName string
+	// Name the env name
+	Name string
+	// Value the value of the env, the env is filled by the data input if it is nil
+	Value *string
+}
+
+//StorageClassResolver resolve the storage class name of the volume in the target cluster,
+//nil means the default storage class of the cluster
+type StorageClassResolver interface {
+	StorageClass(volume v1alpha1.ComponentVolume) *string
+}
+
+//StorageClassResolverFunc function implement of StorageClassResolver
+type StorageClassResolverFunc func(volume v1alpha1.ComponentVolume) *string
+
+//StorageClass -
+func (f StorageClassResolverFunc) StorageClass(volume v1alpha1.ComponentVolume) *string {
+	return f(volume)
+}
+
+//DefaultStorageClassResolver use the default storage class of the cluster for all volumes
+var DefaultStorageClassResolver StorageClassResolver = StorageClassResolverFunc(func(volume v1alpha1.ComponentVolume) *string {
+	return nil
+})
+
+//StorageClassMap resolve storage class by volume type, the volume type not in map use the default storage class
+type StorageClassMap map[v1alpha1.VolumeType]string
+
+//StorageClass -
+func (m StorageClassMap) StorageClass(volume v1alpha1.ComponentVolume) *string {
+	if class, ok := m[volume.VolumeType]; ok {
+		return &class
+	}
+	return nil
+}
@@ -0,0 +1,1057 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	v1alpha1 "github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"github.com/goodrain/rainbond-oam/pkg/util"
+	apps "k8s.io/api/apps/v1"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+//Loss a field of the oam objects that can not be represented by the rainbond application config
+type Loss struct {
+	// Object kind/name of the object the field belongs to
+	Object string `json:"object"`
+	// Path the field path in the object
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+//LossReport the fields lost when parsing the oam objects
+type LossReport struct {
+	Losses []Loss `json:"losses,omitempty"`
+}
+
+func (r *LossReport) add(object, path, format string, args ...interface{}) {
+	r.Losses = append(r.Losses, Loss{Object: object, Path: path, Reason: fmt.Sprintf(format, args...)})
+}
+
+//Empty whether nothing is lost
+func (r *LossReport) Empty() bool {
+	return len(r.Losses) == 0
+}
+
+func (r *LossReport) String() string {
+	var sb strings.Builder
+	for _, loss := range r.Losses {
+		fmt.Fprintf(&sb, "%s %s: %s\n", loss.Object, loss.Path, loss.Reason)
+	}
+	return sb.String()
+}
+
+//Parser parse the oam application into rainbond application config
+type Parser interface {
+	Parse() (*v1alpha1.RainbondApplicationConfig, *LossReport, error)
+}
+
+//NewParser new parser of the oam objects, such as the objects returned by Application.Objects.
+//The objects must contain one application configuration and the components it references, the
+//configmaps and the persistent volume claims are used to restore config files, config groups and
+//shared volumes, the docker config secrets are used to restore the hub credentials of the images.
+//Both typed and unstructured objects are accepted.
+func NewParser(objects ...runtime.Object) Parser {
+	return &parser{objects: objects}
+}
+
+type parser struct {
+	objects    []runtime.Object
+	appConfig  *v1alpha2.ApplicationConfiguration
+	components map[string]*v1alpha2.Component
+	configMaps map[string]*core.ConfigMap
+	claims     map[string]*core.PersistentVolumeClaim
+	secrets    map[string]*core.Secret
+	ram        *v1alpha1.RainbondApplicationConfig
+	report     *LossReport
+	// coms component name -> rainbond component
+	coms map[string]*v1alpha1.Component
+	// outputs data output name -> component name
+	outputs      map[string]string
+	configGroups map[string]*v1alpha1.AppConfigGroup
+	sharedMounts []sharedMount
+}
+
+// sharedMount a persistent volume claim mounted by the component, the claim is owned by one of the components
+type sharedMount struct {
+	object    string
+	path      string
+	component string
+	claim     string
+	mountPath string
+	readOnly  bool
+}
+
+// the workload normalized as a pod
+type podWorkload struct {
+	object   string
+	prefix   string
+	spec     core.PodSpec
+	claims   []core.PersistentVolumeClaim
+	replicas *int32
+	stateful bool
+	// configMaps the configmaps created when normalizing the workload
+	configMaps map[string]*core.ConfigMap
+	// inlined the config groups are inlined into the envs and the config files of the containers
+	inlined bool
+	// hubs registry -> the hub credentials of the image pull secrets
+	hubs map[string]v1alpha1.ImageInfo
+}
+
+var envFieldPathRegexp = regexp.MustCompile(`(initContainers|containers)\[(\d+)\]\.env\[(\d+)\]\.value$`)
+
+var kubeEnvReferenceRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (p *parser) Parse() (*v1alpha1.RainbondApplicationConfig, *LossReport, error) {
+	p.components = map[string]*v1alpha2.Component{}
+	p.configMaps = map[string]*core.ConfigMap{}
+	p.claims = map[string]*core.PersistentVolumeClaim{}
+	p.secrets = map[string]*core.Secret{}
+	p.coms = map[string]*v1alpha1.Component{}
+	p.outputs = map[string]string{}
+	p.configGroups = map[string]*v1alpha1.AppConfigGroup{}
+	p.report = &LossReport{}
+	if err := p.load(); err != nil {
+		return nil, nil, err
+	}
+	ac := p.appConfig
+	p.ram = &v1alpha1.RainbondApplicationConfig{
+		AppKeyID:        ac.GetName(),
+		AppName:         ac.GetName(),
+		AppVersion:      ac.GetAnnotations()["app.rainbond.io/version"],
+		TempleteVersion: "v2",
+	}
+	if name := ac.GetAnnotations()["app.rainbond.io/name"]; name != "" {
+		p.ram.AppName = name
+	}
+	for _, acc := range ac.Spec.Components {
+		for _, out := range acc.DataOutputs {
+			p.outputs[out.Name] = acc.ComponentName
+		}
+	}
+	for i := range ac.Spec.Components {
+		acc := &ac.Spec.Components[i]
+		path := fmt.Sprintf("spec.components[%d]", i)
+		component, ok := p.components[acc.ComponentName]
+		if !ok {
+			return nil, nil, fmt.Errorf("component %s referenced by the application configuration is not found", acc.ComponentName)
+		}
+		com, err := p.parseComponent(component, acc, path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse component %s failure %s", acc.ComponentName, err.Error())
+		}
+		if com == nil {
+			continue
+		}
+		p.coms[acc.ComponentName] = com
+		p.ram.Components = append(p.ram.Components, com)
+	}
+	for i := range ac.Spec.Components {
+		acc := &ac.Spec.Components[i]
+		if com, ok := p.coms[acc.ComponentName]; ok {
+			p.parseDataInputs(com, acc, fmt.Sprintf("spec.components[%d]", i))
+		}
+	}
+	p.resolveSharedMounts()
+	p.reportUnusedConfigGroups()
+	names := make([]string, 0, len(p.configGroups))
+	for name := range p.configGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p.ram.AppConfigGroups = append(p.ram.AppConfigGroups, *p.configGroups[name])
+	}
+	p.ram.HandleNullValue()
+	return p.ram, p.report, nil
+}
+
+func (p *parser) load() error {
+	for _, obj := range p.objects {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			typed, err := typedObject(u)
+			if err != nil {
+				return err
+			}
+			obj = typed
+		}
+		switch o := obj.(type) {
+		case *v1alpha2.ApplicationConfiguration:
+			if p.appConfig != nil {
+				return fmt.Errorf("found multiple application configurations %s and %s", p.appConfig.GetName(), o.GetName())
+			}
+			p.appConfig = o
+		case *v1alpha2.Component:
+			p.components[o.GetName()] = o
+		case *core.ConfigMap:
+			p.configMaps[o.GetName()] = o
+		case *core.PersistentVolumeClaim:
+			p.claims[o.GetName()] = o
+		case *core.Secret:
+			p.secrets[o.GetName()] = o
+		}
+	}
+	if p.appConfig == nil {
+		return fmt.Errorf("no application configuration found")
+	}
+	return nil
+}
+
+// typedObject convert the unstructured object to the typed object the parser knows, others are returned as they are
+func typedObject(u *unstructured.Unstructured) (runtime.Object, error) {
+	gvk := u.GroupVersionKind()
+	var obj runtime.Object
+	switch {
+	case gvk.Group == v1alpha2.Group && gvk.Kind == v1alpha2.ApplicationConfigurationKind:
+		obj = &v1alpha2.ApplicationConfiguration{}
+	case gvk.Group == v1alpha2.Group && gvk.Kind == v1alpha2.ComponentKind:
+		obj = &v1alpha2.Component{}
+	case gvk.Group == v1alpha2.Group && gvk.Kind == v1alpha2.ContainerizedWorkloadKind:
+		obj = &v1alpha2.ContainerizedWorkload{}
+	case gvk.Group == v1alpha2.Group && gvk.Kind == v1alpha2.ManualScalerTraitKind:
+		obj = &v1alpha2.ManualScalerTrait{}
+	case gvk.Group == apps.GroupName && gvk.Kind == "StatefulSet":
+		obj = &apps.StatefulSet{}
+	case gvk.Group == apps.GroupName && gvk.Kind == "Deployment":
+		obj = &apps.Deployment{}
+	case gvk.Group == autoscaling.GroupName && gvk.Kind == "HorizontalPodAutoscaler":
+		obj = &autoscaling.HorizontalPodAutoscaler{}
+	case gvk.Group == "" && gvk.Kind == "ConfigMap":
+		obj = &core.ConfigMap{}
+	case gvk.Group == "" && gvk.Kind == "PersistentVolumeClaim":
+		obj = &core.PersistentVolumeClaim{}
+	case gvk.Group == "" && gvk.Kind == "Secret":
+		obj = &core.Secret{}
+	default:
+		return u, nil
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj); err != nil {
+		return nil, fmt.Errorf("decode %s %s failure %s", gvk.Kind, u.GetName(), err.Error())
+	}
+	return obj, nil
+}
+
+// decodeRawExtension decode the embedded object of the component and the traits
+func decodeRawExtension(raw runtime.RawExtension) (runtime.Object, error) {
+	u := &unstructured.Unstructured{}
+	switch {
+	case raw.Object != nil:
+		if obj, ok := raw.Object.(*unstructured.Unstructured); ok {
+			u = obj
+		} else {
+			m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(raw.Object)
+			if err != nil {
+				return nil, err
+			}
+			u.Object = m
+		}
+	case len(raw.Raw) > 0:
+		if err := json.Unmarshal(raw.Raw, &u.Object); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("the object is empty")
+	}
+	return typedObject(u)
+}
+
+func objectKind(obj runtime.Object) string {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.GetKind()
+	}
+	return obj.GetObjectKind().GroupVersionKind().Kind
+}
+
+func (p *parser) parseComponent(component *v1alpha2.Component, acc *v1alpha2.ApplicationConfigurationComponent, accPath string) (*v1alpha1.Component, error) {
+	object := "Component/" + component.GetName()
+	workload, err := decodeRawExtension(component.Spec.Workload)
+	if err != nil {
+		return nil, fmt.Errorf("decode workload failure %s", err.Error())
+	}
+	pod, err := p.normalizeWorkload(component.GetName(), workload)
+	if err != nil {
+		return nil, err
+	}
+	if pod == nil {
+		p.report.add(object, "spec.workload", "workload kind %s is not supported, the component is skipped", objectKind(workload))
+		return nil, nil
+	}
+	if len(pod.spec.Containers) == 0 {
+		return nil, fmt.Errorf("the workload has no container")
+	}
+	com := &v1alpha1.Component{
+		ServiceKey:   component.GetAnnotations()["app.rainbond.io/component-key"],
+		ServiceCname: component.GetAnnotations()["app.rainbond.io/component-name"],
+		ServiceAlias: component.GetName(),
+		ServiceName:  component.GetName(),
+		ServiceType:  v1alpha1.ApplicationServiceType,
+	}
+	if com.ServiceKey == "" {
+		com.ServiceKey = component.GetName()
+	}
+	if com.ServiceCname == "" {
+		com.ServiceCname = component.GetName()
+	}
+	outputs := p.outputEnvs(object, acc, accPath)
+	inputs := inputEnvs(acc)
+	p.parseImagePullSecrets(pod)
+	p.parseMainContainer(com, pod, outputs, inputs)
+	if pod.inlined {
+		p.parseInlinedConfigGroups(com)
+	}
+	for i := range pod.spec.Containers[1:] {
+		p.parsePluginContainer(com, pod, "containers", i+1, "", inputs)
+	}
+	for i := range pod.spec.InitContainers {
+		p.parsePluginContainer(com, pod, "initContainers", i, v1alpha1.InitPluginCategory, inputs)
+	}
+	replicas := int32(1)
+	if pod.replicas != nil {
+		replicas = *pod.replicas
+	}
+	rule := v1alpha1.DefaultExtendMethodRule()
+	for i, ct := range acc.Traits {
+		path := fmt.Sprintf("%s.traits[%d]", accPath, i)
+		trait, err := decodeRawExtension(ct.Trait)
+		if err != nil {
+			p.report.add("ApplicationConfiguration/"+p.appConfig.GetName(), path, "decode trait failure %s", err.Error())
+			continue
+		}
+		switch t := trait.(type) {
+		case *v1alpha2.ManualScalerTrait:
+			replicas = t.Spec.ReplicaCount
+		case *autoscaling.HorizontalPodAutoscaler:
+			if t.Spec.MinReplicas != nil {
+				replicas = *t.Spec.MinReplicas
+			}
+			rule.MaxNode = int(t.Spec.MaxReplicas)
+			if t.Spec.TargetCPUUtilizationPercentage != nil {
+				p.report.add("ApplicationConfiguration/"+p.appConfig.GetName(), path+".spec.targetCPUUtilizationPercentage", "the target cpu utilization of the autoscaler is not represented")
+			}
+		default:
+			p.report.add("ApplicationConfiguration/"+p.appConfig.GetName(), path, "trait kind %s is not supported", objectKind(trait))
+		}
+	}
+	for i, scope := range acc.Scopes {
+		if scope.ScopeReference.Kind != v1alpha2.HealthScopeKind {
+			p.report.add("ApplicationConfiguration/"+p.appConfig.GetName(), fmt.Sprintf("%s.scopes[%d]", accPath, i), "scope kind %s is not supported", scope.ScopeReference.Kind)
+		}
+	}
+	rule.MinNode = int(replicas)
+	if rule.MinNode < 1 {
+		rule.MinNode = 1
+	}
+	com.ExtendMethodRule = rule
+	// the stateful component with one replica is restored as singleton, the stateless component is always multiple
+	switch {
+	case pod.stateful && replicas <= 1:
+		com.DeployType = v1alpha1.StateSingletonDeployType
+	case pod.stateful:
+		com.DeployType = v1alpha1.StateMultipleDeployType
+	default:
+		com.DeployType = v1alpha1.StatelessMultipleDeployType
+	}
+	return com, nil
+}
+
+// parseImagePullSecrets restore the hub credentials from the docker config secrets of the pod, the images are
+// matched by their registry
+func (p *parser) parseImagePullSecrets(pod *podWorkload) {
+	pod.hubs = map[string]v1alpha1.ImageInfo{}
+	images := map[string]bool{}
+	for _, c := range append(append([]core.Container{}, pod.spec.Containers...), pod.spec.InitContainers...) {
+		images[imageRegistry(c.Image, "")] = true
+	}
+	for i, ref := range pod.spec.ImagePullSecrets {
+		path := fmt.Sprintf("%simagePullSecrets[%d]", pod.prefix, i)
+		secret, ok := p.secrets[ref.Name]
+		if !ok || secret.Type != core.SecretTypeDockerConfigJson {
+			p.report.add(pod.object, path, "docker config secret %s is not found, the hub credentials of the image are lost", ref.Name)
+			continue
+		}
+		var config dockerConfigJSON
+		if err := json.Unmarshal(secret.Data[core.DockerConfigJsonKey], &config); err != nil {
+			p.report.add(pod.object, path, "decode docker config secret %s failure %s", ref.Name, err.Error())
+			continue
+		}
+		registries := make([]string, 0, len(config.Auths))
+		for registry := range config.Auths {
+			registries = append(registries, registry)
+		}
+		sort.Strings(registries)
+		for _, registry := range registries {
+			auth := config.Auths[registry]
+			if !images[registry] {
+				p.report.add(pod.object, path, "the hub credentials of registry %s in secret %s are not used by the images", registry, ref.Name)
+				continue
+			}
+			if auth.Username == "" && auth.Password == "" && auth.Auth != "" {
+				body, _ := base64.StdEncoding.DecodeString(auth.Auth)
+				if parts := strings.SplitN(string(body), ":", 2); len(parts) == 2 {
+					auth.Username, auth.Password = parts[0], parts[1]
+				}
+			}
+			info := v1alpha1.ImageInfo{HubURL: registry, HubUser: auth.Username, HubPassword: auth.Password}
+			if registry == DockerHubRegistry {
+				info.HubURL = ""
+			}
+			pod.hubs[registry] = info
+		}
+	}
+}
+
+// normalizeWorkload normalize the workload as a pod, the containers of oam are converted to kubernetes containers
+func (p *parser) normalizeWorkload(name string, workload runtime.Object) (*podWorkload, error) {
+	switch w := workload.(type) {
+	case *v1alpha2.ContainerizedWorkload:
+		converter := newKubeContainerConverter(name + "-config-file")
+		// the shared volumes are provided by the persistent volume claims
+		sources := map[string]core.VolumeSource{}
+		pod := &podWorkload{object: "ContainerizedWorkload/" + w.GetName(), prefix: "spec.", configMaps: map[string]*core.ConfigMap{}, inlined: true}
+		for i, c := range w.Spec.Containers {
+			if c.Resources != nil {
+				for _, v := range c.Resources.Volumes {
+					if _, ok := p.claims[v.Name]; ok {
+						sources[v.Name] = core.VolumeSource{PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: v.Name}}
+					}
+				}
+			}
+			for j, cf := range c.ConfigFiles {
+				if cf.FromSecret != nil {
+					p.report.add(pod.object, fmt.Sprintf("spec.containers[%d].configFiles[%d]", i, j), "config file %s from secret %s is not restored", cf.Path, cf.FromSecret.Name)
+				}
+			}
+			for j, env := range c.Environment {
+				if env.FromSecret != nil {
+					p.report.add(pod.object, fmt.Sprintf("spec.containers[%d].env[%d]", i, j), "env %s from secret %s is not restored", env.Name, env.FromSecret.Name)
+				}
+			}
+			pod.spec.Containers = append(pod.spec.Containers, converter.Convert(c, sources))
+			if c.ImagePullSecret != nil {
+				pod.spec.ImagePullSecrets = append(pod.spec.ImagePullSecrets, core.LocalObjectReference{Name: *c.ImagePullSecret})
+			}
+		}
+		pod.spec.Volumes = converter.Volumes()
+		if cm := converter.ConfigMap(); cm != nil {
+			pod.configMaps[cm.GetName()] = cm
+		}
+		return pod, nil
+	case *apps.StatefulSet:
+		return &podWorkload{
+			object:   "StatefulSet/" + w.GetName(),
+			prefix:   "spec.template.spec.",
+			spec:     w.Spec.Template.Spec,
+			claims:   w.Spec.VolumeClaimTemplates,
+			replicas: w.Spec.Replicas,
+			stateful: true,
+		}, nil
+	case *apps.Deployment:
+		return &podWorkload{
+			object:   "Deployment/" + w.GetName(),
+			prefix:   "spec.template.spec.",
+			spec:     w.Spec.Template.Spec,
+			replicas: w.Spec.Replicas,
+		}, nil
+	}
+	return nil, nil
+}
+
+// outputEnvs the indexes of the envs of the main container pointed by the data outputs
+func (p *parser) outputEnvs(object string, acc *v1alpha2.ApplicationConfigurationComponent, accPath string) map[int]bool {
+	outputs := map[int]bool{}
+	for i, out := range acc.DataOutputs {
+		match := envFieldPathRegexp.FindStringSubmatch(out.FieldPath)
+		if match == nil || match[1] != "containers" || match[2] != "0" {
+			p.report.add("ApplicationConfiguration/"+p.appConfig.GetName(), fmt.Sprintf("%s.dataOutputs[%d]", accPath, i), "data output %s of field %s is not an env of the main container", out.Name, out.FieldPath)
+			continue
+		}
+		index, _ := strconv.Atoi(match[3])
+		outputs[index] = true
+	}
+	return outputs
+}
+
+// inputEnvs the envs filled by the data inputs, the key is containers/<i>/<env index>
+func inputEnvs(acc *v1alpha2.ApplicationConfigurationComponent) map[string]bool {
+	inputs := map[string]bool{}
+	for _, in := range acc.DataInputs {
+		for _, path := range in.ToFieldPaths {
+			if match := envFieldPathRegexp.FindStringSubmatch(path); match != nil {
+				inputs[match[1]+"/"+match[2]+"/"+match[3]] = true
+			}
+		}
+	}
+	return inputs
+}
+
+func (p *parser) parseDataInputs(com *v1alpha1.Component, acc *v1alpha2.ApplicationConfigurationComponent, accPath string) {
+	deps := map[string]bool{}
+	for i, in := range acc.DataInputs {
+		path := fmt.Sprintf("%s.dataInputs[%d]", accPath, i)
+		if in.ValueFrom.DataOutputName == "" {
+			continue
+		}
+		producer, ok := p.outputs[in.ValueFrom.DataOutputName]
+		if !ok || p.coms[producer] == nil {
+			p.report.add("ApplicationConfiguration/"+p.appConfig.GetName(), path, "data output %s is not provided by any component", in.ValueFrom.DataOutputName)
+			continue
+		}
+		for _, to := range in.ToFieldPaths {
+			if !envFieldPathRegexp.MatchString(to) {
+				p.report.add("ApplicationConfiguration/"+p.appConfig.GetName(), path, "data input to field %s is not an env", to)
+			}
+		}
+		key := p.coms[producer].ServiceKey
+		if deps[key] || key == com.ServiceKey {
+			continue
+		}
+		deps[key] = true
+		com.DepServiceMapList = append(com.DepServiceMapList, v1alpha1.ComponentDep{DepServiceKey: key})
+	}
+}
+
+func (p *parser) parseMainContainer(com *v1alpha1.Component, pod *podWorkload, outputs map[int]bool, inputs map[string]bool) {
+	c := pod.spec.Containers[0]
+	path := pod.prefix + "containers[0]"
+	com.Image = c.Image
+	com.AppImage = pod.hubs[imageRegistry(c.Image, "")]
+	com.Cmd = kubeCommandLine(c.Args)
+	if len(c.Command) > 0 {
+		com.Cmd = kubeCommandLine(append(append([]string{}, c.Command...), c.Args...))
+		p.report.add(pod.object, path+".command", "the entrypoint of the image can not be replaced, the command is merged into cmd")
+	}
+	if memory, ok := c.Resources.Requests[core.ResourceMemory]; ok {
+		com.Memory = int(memory.Value() / (1024 * 1024))
+	} else if memory, ok := c.Resources.Limits[core.ResourceMemory]; ok {
+		com.Memory = int(memory.Value() / (1024 * 1024))
+	}
+	if cpu, ok := c.Resources.Requests[core.ResourceCPU]; ok {
+		com.CPU = int(cpu.Value())
+	}
+	for _, port := range c.Ports {
+		alias := strings.ToUpper(port.Name)
+		if alias == "" {
+			alias = strings.ToUpper(com.ServiceAlias) + strconv.Itoa(int(port.ContainerPort))
+		}
+		protocol := strings.ToLower(string(port.Protocol))
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		com.Ports = append(com.Ports, v1alpha1.ComponentPort{
+			PortAlias:     alias,
+			Protocol:      protocol,
+			ContainerPort: int(port.ContainerPort),
+			IsInner:       true,
+		})
+	}
+	for i, env := range c.Env {
+		envPath := fmt.Sprintf("%s.env[%d]", path, i)
+		if inputs[fmt.Sprintf("containers/0/%d", i)] {
+			continue
+		}
+		if env.ValueFrom != nil {
+			p.parseEnvSource(com, pod, env, envPath)
+			continue
+		}
+		e := v1alpha1.ComponentEnv{AttrName: env.Name, Name: env.Name, AttrValue: env.Value}
+		if outputs[i] {
+			com.ServiceConnectInfoMapList = append(com.ServiceConnectInfoMapList, e)
+		} else {
+			com.Envs = append(com.Envs, e)
+		}
+	}
+	for i, mount := range c.VolumeMounts {
+		p.parseVolumeMount(com, pod, mount, fmt.Sprintf("%s.volumeMounts[%d]", path, i))
+	}
+	for mode, probe := range map[v1alpha1.ProbeMode]*core.Probe{
+		v1alpha1.LivenessProbeMode:  c.LivenessProbe,
+		v1alpha1.ReadinessProbeMode: c.ReadinessProbe,
+		v1alpha1.StartupProbeMode:   c.StartupProbe,
+	} {
+		if probe != nil {
+			com.Probes = append(com.Probes, parseProbe(mode, probe))
+		}
+	}
+	sort.Slice(com.Probes, func(i, j int) bool { return com.Probes[i].Mode < com.Probes[j].Mode })
+}
+
+func (p *parser) parseEnvSource(com *v1alpha1.Component, pod *podWorkload, env core.EnvVar, path string) {
+	if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+		if group := p.configGroup(ref.Name); group != nil {
+			p.addConfigGroupComponent(group, "env", com.ServiceKey)
+			return
+		}
+	}
+	p.report.add(pod.object, path, "env %s from the value source is not restored", env.Name)
+}
+
+// configGroup the config group of the configmap, nil if the configmap is not a config group
+func (p *parser) configGroup(configMapName string) *v1alpha1.AppConfigGroup {
+	cm, ok := p.configMaps[configMapName]
+	if !ok || cm.GetAnnotations()["app.rainbond.io/config-group"] == "" {
+		return nil
+	}
+	name := cm.GetAnnotations()["app.rainbond.io/config-group"]
+	group, ok := p.configGroups[name]
+	if !ok {
+		group = &v1alpha1.AppConfigGroup{Name: name, ConfigItems: map[string]string{}}
+		for k, v := range cm.Data {
+			group.ConfigItems[k] = v
+		}
+		p.configGroups[name] = group
+	}
+	return group
+}
+
+// parseInlinedConfigGroups the oam containers can not refer to configmaps, the items of the config groups
+// are inlined as envs or as config files under ConfigGroupMountDir. The envs and the config files matching
+// all items of a config group configmap are restored as the config group.
+func (p *parser) parseInlinedConfigGroups(com *v1alpha1.Component) {
+	envs := map[string]string{}
+	for _, env := range com.Envs {
+		envs[env.AttrName] = env.AttrValue
+	}
+	files := map[string]string{}
+	for _, volume := range com.ServiceVolumeMapList {
+		if volume.VolumeType == v1alpha1.ConfigFileVolumeType {
+			files[volume.VolumeMountPath] = volume.FileContent()
+		}
+	}
+	for _, name := range p.configMapNames() {
+		cm := p.configMaps[name]
+		groupName := cm.GetAnnotations()["app.rainbond.io/config-group"]
+		if groupName == "" || len(cm.Data) == 0 {
+			continue
+		}
+		env, file := true, true
+		for k, v := range cm.Data {
+			if value, ok := envs[k]; !ok || value != v {
+				env = false
+			}
+			if content, ok := files[configGroupMountPath(v1alpha1.AppConfigGroup{Name: groupName}, k)]; !ok || content != v {
+				file = false
+			}
+		}
+		switch {
+		case env:
+			var rest []v1alpha1.ComponentEnv
+			for _, e := range com.Envs {
+				if _, ok := cm.Data[e.AttrName]; !ok {
+					rest = append(rest, e)
+				}
+			}
+			com.Envs = rest
+			p.addConfigGroupComponent(p.configGroup(name), envInjection, com.ServiceKey)
+		case file:
+			var rest v1alpha1.ComponentVolumeList
+			for _, volume := range com.ServiceVolumeMapList {
+				if volume.VolumeType == v1alpha1.ConfigFileVolumeType && path.Dir(volume.VolumeMountPath) == path.Join(ConfigGroupMountDir, groupName) {
+					if _, ok := cm.Data[path.Base(volume.VolumeMountPath)]; ok {
+						continue
+					}
+				}
+				rest = append(rest, volume)
+			}
+			com.ServiceVolumeMapList = rest
+			p.addConfigGroupComponent(p.configGroup(name), fileInjection, com.ServiceKey)
+		}
+	}
+}
+
+// reportUnusedConfigGroups the config group configmaps not injected into any component are not restored
+func (p *parser) reportUnusedConfigGroups() {
+	for _, name := range p.configMapNames() {
+		groupName := p.configMaps[name].GetAnnotations()["app.rainbond.io/config-group"]
+		if groupName == "" {
+			continue
+		}
+		if _, ok := p.configGroups[groupName]; !ok {
+			p.report.add("ConfigMap/"+name, "data", "config group %s is not injected into any component, it is not restored", groupName)
+		}
+	}
+}
+
+func (p *parser) configMapNames() []string {
+	names := make([]string, 0, len(p.configMaps))
+	for name := range p.configMaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *parser) addConfigGroupComponent(group *v1alpha1.AppConfigGroup, injection, componentKey string) {
+	group.InjectionType = injection
+	for _, key := range group.ComponentKeys {
+		if key == componentKey {
+			return
+		}
+	}
+	group.ComponentKeys = append(group.ComponentKeys, componentKey)
+}
+
+func (p *parser) parseVolumeMount(com *v1alpha1.Component, pod *podWorkload, mount core.VolumeMount, path string) {
+	for _, claim := range pod.claims {
+		if claim.GetName() != mount.Name {
+			continue
+		}
+		volume := v1alpha1.ComponentVolume{
+			VolumeName:      mount.Name,
+			VolumeMountPath: mount.MountPath,
+			VolumeType:      v1alpha1.LocalVolumeType,
+			AccessMode:      v1alpha1.RWOAccessMode,
+			VolumeCapacity:  claimCapacity(&claim),
+		}
+		for _, mode := range claim.Spec.AccessModes {
+			switch mode {
+			case core.ReadWriteMany:
+				volume.VolumeType = v1alpha1.ShareFileVolumeType
+				volume.AccessMode = v1alpha1.RWXAccessMode
+			case core.ReadOnlyMany:
+				volume.AccessMode = v1alpha1.ROXAccessMode
+			}
+		}
+		if claim.Spec.StorageClassName != nil {
+			p.report.add(pod.object, path, "storage class %s of volume %s is resolved by the target cluster", *claim.Spec.StorageClassName, mount.Name)
+		}
+		com.ServiceVolumeMapList.Add(volume)
+		return
+	}
+	var source *core.Volume
+	for i := range pod.spec.Volumes {
+		if pod.spec.Volumes[i].Name == mount.Name {
+			source = &pod.spec.Volumes[i]
+		}
+	}
+	if source == nil {
+		p.report.add(pod.object, path, "volume %s is not defined", mount.Name)
+		return
+	}
+	switch {
+	case source.ConfigMap != nil:
+		if group := p.configGroup(source.ConfigMap.Name); group != nil {
+			p.addConfigGroupComponent(group, "file", com.ServiceKey)
+			return
+		}
+		cm, ok := pod.configMaps[source.ConfigMap.Name]
+		if !ok {
+			cm, ok = p.configMaps[source.ConfigMap.Name]
+		}
+		content, found := "", false
+		if ok && mount.SubPath != "" {
+			content, found = cm.Data[mount.SubPath]
+		}
+		if !found {
+			p.report.add(pod.object, path, "config file %s is not found in configmap %s", mount.MountPath, source.ConfigMap.Name)
+			return
+		}
+		com.ServiceVolumeMapList.Add(v1alpha1.ComponentVolume{
+			VolumeName:      fileVolumeName(mount.MountPath),
+			VolumeMountPath: mount.MountPath,
+			VolumeType:      v1alpha1.ConfigFileVolumeType,
+			FileConent:      content,
+		})
+	case source.EmptyDir != nil:
+		volume := v1alpha1.ComponentVolume{
+			VolumeName:      mount.Name,
+			VolumeMountPath: mount.MountPath,
+			VolumeType:      v1alpha1.ShareFileVolumeType,
+			AccessMode:      v1alpha1.RWXAccessMode,
+		}
+		if source.EmptyDir.Medium == core.StorageMediumMemory {
+			volume.VolumeType = v1alpha1.MemoryFSVolumeType
+			volume.AccessMode = v1alpha1.RWOAccessMode
+		}
+		if source.EmptyDir.SizeLimit != nil {
+			volume.VolumeCapacity = int(source.EmptyDir.SizeLimit.Value() / (1024 * 1024 * 1024))
+		}
+		if mount.ReadOnly {
+			volume.AccessMode = v1alpha1.ROXAccessMode
+		}
+		com.ServiceVolumeMapList.Add(volume)
+	case source.PersistentVolumeClaim != nil:
+		p.sharedMounts = append(p.sharedMounts, sharedMount{
+			object:    pod.object,
+			path:      path,
+			component: com.ServiceAlias,
+			claim:     source.PersistentVolumeClaim.ClaimName,
+			mountPath: mount.MountPath,
+			readOnly:  mount.ReadOnly || source.PersistentVolumeClaim.ReadOnly,
+		})
+	default:
+		p.report.add(pod.object, path, "the source of volume %s is not supported", mount.Name)
+	}
+}
+
+// resolveSharedMounts the claim named <owner>-<volume> is the volume of the owner component, the other
+// components mounting the claim share the volume of the owner
+func (p *parser) resolveSharedMounts() {
+	for _, sm := range p.sharedMounts {
+		var owner string
+		for name := range p.coms {
+			if strings.HasPrefix(sm.claim, name+"-") && len(name) > len(owner) {
+				owner = name
+			}
+		}
+		if owner == "" {
+			p.report.add(sm.object, sm.path, "the claim %s is not owned by any component", sm.claim)
+			continue
+		}
+		volumeName := strings.TrimPrefix(sm.claim, owner+"-")
+		ownerCom := p.coms[owner]
+		if owner == sm.component {
+			volume := v1alpha1.ComponentVolume{
+				VolumeName:      volumeName,
+				VolumeMountPath: sm.mountPath,
+				VolumeType:      v1alpha1.ShareFileVolumeType,
+				AccessMode:      v1alpha1.RWXAccessMode,
+			}
+			if sm.readOnly {
+				volume.AccessMode = v1alpha1.ROXAccessMode
+			}
+			if claim, ok := p.claims[sm.claim]; ok {
+				volume.VolumeCapacity = claimCapacity(claim)
+			}
+			ownerCom.ServiceVolumeMapList.Add(volume)
+			continue
+		}
+		if ownerCom.ServiceShareID == "" {
+			ownerCom.ServiceShareID = ownerCom.ServiceKey
+		}
+		com := p.coms[sm.component]
+		com.MntReleationList = append(com.MntReleationList, v1alpha1.ComponentShareVolume{
+			VolumeName:       volumeName,
+			VolumeMountDir:   sm.mountPath,
+			ShareServiceUUID: ownerCom.ServiceShareID,
+		})
+	}
+}
+
+// parsePluginContainer the sidecar and the init container are restored as plugins, their envs are the
+// options of one config group, and the values of the component are kept in the plugin config
+func (p *parser) parsePluginContainer(com *v1alpha1.Component, pod *podWorkload, field string, index int, category string, inputs map[string]bool) {
+	var c core.Container
+	if field == "containers" {
+		c = pod.spec.Containers[index]
+	} else {
+		c = pod.spec.InitContainers[index]
+	}
+	path := fmt.Sprintf("%s%s[%d]", pod.prefix, field, index)
+	group := v1alpha1.PluginConfigGroup{
+		ConfigName:      "env",
+		Injection:       v1alpha1.EnvPluginInjection,
+		ServiceMetaType: v1alpha1.UnDefineMetaType,
+	}
+	attrs := map[string]interface{}{}
+	for i, env := range c.Env {
+		if inputs[fmt.Sprintf("%s/%d/%d", field, index, i)] {
+			continue
+		}
+		if env.ValueFrom != nil {
+			p.report.add(pod.object, fmt.Sprintf("%s.env[%d]", path, i), "env %s of plugin from the value source is not restored", env.Name)
+			continue
+		}
+		group.Options = append(group.Options, v1alpha1.PluginConfigGroupOption{
+			AttrName:         env.Name,
+			AttrType:         "string",
+			AttrDefaultValue: env.Value,
+			ServiceMetaType:  v1alpha1.UnDefineMetaType,
+			IsChange:         true,
+		})
+		attrs[env.Name] = env.Value
+	}
+	for name, lost := range map[string]bool{
+		"command":       len(c.Command) > 0 || len(c.Args) > 0,
+		"ports":         len(c.Ports) > 0,
+		"probes":        c.LivenessProbe != nil || c.ReadinessProbe != nil || c.StartupProbe != nil,
+		"volume mounts": len(c.VolumeMounts) > 0,
+	} {
+		if lost {
+			p.report.add(pod.object, path, "the %s of plugin container %s are not restored", name, c.Name)
+		}
+	}
+	plugin := p.addPlugin(v1alpha1.Plugin{
+		PluginName:  c.Name,
+		PluginAlias: c.Name,
+		Image:       c.Image,
+		PluginImage: pod.hubs[imageRegistry(c.Image, "")],
+		Category:    category,
+	}, group)
+	config := v1alpha1.ComponentPluginConfig{
+		PluginKey:    plugin.PluginKey,
+		PluginID:     plugin.PluginID,
+		PluginStatus: true,
+	}
+	if memory, ok := c.Resources.Requests[core.ResourceMemory]; ok {
+		config.MemoryRequired = int(memory.Value() / (1024 * 1024))
+	}
+	if cpu, ok := c.Resources.Requests[core.ResourceCPU]; ok {
+		config.CPURequired = int(cpu.Value())
+	}
+	if len(attrs) > 0 {
+		config.Attr = []map[string]interface{}{{
+			"service_meta_type": v1alpha1.UnDefineMetaType,
+			"injection":         v1alpha1.EnvPluginInjection,
+			"attrs":             attrs,
+		}}
+	}
+	com.ServicePluginConfigs = append(com.ServicePluginConfigs, config)
+}
+
+// addPlugin the containers with the same name and image share one plugin
+func (p *parser) addPlugin(plugin v1alpha1.Plugin, group v1alpha1.PluginConfigGroup) v1alpha1.Plugin {
+	for _, exist := range p.ram.Plugins {
+		if exist.PluginName == plugin.PluginName && exist.Image == plugin.Image && exist.Category == plugin.Category {
+			return exist
+		}
+	}
+	key := pluginContainerName(plugin)
+	for i := 1; ; i++ {
+		conflict := false
+		for _, exist := range p.ram.Plugins {
+			conflict = conflict || exist.PluginKey == key
+		}
+		if !conflict {
+			break
+		}
+		key = fmt.Sprintf("%s-%d", pluginContainerName(plugin), i)
+	}
+	plugin.PluginKey = key
+	plugin.PluginID = key
+	group.PluginID = key
+	if len(group.Options) > 0 {
+		plugin.ConfigGroups = []v1alpha1.PluginConfigGroup{group}
+	}
+	p.ram.Plugins = append(p.ram.Plugins, plugin)
+	return plugin
+}
+
+func parseProbe(mode v1alpha1.ProbeMode, probe *core.Probe) v1alpha1.ComponentProbe {
+	cp := v1alpha1.ComponentProbe{
+		Mode:               mode,
+		IsUsed:             true,
+		InitialDelaySecond: int(probe.InitialDelaySeconds),
+		PeriodSecond:       int(probe.PeriodSeconds),
+		TimeoutSecond:      int(probe.TimeoutSeconds),
+		SuccessThreshold:   int(probe.SuccessThreshold),
+		FailureThreshold:   int(probe.FailureThreshold),
+	}
+	switch {
+	case probe.Exec != nil:
+		cp.Scheme = v1alpha1.CmdProbeScheme
+		cp.Cmd = execProbeCommandLine(probe.Exec.Command)
+	case probe.HTTPGet != nil:
+		cp.Scheme = v1alpha1.HTTPProbeScheme
+		if probe.HTTPGet.Scheme == core.URISchemeHTTPS {
+			cp.Scheme = v1alpha1.HTTPSProbeScheme
+		}
+		cp.Path = probe.HTTPGet.Path
+		cp.Port = probe.HTTPGet.Port.IntValue()
+		var headers []string
+		for _, h := range probe.HTTPGet.HTTPHeaders {
+			headers = append(headers, h.Name+"="+h.Value)
+		}
+		cp.HTTPHeader = strings.Join(headers, ",")
+	case probe.TCPSocket != nil:
+		cp.Scheme = v1alpha1.TCPProbeScheme
+		cp.Port = probe.TCPSocket.Port.IntValue()
+	}
+	return cp
+}
+
+// kubeCommandLine the reverse of buildCommand, the $(NAME) references expanded by kubelet become ${NAME}
+func kubeCommandLine(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		var sb, literal strings.Builder
+		flush := func() {
+			if literal.Len() > 0 {
+				sb.WriteString(util.QuoteShellWord(literal.String()))
+				literal.Reset()
+			}
+		}
+		for i := 0; i < len(word); i++ {
+			if word[i] == '$' && i+1 < len(word) {
+				if word[i+1] == '$' {
+					literal.WriteByte('$')
+					i++
+					continue
+				}
+				if word[i+1] == '(' {
+					if end := strings.IndexByte(word[i:], ')'); end > 0 && kubeEnvReferenceRegexp.MatchString(word[i+2:i+end]) {
+						flush()
+						sb.WriteString(`"${` + word[i+2:i+end] + `}"`)
+						i += end
+						continue
+					}
+				}
+			}
+			literal.WriteByte(word[i])
+		}
+		flush()
+		if sb.Len() == 0 {
+			sb.WriteString("''")
+		}
+		quoted = append(quoted, sb.String())
+	}
+	return strings.Join(quoted, " ")
+}
+
+// execProbeCommandLine the reverse of buildExecProbeCommand
+func execProbeCommandLine(command []string) string {
+	if len(command) == 3 && command[0] == "/bin/sh" && command[1] == "-c" {
+		var reference bool
+		mapper := util.ShellWordsMapper{Reference: func(name string) string {
+			reference = true
+			return name
+		}}
+		if _, err := mapper.Split(command[2]); err != nil || reference {
+			return command[2]
+		}
+	}
+	return util.JoinShellWords(command)
+}
+
+func claimCapacity(claim *core.PersistentVolumeClaim) int {
+	if storage, ok := claim.Spec.Resources.Requests[core.ResourceStorage]; ok {
+		return int(storage.Value() / (1024 * 1024 * 1024))
+	}
+	return 0
+}
+
+// fileVolumeName the name of the config file volume, the original name is not kept by the workload
+func fileVolumeName(mountPath string) string {
+	name := sanitizeName(strings.Replace(strings.Trim(mountPath, "/"), "/", "-", -1))
+	if name == "" {
+		return "config-file"
+	}
+	return name
+}
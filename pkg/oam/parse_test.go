@@ -0,0 +1,195 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParse(t *testing.T) {
+	ram := newTestRAM()
+	ram.Components[0].ServiceShareID = "mysql-share-id"
+	ram.Components[0].Cmd = `--character-set-server=utf8mb4 --init-file "$INIT_FILE"`
+	ram.Components[0].Probes = []v1alpha1.ComponentProbe{{Mode: "liveness", Scheme: "tcp", Port: 3306, PeriodSecond: 10, IsUsed: true}}
+	ram.Components[0].ServiceVolumeMapList = v1alpha1.ComponentVolumeList{
+		{VolumeName: "data", VolumeMountPath: "/var/lib/mysql", VolumeType: v1alpha1.LocalVolumeType, VolumeCapacity: 10},
+		{VolumeName: "backup", VolumeMountPath: "/backup", VolumeType: v1alpha1.ShareFileVolumeType, VolumeCapacity: 5},
+	}
+	ram.Components[1].ServiceVolumeMapList = v1alpha1.ComponentVolumeList{
+		{VolumeName: "conf", VolumeMountPath: "/etc/wp.conf", VolumeType: v1alpha1.ConfigFileVolumeType, FileConent: "debug=true"},
+	}
+	ram.Components[1].MntReleationList = []v1alpha1.ComponentShareVolume{
+		{VolumeName: "backup", VolumeMountDir: "/mnt/backup", ShareServiceUUID: "mysql-share-id"},
+	}
+	ram.Plugins = []v1alpha1.Plugin{{PluginKey: "perf", PluginName: "perf", Image: "goodrain.me/tcm"}}
+	ram.Components[1].ServicePluginConfigs = []v1alpha1.ComponentPluginConfig{{PluginKey: "perf"}}
+	ram.AppConfigGroups = []v1alpha1.AppConfigGroup{
+		{Name: "db", InjectionType: "env", ConfigItems: map[string]string{"DB_USER": "root"}, ComponentKeys: []string{"a1b2c3d4e5f6"}},
+	}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the parser accepts unstructured objects, such as the objects read from yaml
+	var objects []runtime.Object
+	for _, obj := range app.Objects() {
+		body, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := &unstructured.Unstructured{}
+		if err := json.Unmarshal(body, &u.Object); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, u)
+	}
+	parsed, report, err := NewParser(objects...).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.AppName != "wordpress" || len(parsed.Components) != 2 {
+		t.Fatalf("unexpected application %s with %d components", parsed.AppName, len(parsed.Components))
+	}
+	mysql, wordpress := parsed.Components[0], parsed.Components[1]
+	if mysql.ServiceKey != "a1b2c3d4e5f6" || mysql.DeployType != v1alpha1.StateSingletonDeployType || mysql.Image != "mysql:5.7" {
+		t.Fatalf("unexpected mysql %+v", mysql)
+	}
+	if mysql.Cmd != `--character-set-server=utf8mb4 --init-file "${INIT_FILE}"` {
+		t.Fatalf("unexpected cmd %s", mysql.Cmd)
+	}
+	if len(mysql.ServiceConnectInfoMapList) != 2 || len(mysql.Envs) != 0 || len(mysql.Ports) != 1 || mysql.Ports[0].ContainerPort != 3306 {
+		t.Fatalf("unexpected envs or ports of mysql %+v %+v %+v", mysql.ServiceConnectInfoMapList, mysql.Envs, mysql.Ports)
+	}
+	if len(mysql.Probes) != 1 || mysql.Probes[0].Mode != v1alpha1.LivenessProbeMode || mysql.Probes[0].Port != 3306 || mysql.Probes[0].PeriodSecond != 10 {
+		t.Fatalf("unexpected probes %+v", mysql.Probes)
+	}
+	volumes := map[string]v1alpha1.ComponentVolume{}
+	for _, v := range mysql.ServiceVolumeMapList {
+		volumes[v.VolumeName] = v
+	}
+	if volumes["data"].VolumeCapacity != 10 || volumes["backup"].VolumeType != v1alpha1.ShareFileVolumeType || volumes["backup"].VolumeCapacity != 5 {
+		t.Fatalf("unexpected volumes of mysql %+v", mysql.ServiceVolumeMapList)
+	}
+	if wordpress.DeployType != v1alpha1.StatelessMultipleDeployType || wordpress.ExtendMethodRule.MinNode != 2 {
+		t.Fatalf("unexpected deploy of wordpress %s %+v", wordpress.DeployType, wordpress.ExtendMethodRule)
+	}
+	if len(wordpress.DepServiceMapList) != 1 || wordpress.DepServiceMapList[0].DepServiceKey != mysql.ServiceKey {
+		t.Fatalf("unexpected dependencies %+v", wordpress.DepServiceMapList)
+	}
+	if len(wordpress.Envs) != 1 || wordpress.Envs[0].AttrName != "WORDPRESS_DB_NAME" {
+		t.Fatalf("the dependency envs must not be restored as envs: %+v", wordpress.Envs)
+	}
+	if len(wordpress.MntReleationList) != 1 || wordpress.MntReleationList[0].ShareServiceUUID != mysql.ServiceShareID || wordpress.MntReleationList[0].VolumeMountDir != "/mnt/backup" {
+		t.Fatalf("unexpected shared volumes %+v", wordpress.MntReleationList)
+	}
+	if len(wordpress.ServiceVolumeMapList) != 1 || wordpress.ServiceVolumeMapList[0].FileConent != "debug=true" {
+		t.Fatalf("unexpected config files %+v", wordpress.ServiceVolumeMapList)
+	}
+	if len(parsed.Plugins) != 1 || parsed.Plugins[0].Image != "goodrain.me/tcm" || len(wordpress.ServicePluginConfigs) != 1 {
+		t.Fatalf("unexpected plugins %+v", parsed.Plugins)
+	}
+	if len(parsed.AppConfigGroups) != 1 || parsed.AppConfigGroups[0].ConfigItems["DB_USER"] != "root" || parsed.AppConfigGroups[0].ComponentKeys[0] != mysql.ServiceKey {
+		t.Fatalf("unexpected config groups %+v", parsed.AppConfigGroups)
+	}
+	if !report.Empty() {
+		t.Fatalf("unexpected losses:\n%s", report)
+	}
+	if _, err := NewBuilder(*parsed).Build(); err != nil {
+		t.Fatalf("the parsed application can not be built: %v", err)
+	}
+}
+
+func TestParseLoss(t *testing.T) {
+	app, err := NewBuilder(newTestRAM()).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw := app.Components[1].Spec.Workload.Object.(*v1alpha2.ContainerizedWorkload)
+	cw.Spec.Containers[0].Command = []string{"/entrypoint.sh"}
+	cw.Spec.Containers[0].Environment = append(cw.Spec.Containers[0].Environment, v1alpha2.ContainerEnvVar{
+		Name:       "PASSWORD",
+		FromSecret: &v1alpha2.SecretKeySelector{Name: "secret", Key: "password"},
+	})
+	acc := &app.AppConfiguration.Spec.Components[1]
+	acc.Traits = append(acc.Traits, v1alpha2.ComponentTrait{Trait: runtime.RawExtension{Raw: []byte(`{"apiVersion":"example.com/v1","kind":"Route"}`)}})
+	_, report, err := NewParser(app.Objects()...).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]bool{}
+	for _, loss := range report.Losses {
+		paths[loss.Path] = true
+	}
+	for _, path := range []string{"spec.containers[0].command", "spec.containers[0].env[3]", "spec.components[1].traits[1]"} {
+		if !paths[path] {
+			t.Fatalf("expect loss of %s, got:\n%s", path, report)
+		}
+	}
+}
+
+func TestParseHubAndInlinedConfigGroups(t *testing.T) {
+	ram := newTestRAM()
+	mysql, wordpress := ram.Components[0], ram.Components[1]
+	mysql.AppImage = v1alpha1.ImageInfo{HubUser: "root", HubPassword: "pass"}
+	wordpress.Image = "hub.example.com/library/wordpress:5"
+	wordpress.AppImage = v1alpha1.ImageInfo{HubURL: "https://hub.example.com", HubUser: "admin", HubPassword: "secret"}
+	ram.AppConfigGroups = []v1alpha1.AppConfigGroup{
+		{Name: "site", InjectionType: "env", ConfigItems: map[string]string{"SITE_NAME": "blog"}, ComponentKeys: []string{wordpress.ServiceKey}},
+		{Name: "nginx", InjectionType: "file", ConfigItems: map[string]string{"nginx.conf": "worker_processes 1;"}, ComponentKeys: []string{wordpress.ServiceKey}},
+		{Name: "unused", InjectionType: "env", ConfigItems: map[string]string{"UNUSED": "true"}},
+	}
+	app, err := NewBuilder(ram).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, report, err := NewParser(app.Objects()...).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hub := parsed.Components[0].AppImage; hub.HubURL != "" || hub.HubUser != "root" || hub.HubPassword != "pass" {
+		t.Fatalf("unexpected hub of mysql %+v", hub)
+	}
+	if hub := parsed.Components[1].AppImage; hub.HubURL != "hub.example.com" || hub.HubUser != "admin" || hub.HubPassword != "secret" {
+		t.Fatalf("unexpected hub of wordpress %+v", hub)
+	}
+	groups := map[string]v1alpha1.AppConfigGroup{}
+	for _, group := range parsed.AppConfigGroups {
+		groups[group.Name] = group
+	}
+	if len(groups) != 2 || groups["site"].InjectionType != "env" || groups["nginx"].InjectionType != "file" || groups["nginx"].ComponentKeys[0] != wordpress.ServiceKey {
+		t.Fatalf("unexpected config groups %+v", parsed.AppConfigGroups)
+	}
+	for _, env := range parsed.Components[1].Envs {
+		if env.AttrName == "SITE_NAME" {
+			t.Fatal("the env of the config group is restored as the env of the component")
+		}
+	}
+	if len(parsed.Components[1].ServiceVolumeMapList) != 0 {
+		t.Fatalf("the config file of the config group is restored as the volume %+v", parsed.Components[1].ServiceVolumeMapList)
+	}
+	if len(report.Losses) != 1 || report.Losses[0].Object != "ConfigMap/config-group-unused" {
+		t.Fatalf("unexpected losses:\n%s", report)
+	}
+}
@@ -0,0 +1,220 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	v1alpha1 "github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+)
+
+//pluginAttr the config of a plugin on a component, one entry of ComponentPluginConfig.Attr
+type pluginAttr struct {
+	ServiceMetaType  string
+	Injection        string
+	DestServiceAlias string
+	ContainerPort    int
+	Protocol         string
+	Attrs            map[string]string
+}
+
+var pluginAttrMetaKeys = map[string]bool{
+	"service_meta_type":  true,
+	"injection":          true,
+	"dest_service_alias": true,
+	"dest_service_id":    true,
+	"dest_service_cname": true,
+	"container_port":     true,
+	"protocol":           true,
+	"service_id":         true,
+	"plugin_id":          true,
+	"build_version":      true,
+	"attrs":              true,
+}
+
+// parsePluginAttrs decodes the config entries exported with the component, the attribute values are
+// either a map or a json string in the "attrs" field, or the remaining fields of the entry.
+func parsePluginAttrs(attrs []map[string]interface{}) (re []pluginAttr) {
+	for _, attr := range attrs {
+		pa := pluginAttr{
+			ServiceMetaType:  stringValue(attr["service_meta_type"]),
+			Injection:        stringValue(attr["injection"]),
+			DestServiceAlias: stringValue(attr["dest_service_alias"]),
+			Protocol:         stringValue(attr["protocol"]),
+			Attrs:            map[string]string{},
+		}
+		if pa.ServiceMetaType == "" {
+			pa.ServiceMetaType = v1alpha1.UnDefineMetaType
+		}
+		pa.ContainerPort, _ = strconv.Atoi(stringValue(attr["container_port"]))
+		switch values := attr["attrs"].(type) {
+		case map[string]interface{}:
+			for k, v := range values {
+				pa.Attrs[k] = stringValue(v)
+			}
+		case string:
+			var m map[string]interface{}
+			if err := json.Unmarshal([]byte(values), &m); err == nil {
+				for k, v := range m {
+					pa.Attrs[k] = stringValue(v)
+				}
+			}
+		default:
+			for k, v := range attr {
+				if !pluginAttrMetaKeys[k] {
+					pa.Attrs[k] = stringValue(v)
+				}
+			}
+		}
+		re = append(re, pa)
+	}
+	return
+}
+
+func stringValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// buildPluginEnv generate the envs of a plugin sidecar from the options of its config groups,
+// the values configured on the component override the defaults. Only the groups injected by env
+// are generated. The un_define options are named <ATTR_NAME>, the upstream_port options are expanded
+// for every port of the component as <ATTR_NAME>_<PORT>, and the downstream_port options for every
+// dependent port configured on the component as <ATTR_NAME>_<DEST_ALIAS>_<PORT>.
+func buildPluginEnv(plugin v1alpha1.Plugin, pluginConfig v1alpha1.ComponentPluginConfig, com v1alpha1.Component) (re []v1alpha2.ContainerEnvVar) {
+	attrs := parsePluginAttrs(pluginConfig.Attr)
+	exists := map[string]bool{}
+	add := func(name, value string) {
+		if name == "" || exists[name] {
+			return
+		}
+		exists[name] = true
+		re = append(re, v1alpha2.ContainerEnvVar{Name: name, Value: &value})
+	}
+	for _, group := range plugin.ConfigGroups {
+		if group.Injection != "" && group.Injection != v1alpha1.EnvPluginInjection {
+			continue
+		}
+		switch group.ServiceMetaType {
+		case v1alpha1.UpstreamPortMetaType:
+			for _, port := range com.Ports {
+				attr := findPluginAttr(attrs, group.ServiceMetaType, port.ContainerPort)
+				for _, option := range group.Options {
+					if !optionSupportProtocol(option, port.Protocol) {
+						continue
+					}
+					add(fmt.Sprintf("%s_%d", option.AttrName, port.ContainerPort), pluginOptionValue(option, attr))
+				}
+			}
+		case v1alpha1.DownstreamPortMetaType:
+			for i := range attrs {
+				attr := &attrs[i]
+				if attr.ServiceMetaType != group.ServiceMetaType || attr.DestServiceAlias == "" {
+					continue
+				}
+				for _, option := range group.Options {
+					if !optionSupportProtocol(option, attr.Protocol) {
+						continue
+					}
+					add(fmt.Sprintf("%s_%s_%d", option.AttrName, envName(attr.DestServiceAlias), attr.ContainerPort), pluginOptionValue(option, attr))
+				}
+			}
+		default:
+			attr := findPluginAttr(attrs, v1alpha1.UnDefineMetaType, 0)
+			for _, option := range group.Options {
+				add(option.AttrName, pluginOptionValue(option, attr))
+			}
+		}
+	}
+	return
+}
+
+func findPluginAttr(attrs []pluginAttr, metaType string, port int) *pluginAttr {
+	for i := range attrs {
+		if attrs[i].ServiceMetaType == metaType && attrs[i].ContainerPort == port {
+			return &attrs[i]
+		}
+	}
+	return nil
+}
+
+func pluginOptionValue(option v1alpha1.PluginConfigGroupOption, attr *pluginAttr) string {
+	if attr != nil {
+		if value, ok := attr.Attrs[option.AttrName]; ok {
+			return value
+		}
+	}
+	return option.AttrDefaultValue
+}
+
+// optionSupportProtocol the protocol of the option is a comma separated list, empty means all protocols
+func optionSupportProtocol(option v1alpha1.PluginConfigGroupOption, protocol string) bool {
+	if option.Protocol == "" || protocol == "" {
+		return true
+	}
+	for _, p := range strings.Split(option.Protocol, ",") {
+		if strings.EqualFold(strings.TrimSpace(p), protocol) {
+			return true
+		}
+	}
+	return false
+}
+
+func envName(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// pluginNeedPath a sidecar only mounts the volumes of the component that its config points into
+func pluginNeedPath(envs []v1alpha2.ContainerEnvVar, path string) bool {
+	if path == "" {
+		return false
+	}
+	path = strings.TrimSuffix(path, "/")
+	for _, env := range envs {
+		if env.Value == nil {
+			continue
+		}
+		value := strings.TrimSuffix(*env.Value, "/")
+		if value == path || strings.HasPrefix(value, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func pluginContainerName(plugin v1alpha1.Plugin) string {
+	for _, name := range []string{plugin.PluginName, plugin.PluginAlias, plugin.PluginKey} {
+		if name = sanitizeName(name); name != "" {
+			return name
+		}
+	}
+	return "plugin"
+}
@@ -0,0 +1,103 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"strings"
+
+	v1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	v1alpha1 "github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// findProbe the probe of the mode, the probes disabled by rainbond are not rendered
+func findProbe(probes []v1alpha1.ComponentProbe, mode v1alpha1.ProbeMode) *v1alpha1.ComponentProbe {
+	for i := range probes {
+		if probes[i].IsUsed && v1alpha1.ParseProbeMode(string(probes[i].Mode)) == mode {
+			return &probes[i]
+		}
+	}
+	return nil
+}
+
+func probeScheme(probe *v1alpha1.ComponentProbe) v1alpha1.ProbeScheme {
+	scheme := v1alpha1.ParseProbeScheme(string(probe.Scheme))
+	if scheme == "" && strings.TrimSpace(probe.Cmd) != "" {
+		return v1alpha1.CmdProbeScheme
+	}
+	return scheme
+}
+
+// buildProbe the container health probe of oam has no startup probe and no scheme for the http request,
+// the https and grpc probes are checked by tcp connection.
+func buildProbe(probes []v1alpha1.ComponentProbe, mode v1alpha1.ProbeMode) *v1alpha2.ContainerHealthProbe {
+	probe := findProbe(probes, mode)
+	if probe == nil {
+		return nil
+	}
+	hp := &v1alpha2.ContainerHealthProbe{
+		InitialDelaySeconds: Int32(probe.InitialDelaySecond),
+		PeriodSeconds:       Int32(probe.PeriodSecond),
+		TimeoutSeconds:      Int32(probe.TimeoutSecond),
+		SuccessThreshold:    Int32(probe.SuccessThreshold),
+		FailureThreshold:    Int32(probe.FailureThreshold),
+	}
+	switch probeScheme(probe) {
+	case v1alpha1.CmdProbeScheme:
+		hp.Exec = &v1alpha2.ExecProbe{Command: buildExecProbeCommand(probe.Cmd)}
+	case v1alpha1.HTTPProbeScheme:
+		hp.HTTPGet = &v1alpha2.HTTPGetProbe{Path: probe.Path, Port: int32(probe.Port)}
+		headers, _ := v1alpha1.ParseProbeHTTPHeaders(probe.HTTPHeader)
+		for _, h := range headers {
+			hp.HTTPGet.HTTPHeaders = append(hp.HTTPGet.HTTPHeaders, v1alpha2.HTTPHeader{Name: h.Name, Value: h.Value})
+		}
+	case v1alpha1.HTTPSProbeScheme, v1alpha1.TCPProbeScheme, v1alpha1.GRPCProbeScheme:
+		hp.TCPSocket = &v1alpha2.TCPSocketProbe{Port: int32(probe.Port)}
+	default:
+		return nil
+	}
+	return hp
+}
+
+// buildKubeProbe build the kubernetes probe, which supports the startup probe and the https request.
+// the grpc probe is checked by tcp connection.
+func buildKubeProbe(probes []v1alpha1.ComponentProbe, mode v1alpha1.ProbeMode) *core.Probe {
+	probe := findProbe(probes, mode)
+	if probe == nil {
+		return nil
+	}
+	kp := convertProbe(buildProbe([]v1alpha1.ComponentProbe{*probe}, mode))
+	if kp == nil {
+		return nil
+	}
+	if probeScheme(probe) == v1alpha1.HTTPSProbeScheme {
+		kp.TCPSocket = nil
+		kp.HTTPGet = &core.HTTPGetAction{
+			Path:   probe.Path,
+			Port:   intstr.FromInt(probe.Port),
+			Scheme: core.URISchemeHTTPS,
+		}
+		headers, _ := v1alpha1.ParseProbeHTTPHeaders(probe.HTTPHeader)
+		for _, h := range headers {
+			kp.HTTPGet.HTTPHeaders = append(kp.HTTPGet.HTTPHeaders, core.HTTPHeader{Name: h.Name, Value: h.Value})
+		}
+	}
+	return kp
+}
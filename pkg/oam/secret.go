@@ -0,0 +1,93 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//DockerHubRegistry registry of the images without registry host
+var DockerHubRegistry = "https://index.docker.io/v1/"
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+//NewImagePullSecret create the docker config secret of the image hub, returns nil if
+//the hub needs no credential. secrets of the same registry and credential have the same name
+func NewImagePullSecret(image string, info v1alpha1.ImageInfo) *core.Secret {
+	if info.HubUser == "" && info.HubPassword == "" {
+		return nil
+	}
+	registry := imageRegistry(image, info.HubURL)
+	config := dockerConfigJSON{
+		Auths: map[string]dockerAuth{
+			registry: {
+				Username: info.HubUser,
+				Password: info.HubPassword,
+				Auth:     base64.StdEncoding.EncodeToString([]byte(info.HubUser + ":" + info.HubPassword)),
+			},
+		},
+	}
+	body, _ := json.Marshal(config)
+	sum := sha256.Sum256([]byte(registry + "\n" + info.HubUser + "\n" + info.HubPassword))
+	return &core.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("rbd-hub-%x", sum[:5]),
+			Annotations: map[string]string{
+				"app.rainbond.io/registry": registry,
+			},
+		},
+		Type: core.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			core.DockerConfigJsonKey: body,
+		},
+	}
+}
+
+// imageRegistry the hub url is preferred, otherwise parse the registry from the image name
+func imageRegistry(image, hubURL string) string {
+	if hubURL != "" {
+		hubURL = strings.TrimPrefix(strings.TrimPrefix(hubURL, "https://"), "http://")
+		return strings.SplitN(hubURL, "/", 2)[0]
+	}
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return DockerHubRegistry
+}
@@ -0,0 +1,154 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"fmt"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//SharedVolume a volume shared between components
+type SharedVolume struct {
+	// ClaimName the name of the shared persistent volume claim
+	ClaimName string
+	// Volume the source volume defined by the owner component
+	Volume v1alpha1.ComponentVolume
+	// MountPath the mount path in the container
+	MountPath string
+	ReadOnly  bool
+	// Owned the volume is defined by the component itself, the shared claim replaces its own storage
+	Owned bool
+}
+
+// buildShareVolume resolve the volumes components mount from other components, the shared
+// volumes are provided by standalone persistent volume claims
+func (b *builder) buildShareVolume() (map[string][]SharedVolume, error) {
+	shared := make(map[string][]SharedVolume)
+	owned := make(map[string]bool)
+	for _, com := range b.ram.Components {
+		for _, mnt := range com.MntReleationList {
+			owner := b.getComponentByShareID(mnt.ShareServiceUUID)
+			if owner == nil {
+				return nil, fmt.Errorf("component %s mounts volume %s of unknown component %s", com.ServiceCname, mnt.VolumeName, mnt.ShareServiceUUID)
+			}
+			volume := getVolume(owner.ServiceVolumeMapList, mnt.VolumeName)
+			if volume == nil {
+				return nil, fmt.Errorf("component %s mounts volume %s not defined by component %s", com.ServiceCname, mnt.VolumeName, owner.ServiceCname)
+			}
+			if err := shareable(*volume); err != nil {
+				return nil, fmt.Errorf("component %s can not mount volume %s of component %s: %s", com.ServiceCname, mnt.VolumeName, owner.ServiceCname, err.Error())
+			}
+			claimName := b.names[owner.ServiceKey] + "-" + sanitizeName(volume.VolumeName)
+			readOnly := volume.AccessMode == v1alpha1.ROXAccessMode
+			shared[com.ServiceKey] = append(shared[com.ServiceKey], SharedVolume{
+				ClaimName: claimName,
+				Volume:    *volume,
+				MountPath: mnt.VolumeMountDir,
+				ReadOnly:  readOnly,
+			})
+			if volume.VolumeType == v1alpha1.ConfigFileVolumeType || owned[claimName] {
+				continue
+			}
+			owned[claimName] = true
+			shared[owner.ServiceKey] = append(shared[owner.ServiceKey], SharedVolume{
+				ClaimName: claimName,
+				Volume:    *volume,
+				MountPath: volume.VolumeMountPath,
+				ReadOnly:  readOnly,
+				Owned:     true,
+			})
+			b.addResource(b.buildSharedClaim(claimName, *volume))
+		}
+	}
+	return shared, nil
+}
+
+func (b *builder) buildSharedClaim(name string, volume v1alpha1.ComponentVolume) *core.PersistentVolumeClaim {
+	capacity := volume.VolumeCapacity
+	if capacity <= 0 {
+		capacity = DefaultVolumeCapacity
+	}
+	accessMode := core.ReadWriteMany
+	if volume.AccessMode == v1alpha1.ROXAccessMode {
+		accessMode = core.ReadOnlyMany
+	}
+	return &core.PersistentVolumeClaim{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "PersistentVolumeClaim",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: core.PersistentVolumeClaimSpec{
+			AccessModes: []core.PersistentVolumeAccessMode{accessMode},
+			Resources: core.ResourceRequirements{
+				Requests: core.ResourceList{
+					core.ResourceStorage: NewDiskQuantity(capacity),
+				},
+			},
+			StorageClassName: b.options.storageClassResolver.StorageClass(volume),
+		},
+	}
+}
+
+// shareable memory volumes and the volumes can only be mounted by one node can not be shared
+func shareable(volume v1alpha1.ComponentVolume) error {
+	switch volume.VolumeType {
+	case v1alpha1.MemoryFSVolumeType:
+		return fmt.Errorf("%s volume is not shareable", volume.VolumeType)
+	case v1alpha1.ConfigFileVolumeType:
+		return nil
+	}
+	if NewPersistentVolumeAccessMode(volume.AccessMode, volume.VolumeType) == core.ReadWriteOnce {
+		return fmt.Errorf("volume with access mode %s is not shareable", core.ReadWriteOnce)
+	}
+	return nil
+}
+
+func (b *builder) getComponentByShareID(shareID string) *v1alpha1.Component {
+	for _, com := range b.ram.Components {
+		if com.ServiceShareID == shareID {
+			return com
+		}
+	}
+	return b.getComponent(shareID)
+}
+
+func getVolume(volumes v1alpha1.ComponentVolumeList, name string) *v1alpha1.ComponentVolume {
+	for i := range volumes {
+		if volumes[i].VolumeName == name {
+			return &volumes[i]
+		}
+	}
+	return nil
+}
+
+// ownedSharedVolume the shared volume replaces the volume of the component
+func ownedSharedVolume(shared []SharedVolume, volumeName string) *SharedVolume {
+	for i := range shared {
+		if shared[i].Owned && shared[i].Volume.VolumeName == volumeName {
+			return &shared[i]
+		}
+	}
+	return nil
+}
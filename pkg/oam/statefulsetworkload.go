@@ -19,72 +19,266 @@
 package oam
 
 import (
+	"fmt"
+
 	v1alpha2 "github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
 	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
 	apps "k8s.io/api/apps/v1"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 type statefulWorkloadBuilder struct {
-	com     v1alpha1.Component
-	plugins []v1alpha1.Plugin
-	output  []v1alpha2.DataOutput
+	com       v1alpha1.Component
+	plugins   []v1alpha1.Plugin
+	output    []v1alpha2.DataOutput
+	input     []v1alpha2.DataInput
+	resources []runtime.Object
+	options   *options
+	claims    []core.PersistentVolumeClaim
+	// serviceName the name of the governing service, default is the component name
+	serviceName string
+	// standaloneClaims the persistent volumes are standalone claims instead of volume claim templates
+	standaloneClaims bool
 }
 
-func (s *statefulWorkloadBuilder) Build() runtime.RawExtension {
+func (s *statefulWorkloadBuilder) Build() (runtime.RawExtension, error) {
+	s.output = nil
+	s.input = nil
+	s.resources = nil
+	s.claims = nil
+	if s.options == nil {
+		s.options = newOptions(nil)
+	}
+	if err := diagnoseComponent(&s.com, s.plugins, s.options.diagnostics); err != nil {
+		return runtime.RawExtension{}, err
+	}
+	replicas, err := componentReplicas(&s.com)
+	if err != nil {
+		return runtime.RawExtension{}, err
+	}
+	template, err := s.buildPodTemplate()
+	if err != nil {
+		return runtime.RawExtension{}, err
+	}
+	svc := s.buildHeadlessService()
+	s.resources = append(s.resources, svc)
 	var statefulset = &apps.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apps.SchemeGroupVersion.String(),
+			Kind:       "StatefulSet",
+		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        s.com.ServiceCname,
-			Labels:      map[string]string{},
+			Name:        componentName(&s.com),
+			Labels:      s.podLabels(),
 			Annotations: map[string]string{},
 		},
 		Spec: apps.StatefulSetSpec{
-			Replicas:    Int32(s.com.ExtendMethodRule.MinNode),
-			Template:    s.buildPodTemplate(),
-			ServiceName: "",
+			Replicas:    &replicas,
+			Template:    template,
+			ServiceName: svc.GetName(),
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"name": s.com.ServiceName,
-				},
+				MatchLabels: s.podLabels(),
 			},
 			UpdateStrategy: apps.StatefulSetUpdateStrategy{
 				Type: apps.RollingUpdateStatefulSetStrategyType,
 			},
+			VolumeClaimTemplates: s.claims,
 		},
 	}
-	return runtime.RawExtension{Object: statefulset}
+	return runtime.RawExtension{Object: statefulset}, nil
 }
 
-func (s *statefulWorkloadBuilder) buildPodTemplate() core.PodTemplateSpec {
+func (s *statefulWorkloadBuilder) podLabels() map[string]string {
+	return map[string]string{
+		"name": componentName(&s.com),
+	}
+}
+
+func (s *statefulWorkloadBuilder) buildPodTemplate() (core.PodTemplateSpec, error) {
+	containers, initContainers, volumes, secrets := s.buildPodContainers()
 	var podT = core.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        s.com.ServiceCname,
-			Labels:      map[string]string{},
+			Labels:      s.podLabels(),
 			Annotations: map[string]string{},
 		},
 		Spec: core.PodSpec{
-			Volumes:          s.buildVolume(),
-			Containers:       s.buildPodContainer(),
-			InitContainers:   s.buildPodInitContainer(),
+			Volumes:          volumes,
+			Containers:       containers,
+			InitContainers:   initContainers,
 			RestartPolicy:    core.RestartPolicyAlways,
-			ImagePullSecrets: []core.LocalObjectReference{},
+			ImagePullSecrets: secrets,
+		},
+	}
+	return podT, nil
+}
+
+// buildHeadlessService the governing service of the statefulset
+func (s *statefulWorkloadBuilder) buildHeadlessService() *core.Service {
+	name := componentName(&s.com)
+	if s.serviceName != "" {
+		name = s.serviceName
+	}
+	svc := &core.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: s.podLabels(),
 		},
+		Spec: core.ServiceSpec{
+			ClusterIP:                core.ClusterIPNone,
+			Selector:                 s.podLabels(),
+			PublishNotReadyAddresses: true,
+		},
+	}
+	for _, port := range s.com.Ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, core.ServicePort{
+			Name:       portName(port.PortAlias),
+			Port:       int32(port.ContainerPort),
+			TargetPort: intstr.FromInt(port.ContainerPort),
+			Protocol:   core.Protocol(*NewTransportProtocol(port.Protocol)),
+		})
 	}
-	return podT
+	return svc
 }
 
-func (s *statefulWorkloadBuilder) buildVolume() []core.Volume {
-	return nil
+// buildPodContainers the containers are built by containerWorkloadBuilder so that
+// both workloads have the same behavior, init plugins become init containers
+func (s *statefulWorkloadBuilder) buildPodContainers() (containers, initContainers []core.Container, volumes []core.Volume, secrets []core.LocalObjectReference) {
+	cwb := &containerWorkloadBuilder{com: s.com, plugins: s.plugins, options: s.options, skipConfigGroups: true}
+	converter := newKubeContainerConverter(componentName(&s.com) + "-config")
+	sources := s.buildVolume()
+	for _, claim := range s.claims {
+		converter.Claim(claim.GetName())
+	}
+	addSecret := func(c v1alpha2.Container) {
+		if c.ImagePullSecret == nil || *c.ImagePullSecret == "" {
+			return
+		}
+		for _, secret := range secrets {
+			if secret.Name == *c.ImagePullSecret {
+				return
+			}
+		}
+		secrets = append(secrets, core.LocalObjectReference{Name: *c.ImagePullSecret})
+	}
+	main := cwb.buildMainContainer()
+	mainContainer := converter.Convert(main, sources)
+	mainContainer.LivenessProbe = buildKubeProbe(s.com.Probes, v1alpha1.LivenessProbeMode)
+	mainContainer.ReadinessProbe = buildKubeProbe(s.com.Probes, v1alpha1.ReadinessProbeMode)
+	mainContainer.StartupProbe = buildKubeProbe(s.com.Probes, v1alpha1.StartupProbeMode)
+	groupVolumes := injectKubeConfigGroups(&mainContainer, componentConfigGroups(s.options.configGroups, s.com.ServiceKey))
+	containers = append(containers, mainContainer)
+	addSecret(main)
+	for _, pluginConfig := range s.com.ServicePluginConfigs {
+		plugin := cwb.getPlugin(pluginConfig.PluginKey)
+		if plugin == nil {
+			continue
+		}
+		c := cwb.buildPluginContainer(*plugin, pluginConfig, s.com)
+		if plugin.Category == v1alpha1.InitPluginCategory {
+			initContainers = append(initContainers, converter.Convert(c, sources))
+		} else {
+			containers = append(containers, converter.Convert(c, sources))
+		}
+		addSecret(c)
+	}
+	// data output point at the connection envs of the main container
+	for _, out := range s.com.ServiceConnectInfoMapList {
+		for i, env := range containers[0].Env {
+			if env.Name == out.AttrName {
+				s.output = append(s.output, v1alpha2.DataOutput{
+					Name:      outputName(componentName(&s.com), out.AttrName),
+					FieldPath: fmt.Sprintf("spec.template.spec.containers[0].env[%d].value", i),
+				})
+				break
+			}
+		}
+	}
+	for i := range containers {
+		s.injectDependencyEnv(&containers[i], fmt.Sprintf("spec.template.spec.containers[%d]", i))
+	}
+	for i := range initContainers {
+		s.injectDependencyEnv(&initContainers[i], fmt.Sprintf("spec.template.spec.initContainers[%d]", i))
+	}
+	s.resources = append(s.resources, cwb.Resources()...)
+	if cm := converter.ConfigMap(); cm != nil {
+		s.resources = append(s.resources, cm)
+	}
+	return containers, initContainers, append(converter.Volumes(), groupVolumes...), secrets
 }
 
-func (s *statefulWorkloadBuilder) buildPodContainer() []core.Container {
-	return nil
+// buildVolume persistent volumes become volume claim templates, each replica has its own storage.
+// the standalone claims are shared by all the replicas
+func (s *statefulWorkloadBuilder) buildVolume() map[string]core.VolumeSource {
+	sources := make(map[string]core.VolumeSource)
+	for _, sv := range s.options.sharedVolumes {
+		sources[sv.ClaimName] = core.VolumeSource{
+			PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
+				ClaimName: sv.ClaimName,
+				ReadOnly:  sv.ReadOnly,
+			},
+		}
+	}
+	for _, volume := range s.com.ServiceVolumeMapList {
+		if ownedSharedVolume(s.options.sharedVolumes, volume.VolumeName) != nil {
+			continue
+		}
+		switch volume.VolumeType {
+		case v1alpha1.ConfigFileVolumeType:
+		case v1alpha1.MemoryFSVolumeType:
+			var limit resource.Quantity
+			if volume.VolumeCapacity > 0 {
+				limit = NewDiskQuantity(volume.VolumeCapacity)
+			}
+			sources[sanitizeName(volume.VolumeName)] = memoryVolumeSource(limit)
+		default:
+			// the unknown volume types are the storage types of the cluster, the storage class resolver
+			// decides their storage classes
+			claim := s.buildVolumeClaim(volume)
+			if !s.standaloneClaims {
+				s.claims = append(s.claims, claim)
+				continue
+			}
+			claim.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"}
+			claim.Name = componentName(&s.com) + "-" + sanitizeName(volume.VolumeName)
+			s.resources = append(s.resources, &claim)
+			sources[sanitizeName(volume.VolumeName)] = core.VolumeSource{
+				PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: claim.Name},
+			}
+		}
+	}
+	return sources
 }
 
-func (s *statefulWorkloadBuilder) buildPodInitContainer() []core.Container {
-	return nil
+func (s *statefulWorkloadBuilder) buildVolumeClaim(volume v1alpha1.ComponentVolume) core.PersistentVolumeClaim {
+	capacity := volume.VolumeCapacity
+	if capacity <= 0 {
+		capacity = DefaultVolumeCapacity
+	}
+	// the name of the claim template is the name of the volume mount, the volume names of rainbond
+	// may have upper case letters and underscores
+	return core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   sanitizeName(volume.VolumeName),
+			Labels: s.podLabels(),
+		},
+		Spec: core.PersistentVolumeClaimSpec{
+			AccessModes: []core.PersistentVolumeAccessMode{NewPersistentVolumeAccessMode(volume.AccessMode, volume.VolumeType)},
+			Resources: core.ResourceRequirements{
+				Requests: core.ResourceList{
+					core.ResourceStorage: NewDiskQuantity(capacity),
+				},
+			},
+			StorageClassName: s.options.storageClassResolver.StorageClass(volume),
+		},
+	}
 }
 
 func (s *statefulWorkloadBuilder) Kind() string {
@@ -94,3 +288,33 @@ func (s *statefulWorkloadBuilder) Kind() string {
 func (s *statefulWorkloadBuilder) Output() []v1alpha2.DataOutput {
 	return s.output
 }
+
+func (s *statefulWorkloadBuilder) Input() []v1alpha2.DataInput {
+	return s.input
+}
+
+// injectDependencyEnv see containerWorkloadBuilder.injectDependencyEnv
+func (s *statefulWorkloadBuilder) injectDependencyEnv(container *core.Container, path string) {
+	exists := make(map[string]bool, len(container.Env))
+	for _, env := range container.Env {
+		exists[env.Name] = true
+	}
+	for _, dep := range s.options.dependencyEnvs {
+		if exists[dep.Name] {
+			continue
+		}
+		exists[dep.Name] = true
+		env := core.EnvVar{Name: dep.Name}
+		if dep.Value != nil {
+			env.Value = *dep.Value
+			container.Env = append(container.Env, env)
+			continue
+		}
+		container.Env = append(container.Env, env)
+		s.input = appendDataInput(s.input, dep.OutputName, fmt.Sprintf("%s.env[%d].value", path, len(container.Env)-1))
+	}
+}
+
+func (s *statefulWorkloadBuilder) Resources() []runtime.Object {
+	return s.resources
+}
@@ -0,0 +1,160 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"testing"
+
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+)
+
+func TestStatefulWorkloadBuilder(t *testing.T) {
+	ram := newTestRAM()
+	com := *ram.Components[0]
+	com.Probes = []v1alpha1.ComponentProbe{{Mode: "readiness", Scheme: "tcp", Port: 3306, IsUsed: true}}
+	com.ServiceVolumeMapList = v1alpha1.ComponentVolumeList{
+		{VolumeName: "cnf", VolumeMountPath: "/etc/mysql/conf.d/my.cnf", VolumeType: v1alpha1.ConfigFileVolumeType, FileConent: "[mysqld]"},
+		{VolumeName: "tmp", VolumeMountPath: "/tmp", VolumeType: v1alpha1.MemoryFSVolumeType},
+	}
+	builder := NewWorkloadBuilder(com, nil)
+	raw, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sts := raw.Object.(*apps.StatefulSet)
+	if sts.Spec.ServiceName == "" {
+		t.Fatal("statefulset has no service name")
+	}
+	for k, v := range sts.Spec.Selector.MatchLabels {
+		if sts.Spec.Template.Labels[k] != v {
+			t.Fatalf("selector %s=%s does not match the template labels", k, v)
+		}
+	}
+	containers := sts.Spec.Template.Spec.Containers
+	if len(containers) != 1 || containers[0].Image != "mysql:5.7" {
+		t.Fatalf("unexpected containers %+v", containers)
+	}
+	if len(containers[0].Env) != 2 || len(containers[0].Ports) != 1 || containers[0].ReadinessProbe == nil {
+		t.Fatalf("main container is not complete: %+v", containers[0])
+	}
+	if len(containers[0].VolumeMounts) != 2 || len(sts.Spec.Template.Spec.Volumes) != 2 {
+		t.Fatalf("unexpected volumes %+v", sts.Spec.Template.Spec.Volumes)
+	}
+	if len(builder.Output()) != 2 || builder.Output()[0].FieldPath != "spec.template.spec.containers[0].env[0].value" {
+		t.Fatalf("unexpected data outputs %+v", builder.Output())
+	}
+	// configmap and headless service
+	if len(builder.Resources()) != 2 {
+		t.Fatalf("expect 2 resources, got %d", len(builder.Resources()))
+	}
+}
+
+func TestStatefulVolumeClaimTemplates(t *testing.T) {
+	ram := newTestRAM()
+	com := *ram.Components[0]
+	com.ServiceVolumeMapList = v1alpha1.ComponentVolumeList{
+		{VolumeName: "data", VolumeMountPath: "/var/lib/mysql", VolumeType: v1alpha1.LocalVolumeType, VolumeCapacity: 10},
+		{VolumeName: "backup", VolumeMountPath: "/backup", VolumeType: v1alpha1.ShareFileVolumeType},
+	}
+	resolver := StorageClassMap{v1alpha1.LocalVolumeType: "local-path"}
+	raw, err := NewWorkloadBuilder(com, nil, WithStorageClassResolver(resolver)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sts := raw.Object.(*apps.StatefulSet)
+	claims := sts.Spec.VolumeClaimTemplates
+	if len(claims) != 2 {
+		t.Fatalf("expect 2 volume claim templates, got %d", len(claims))
+	}
+	if claims[0].Spec.StorageClassName == nil || *claims[0].Spec.StorageClassName != "local-path" {
+		t.Fatalf("unexpected storage class %v", claims[0].Spec.StorageClassName)
+	}
+	if claims[0].Spec.AccessModes[0] != core.ReadWriteOnce || claims[1].Spec.AccessModes[0] != core.ReadWriteMany {
+		t.Fatalf("unexpected access modes %v %v", claims[0].Spec.AccessModes, claims[1].Spec.AccessModes)
+	}
+	if claims[0].Spec.Resources.Requests.Storage().String() != "10Gi" || claims[1].Spec.StorageClassName != nil {
+		t.Fatalf("unexpected claim %+v", claims[1].Spec)
+	}
+	if len(sts.Spec.Template.Spec.Volumes) != 0 {
+		t.Fatalf("claimed volumes must not be pod volumes: %+v", sts.Spec.Template.Spec.Volumes)
+	}
+}
+
+func TestStatefulVolumeClaimName(t *testing.T) {
+	ram := newTestRAM()
+	com := *ram.Components[0]
+	com.ServiceVolumeMapList = v1alpha1.ComponentVolumeList{
+		{VolumeName: "MySQL_Data", VolumeMountPath: "/var/lib/mysql", VolumeType: v1alpha1.LocalVolumeType},
+	}
+	raw, err := NewWorkloadBuilder(com, nil).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sts := raw.Object.(*apps.StatefulSet)
+	claims := sts.Spec.VolumeClaimTemplates
+	mounts := sts.Spec.Template.Spec.Containers[0].VolumeMounts
+	if len(claims) != 1 || claims[0].GetName() != "mysqldata" || len(mounts) != 1 || mounts[0].Name != claims[0].GetName() {
+		t.Fatalf("unexpected claims %+v and mounts %+v", claims, mounts)
+	}
+
+	com.ServiceVolumeMapList = append(com.ServiceVolumeMapList, v1alpha1.ComponentVolume{VolumeName: "mysql-data_", VolumeMountPath: "/data", VolumeType: v1alpha1.LocalVolumeType})
+	com.ServiceVolumeMapList[0].VolumeName = "MySQL-Data"
+	if _, err := NewWorkloadBuilder(com, nil).Build(); err == nil {
+		t.Fatal("expect error for conflicting volume names")
+	}
+}
+
+func TestStatefulProbes(t *testing.T) {
+	ram := newTestRAM()
+	com := *ram.Components[0]
+	com.Probes = []v1alpha1.ComponentProbe{
+		{Mode: "livebess", Scheme: "https", Port: 8443, Path: "/health", HTTPHeader: "Authorization=Basic a2V5==", PeriodSecond: 5, IsUsed: true},
+		{Mode: "readiness", Scheme: "tcp", Port: 3306, IsUsed: true},
+		{Mode: "startup", Scheme: "cmd", Cmd: "mysqladmin ping", IsUsed: true},
+	}
+	raw, err := NewWorkloadBuilder(com, nil).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := raw.Object.(*apps.StatefulSet).Spec.Template.Spec.Containers[0]
+	liveness := container.LivenessProbe
+	if liveness == nil || liveness.HTTPGet == nil || liveness.HTTPGet.Scheme != core.URISchemeHTTPS || liveness.PeriodSeconds != 5 {
+		t.Fatalf("unexpected liveness probe %+v", liveness)
+	}
+	if h := liveness.HTTPGet.HTTPHeaders; len(h) != 1 || h[0].Value != "Basic a2V5==" {
+		t.Fatalf("unexpected headers %+v", h)
+	}
+	if container.ReadinessProbe == nil || container.ReadinessProbe.TCPSocket == nil {
+		t.Fatalf("unexpected readiness probe %+v", container.ReadinessProbe)
+	}
+	if container.StartupProbe == nil || container.StartupProbe.Exec == nil || len(container.StartupProbe.Exec.Command) != 2 {
+		t.Fatalf("unexpected startup probe %+v", container.StartupProbe)
+	}
+	// the probes disabled by rainbond are not rendered
+	com.Probes[0].IsUsed = false
+	raw, err = NewWorkloadBuilder(com, nil).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probe := raw.Object.(*apps.StatefulSet).Spec.Template.Spec.Containers[0].LivenessProbe; probe != nil {
+		t.Fatalf("disabled liveness probe is rendered %+v", probe)
+	}
+}
@@ -0,0 +1,149 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+//StreamRouteMode how the tcp/udp routes are exposed
+type StreamRouteMode string
+
+//LoadBalancerStreamRoute expose the stream route by LoadBalancer service
+var LoadBalancerStreamRoute StreamRouteMode = "LoadBalancer"
+
+//NodePortStreamRoute expose the stream route by NodePort service
+var NodePortStreamRoute StreamRouteMode = "NodePort"
+
+//NginxConfigMapStreamRoute expose the stream route by the tcp/udp services configmap of ingress-nginx.
+//the configmaps are written whole, applying them replaces the ports other applications put in the
+//cluster-wide tcp-services and udp-services, merge them by hand when the configmaps are shared
+var NginxConfigMapStreamRoute StreamRouteMode = "NginxConfigMap"
+
+//NginxNamespace the namespace of ingress-nginx
+var NginxNamespace = "ingress-nginx"
+
+// the port range of node port services
+const (
+	minNodePort = 30000
+	maxNodePort = 32767
+)
+
+// buildStreamRoute expose the stream routes, the external port is the target port
+func (b *builder) buildStreamRoute() error {
+	var tcp, udp *core.ConfigMap
+	exposed := map[string]string{}
+	for i, route := range b.ram.IngressStreamRoutes() {
+		com := b.getComponent(route.ComponentKey)
+		if com == nil {
+			return fmt.Errorf("stream route targets unknown component %s", route.ComponentKey)
+		}
+		if !hasPort(com, int(route.Port)) {
+			return fmt.Errorf("stream route targets port %d not defined by component %s", route.Port, com.ServiceCname)
+		}
+		name := b.names[com.ServiceKey]
+		if !knownProtocols[strings.ToLower(route.Protocol)] {
+			b.options.diagnostics.Warnf(fmt.Sprintf("ingress_stream_routes[%d].protocol", i), UnknownProtocolCode, "unknown protocol %q of stream route, tcp is used", route.Protocol)
+		}
+		protocol := *NewTransportProtocol(route.Protocol)
+		key := fmt.Sprintf("%s/%d", protocol, route.Port)
+		nodePort := b.options.streamRouteMode == NodePortStreamRoute
+		if nodePort && (route.Port < minNodePort || route.Port > maxNodePort) {
+			// the node port is allocated by kubernetes, it never conflicts
+			key = ""
+		}
+		if key != "" {
+			if other, ok := exposed[key]; ok {
+				return fmt.Errorf("external port %s of component %s conflicts with component %s", key, com.ServiceCname, other)
+			}
+			exposed[key] = com.ServiceCname
+		}
+		if b.options.streamRouteMode == NginxConfigMapStreamRoute {
+			backend := fmt.Sprintf("%s/%s:%d", b.options.namespace, b.serviceName(com), route.Port)
+			if protocol == v1alpha2.TransportProtocolUDP {
+				udp = addStreamBackend(udp, "udp-services", route.Port, backend)
+			} else {
+				tcp = addStreamBackend(tcp, "tcp-services", route.Port, backend)
+			}
+			continue
+		}
+		svc := &core.Service{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "Service",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("%s-%d-%s", name, route.Port, strings.ToLower(string(protocol))),
+				Labels:      map[string]string{"name": name},
+				Annotations: map[string]string{},
+			},
+			Spec: core.ServiceSpec{
+				Type:     core.ServiceTypeLoadBalancer,
+				Selector: map[string]string{"name": name},
+				Ports: []core.ServicePort{{
+					Name:       fmt.Sprintf("%s-%d", strings.ToLower(string(protocol)), route.Port),
+					Port:       int32(route.Port),
+					TargetPort: intstr.FromInt(int(route.Port)),
+					Protocol:   core.Protocol(protocol),
+				}},
+			},
+		}
+		if nodePort {
+			svc.Spec.Type = core.ServiceTypeNodePort
+			if key != "" {
+				svc.Spec.Ports[0].NodePort = int32(route.Port)
+			}
+		} else if route.ConnectionTimeout > 0 {
+			// only the load balancers of aws support the idle timeout
+			svc.Annotations["service.beta.kubernetes.io/aws-load-balancer-connection-idle-timeout"] = fmt.Sprint(route.ConnectionTimeout)
+		}
+		b.addResource(svc)
+	}
+	if tcp != nil {
+		b.addResource(tcp)
+	}
+	if udp != nil {
+		b.addResource(udp)
+	}
+	return nil
+}
+
+func addStreamBackend(cm *core.ConfigMap, name string, port uint32, backend string) *core.ConfigMap {
+	if cm == nil {
+		cm = &core.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: NginxNamespace,
+			},
+			Data: map[string]string{},
+		}
+	}
+	cm.Data[fmt.Sprint(port)] = backend
+	return cm
+}
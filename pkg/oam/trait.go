@@ -0,0 +1,146 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package oam
+
+import (
+	"fmt"
+
+	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
+	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+//Trait trait object of the component
+type Trait struct {
+	Object runtime.Object
+	// WorkloadRefPath the field path the oam runtime sets the workload reference to
+	WorkloadRefPath string
+}
+
+//TraitBuilder build traits of the component
+type TraitBuilder interface {
+	Build(com *v1alpha1.Component) ([]Trait, error)
+}
+
+//TraitBuilderFunc function implement of TraitBuilder
+type TraitBuilderFunc func(com *v1alpha1.Component) ([]Trait, error)
+
+//Build -
+func (f TraitBuilderFunc) Build(com *v1alpha1.Component) ([]Trait, error) {
+	return f(com)
+}
+
+//NewManualScalerTraitBuilder the manual scaler trait set the initial replicas of the component
+func NewManualScalerTraitBuilder() TraitBuilder {
+	return TraitBuilderFunc(func(com *v1alpha1.Component) ([]Trait, error) {
+		replicas, err := componentReplicas(com)
+		if err != nil {
+			return nil, err
+		}
+		return []Trait{{
+			Object: &v1alpha2.ManualScalerTrait{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: v1alpha2.SchemeGroupVersion.String(),
+					Kind:       v1alpha2.ManualScalerTraitKind,
+				},
+				Spec: v1alpha2.ManualScalerTraitSpec{
+					ReplicaCount: replicas,
+				},
+			},
+			WorkloadRefPath: "spec.workloadRef",
+		}}, nil
+	})
+}
+
+//NewAutoscalerTraitBuilder the autoscaler trait is a HorizontalPodAutoscaler scales the workload between
+//min node and max node by cpu utilization, it is only created for multiple instance components
+func NewAutoscalerTraitBuilder(targetCPUUtilization int32) TraitBuilder {
+	return TraitBuilderFunc(func(com *v1alpha1.Component) ([]Trait, error) {
+		if isSingleton(com) {
+			return nil, nil
+		}
+		replicas, err := componentReplicas(com)
+		if err != nil {
+			return nil, err
+		}
+		rule := com.ExtendMethodRule
+		if int32(rule.MaxNode) <= replicas {
+			return nil, nil
+		}
+		hpa := &autoscaling.HorizontalPodAutoscaler{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: autoscaling.SchemeGroupVersion.String(),
+				Kind:       "HorizontalPodAutoscaler",
+			},
+			Spec: autoscaling.HorizontalPodAutoscalerSpec{
+				MinReplicas: &replicas,
+				MaxReplicas: int32(rule.MaxNode),
+			},
+		}
+		if targetCPUUtilization > 0 {
+			hpa.Spec.TargetCPUUtilizationPercentage = &targetCPUUtilization
+		}
+		return []Trait{{
+			Object:          hpa,
+			WorkloadRefPath: "spec.scaleTargetRef",
+		}}, nil
+	})
+}
+
+//NewScalerTraitBuilder the autoscaler trait for the components scale between min node and max node, the
+//manual scaler trait for the others. Both controllers set the replicas, only one of them is created
+func NewScalerTraitBuilder(targetCPUUtilization int32) TraitBuilder {
+	manual, auto := NewManualScalerTraitBuilder(), NewAutoscalerTraitBuilder(targetCPUUtilization)
+	return TraitBuilderFunc(func(com *v1alpha1.Component) ([]Trait, error) {
+		traits, err := auto.Build(com)
+		if err != nil || len(traits) > 0 {
+			return traits, err
+		}
+		return manual.Build(com)
+	})
+}
+
+// componentReplicas the initial replicas of the component, the extend method rule is validated
+// against the default rule. singleton components always have one replica.
+func componentReplicas(com *v1alpha1.Component) (int32, error) {
+	rule := com.ExtendMethodRule
+	def := v1alpha1.DefaultExtendMethodRule()
+	if rule.MinNode == 0 {
+		rule.MinNode = def.MinNode
+	}
+	if rule.MinNode < def.MinNode || rule.MinNode > def.MaxNode {
+		return 0, fmt.Errorf("min node %d of component %s is out of range [%d, %d]", rule.MinNode, com.ServiceCname, def.MinNode, def.MaxNode)
+	}
+	if rule.MaxNode > def.MaxNode || rule.MaxNode < 0 {
+		return 0, fmt.Errorf("max node %d of component %s is out of range [%d, %d]", rule.MaxNode, com.ServiceCname, def.MinNode, def.MaxNode)
+	}
+	if rule.MaxNode != 0 && rule.MaxNode < rule.MinNode {
+		return 0, fmt.Errorf("max node %d of component %s is less than min node %d", rule.MaxNode, com.ServiceCname, rule.MinNode)
+	}
+	if isSingleton(com) {
+		return 1, nil
+	}
+	return int32(rule.MinNode), nil
+}
+
+func isSingleton(com *v1alpha1.Component) bool {
+	return com.DeployType == v1alpha1.StateSingletonDeployType || com.DeployType == v1alpha1.StatelessSingletionDeployType
+}
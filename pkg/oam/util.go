@@ -19,41 +19,63 @@
 package oam
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 
 	"github.com/crossplane/oam-kubernetes-runtime/apis/core/v1alpha2"
 	"github.com/goodrain/rainbond-oam/pkg/ram/v1alpha1"
 
-	"github.com/sirupsen/logrus"
-
+	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
 )
 
-//NewMemoryQuantity new memory quantity
-func NewMemoryQuantity(memory int) resource.Quantity {
-	rq, err := resource.ParseQuantity(fmt.Sprintf("%dMi", memory))
-	if err != nil {
-		logrus.Warningf("parse memory quantity failure %s", err.Error())
+//DefaultVolumeCapacity the capacity(GB) of volume claims whose volume capacity is not limited
+var DefaultVolumeCapacity = 1
+
+//ParseMemoryQuantity parse memory(MB) quantity, the memory can not be negative
+func ParseMemoryQuantity(memory int) (resource.Quantity, error) {
+	if memory < 0 {
+		return resource.Quantity{}, fmt.Errorf("memory %d can not be negative", memory)
 	}
+	return resource.ParseQuantity(fmt.Sprintf("%dMi", memory))
+}
+
+//ParseCPUQuantity parse cpu(core) quantity, the cpu can not be negative
+func ParseCPUQuantity(cpu int) (resource.Quantity, error) {
+	if cpu < 0 {
+		return resource.Quantity{}, fmt.Errorf("cpu %d can not be negative", cpu)
+	}
+	return resource.ParseQuantity(fmt.Sprintf("%d", cpu))
+}
+
+//ParseDiskQuantity parse disk(GB) quantity, the disk can not be negative
+func ParseDiskQuantity(disk int) (resource.Quantity, error) {
+	if disk < 0 {
+		return resource.Quantity{}, fmt.Errorf("disk capacity %d can not be negative", disk)
+	}
+	return resource.ParseQuantity(fmt.Sprintf("%dGi", disk))
+}
+
+//NewMemoryQuantity new memory quantity, it is zero if the memory is invalid
+func NewMemoryQuantity(memory int) resource.Quantity {
+	rq, _ := ParseMemoryQuantity(memory)
 	return rq
 }
 
-//NewCPUQuantity new cpu quantity
+//NewCPUQuantity new cpu quantity, it is zero if the cpu is invalid
 func NewCPUQuantity(cpu int) resource.Quantity {
-	rq, err := resource.ParseQuantity(fmt.Sprintf("%d", cpu))
-	if err != nil {
-		logrus.Warningf("parse cpu quantity failure %s", err.Error())
-	}
+	rq, _ := ParseCPUQuantity(cpu)
 	return rq
 }
 
-//NewDiskQuantity new disk quantity
+//NewDiskQuantity new disk quantity, it is zero if the disk is invalid
 func NewDiskQuantity(disk int) resource.Quantity {
-	rq, err := resource.ParseQuantity(fmt.Sprintf("%dGi", disk))
-	if err != nil {
-		logrus.Warningf("parse cpu quantity failure %s", err.Error())
-	}
+	rq, _ := ParseDiskQuantity(disk)
 	return rq
 }
 
@@ -73,20 +95,45 @@ func NewVolumeAccess(va v1alpha1.AccessMode) *v1alpha2.VolumeAccessMode {
 	}
 }
 
-//NewSharingPolicy new sharing policy
+//NewPersistentVolumeAccessMode new kubernetes volume access mode, the volume type decides
+//the access mode if it is not specified
+func NewPersistentVolumeAccessMode(va v1alpha1.AccessMode, vt v1alpha1.VolumeType) core.PersistentVolumeAccessMode {
+	switch va {
+	case v1alpha1.ROXAccessMode:
+		return core.ReadOnlyMany
+	case v1alpha1.RWOAccessMode:
+		return core.ReadWriteOnce
+	case v1alpha1.RWXAccessMode:
+		return core.ReadWriteMany
+	}
+	if vt == v1alpha1.ShareFileVolumeType {
+		return core.ReadWriteMany
+	}
+	return core.ReadWriteOnce
+}
+
+//NewSharingPolicy new sharing policy, the policy is case insensitive and the unknown policy is shared
 func NewSharingPolicy(sp string) *v1alpha2.VolumeSharingPolicy {
 	var share = v1alpha2.VolumeSharingPolicyShared
 	var exclusive = v1alpha2.VolumeSharingPolicyExclusive
-	switch sp {
-	case "Shared":
+	switch strings.ToLower(sp) {
+	case "shared":
 		return &share
-	case "Exclusive":
+	case "exclusive":
 		return &exclusive
 	default:
 		return &share
 	}
 }
 
+func knownSharingPolicy(sp string) bool {
+	switch strings.ToLower(sp) {
+	case "shared", "exclusive":
+		return true
+	}
+	return false
+}
+
 //NewTransportProtocol -
 func NewTransportProtocol(protocol string) *v1alpha2.TransportProtocol {
 	var udp = v1alpha2.TransportProtocolUDP
@@ -99,6 +146,30 @@ func NewTransportProtocol(protocol string) *v1alpha2.TransportProtocol {
 	}
 }
 
+//outputName data output names are unique in the application, so the component name is the prefix
+func outputName(component, env string) string {
+	return component + "-" + env
+}
+
+// appendDataInput add the field path to the data input of the output
+func appendDataInput(inputs []v1alpha2.DataInput, output, path string) []v1alpha2.DataInput {
+	for i := range inputs {
+		if inputs[i].ValueFrom.DataOutputName == output {
+			inputs[i].ToFieldPaths = append(inputs[i].ToFieldPaths, path)
+			return inputs
+		}
+	}
+	return append(inputs, v1alpha2.DataInput{
+		ValueFrom:    v1alpha2.DataInputValueFrom{DataOutputName: output},
+		ToFieldPaths: []string{path},
+	})
+}
+
+//portName port name is the lower case port alias
+func portName(alias string) string {
+	return strings.ToLower(alias)
+}
+
 //Uint32 -
 func Uint32(s int) *uint32 {
 	var ss = uint32(s)
@@ -110,3 +181,94 @@ func Int32(s int) *int32 {
 	var ss = int32(s)
 	return &ss
 }
+
+//componentName return the kubernetes resource name of the component.
+//service alias is preferred, the service key is used if no valid name is set
+func componentName(com *v1alpha1.Component) string {
+	for _, name := range []string{com.ServiceAlias, com.ServiceName} {
+		if name != "" && len(validation.IsDNS1123Label(name)) == 0 {
+			return name
+		}
+	}
+	key := sanitizeName(com.ServiceKey)
+	if len(key) > 6 {
+		key = key[:6]
+	}
+	return "gr" + key
+}
+
+//appName return the kubernetes resource name of the application
+func appName(ram *v1alpha1.RainbondApplicationConfig) string {
+	if ram.AppName != "" && len(validation.IsDNS1123Label(ram.AppName)) == 0 {
+		return ram.AppName
+	}
+	key := sanitizeName(ram.AppKeyID)
+	if len(key) > 8 {
+		key = key[:8]
+	}
+	return strings.TrimSuffix("app-"+key, "-")
+}
+
+// sanitizeName lower the name and drop the characters that are invalid in dns-1123 label
+func sanitizeName(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			sb.WriteRune(r)
+		}
+	}
+	return strings.Trim(sb.String(), "-")
+}
+
+//MarshalObjects marshal the objects as multi-document yaml, the status and the empty creation timestamps are dropped
+func MarshalObjects(objects []runtime.Object) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, obj := range objects {
+		content, err := toUnstructuredContent(obj)
+		if err != nil {
+			return nil, err
+		}
+		body, err := yaml.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(body)
+	}
+	return buf.Bytes(), nil
+}
+
+// toUnstructuredContent the content of the object without the status and the empty creation timestamps
+func toUnstructuredContent(obj runtime.Object) (map[string]interface{}, error) {
+	var content map[string]interface{}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		content = runtime.DeepCopyJSON(u.Object)
+	} else {
+		var err error
+		content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	delete(content, "status")
+	dropNullTimestamps(content)
+	return content, nil
+}
+
+func dropNullTimestamps(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ts, ok := v["creationTimestamp"]; ok && ts == nil {
+			delete(v, "creationTimestamp")
+		}
+		for _, item := range v {
+			dropNullTimestamps(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			dropNullTimestamps(item)
+		}
+	}
+}
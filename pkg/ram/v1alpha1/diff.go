@@ -0,0 +1,454 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//ChangeType the type of the change
+type ChangeType string
+
+//AddedChange the item only exists in the new config
+var AddedChange ChangeType = "added"
+
+//RemovedChange the item only exists in the old config
+var RemovedChange ChangeType = "removed"
+
+//ModifiedChange the item or the value exists in both configs and is changed
+var ModifiedChange ChangeType = "modified"
+
+//Change a changed value, the path points at the field with the json names, the items of the lists
+//are keyed by what matches them, such as service_env_map_list[MYSQL_HOST].attr_value
+type Change struct {
+	Type ChangeType  `json:"type"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+//ObjectDiff the changes of a component, a plugin, a route or a config group matched by the key
+type ObjectDiff struct {
+	Type ChangeType `json:"type"`
+	Key  string     `json:"key"`
+	Name string     `json:"name"`
+	// Changes the changed fields of the modified object
+	Changes []Change `json:"changes,omitempty"`
+}
+
+//ApplicationDiff the changes between two versions of the application config. The components are
+//matched by the service key, the plugins by the plugin key, the routes by the target component and
+//port, the config groups by the name.
+type ApplicationDiff struct {
+	OldVersion   string       `json:"old_version"`
+	NewVersion   string       `json:"new_version"`
+	Changes      []Change     `json:"changes,omitempty"`
+	Components   []ObjectDiff `json:"components,omitempty"`
+	Plugins      []ObjectDiff `json:"plugins,omitempty"`
+	HTTPRoutes   []ObjectDiff `json:"ingress_http_routes,omitempty"`
+	StreamRoutes []ObjectDiff `json:"ingress_stream_routes,omitempty"`
+	ConfigGroups []ObjectDiff `json:"app_config_groups,omitempty"`
+}
+
+// the ids of the source platform and the credentials are not compared
+var diffIgnoredFields = map[string]bool{
+	"ID":            true,
+	"service_id":    true,
+	"probe_id":      true,
+	"tenant_id":     true,
+	"plugin_id":     true,
+	"create_time":   true,
+	"build_version": true,
+	"hub_password":  true,
+}
+
+//Diff the changes from the old config to the new config, nil is an empty config
+func Diff(old, new *RainbondApplicationConfig) *ApplicationDiff {
+	if old == nil {
+		old = &RainbondApplicationConfig{}
+	}
+	if new == nil {
+		new = &RainbondApplicationConfig{}
+	}
+	d := &ApplicationDiff{OldVersion: old.AppVersion, NewVersion: new.AppVersion}
+	d.Changes = append(d.Changes, diffValue("group_name", old.AppName, new.AppName)...)
+	d.Changes = append(d.Changes, diffValue("template_version", old.TempleteVersion, new.TempleteVersion)...)
+
+	oldComs, newComs := map[string]*Component{}, map[string]*Component{}
+	var oldItems, newItems []diffItem
+	for _, com := range old.Components {
+		if com != nil {
+			oldComs[com.ServiceKey] = com
+			oldItems = append(oldItems, diffItem{key: com.ServiceKey, name: com.ServiceCname, value: com})
+		}
+	}
+	for _, com := range new.Components {
+		if com != nil {
+			newComs[com.ServiceKey] = com
+			newItems = append(newItems, diffItem{key: com.ServiceKey, name: com.ServiceCname, value: com})
+		}
+	}
+	d.Components = diffObjects(oldItems, newItems, func(o, n interface{}) []Change {
+		return diffComponent(o.(*Component), n.(*Component))
+	})
+
+	oldItems, newItems = nil, nil
+	for i := range old.Plugins {
+		oldItems = append(oldItems, diffItem{key: old.Plugins[i].PluginKey, name: old.Plugins[i].PluginName, value: old.Plugins[i]})
+	}
+	for i := range new.Plugins {
+		newItems = append(newItems, diffItem{key: new.Plugins[i].PluginKey, name: new.Plugins[i].PluginName, value: new.Plugins[i]})
+	}
+	d.Plugins = diffObjects(oldItems, newItems, func(o, n interface{}) []Change {
+		return diffValue("", o, n)
+	})
+
+	routeItem := func(coms map[string]*Component, target TargetComponent, route interface{}) diffItem {
+		name := target.ComponentKey
+		if com := coms[target.ComponentKey]; com != nil {
+			name = com.ServiceCname
+		}
+		return diffItem{key: fmt.Sprintf("%s:%d", target.ComponentKey, target.Port), name: fmt.Sprintf("%s:%d", name, target.Port), value: route}
+	}
+	diffRoute := func(o, n interface{}) []Change {
+		var changes []Change
+		for _, c := range diffValue("", o, n) {
+			// the target matches the routes
+			if c.Path != "component_key" && c.Path != "port" {
+				changes = append(changes, c)
+			}
+		}
+		return changes
+	}
+	oldItems, newItems = nil, nil
+	for _, route := range old.IngressHTTPRoutes {
+		oldItems = append(oldItems, routeItem(oldComs, route.TargetComponent, route))
+	}
+	for _, route := range new.IngressHTTPRoutes {
+		newItems = append(newItems, routeItem(newComs, route.TargetComponent, route))
+	}
+	d.HTTPRoutes = diffObjects(oldItems, newItems, diffRoute)
+	oldItems, newItems = nil, nil
+	for _, route := range old.IngressStreamRoutes() {
+		oldItems = append(oldItems, routeItem(oldComs, route.TargetComponent, route))
+	}
+	for _, route := range new.IngressStreamRoutes() {
+		newItems = append(newItems, routeItem(newComs, route.TargetComponent, route))
+	}
+	d.StreamRoutes = diffObjects(oldItems, newItems, diffRoute)
+
+	oldItems, newItems = nil, nil
+	for _, group := range old.AppConfigGroups {
+		oldItems = append(oldItems, diffItem{key: group.Name, name: group.Name, value: group})
+	}
+	for _, group := range new.AppConfigGroups {
+		newItems = append(newItems, diffItem{key: group.Name, name: group.Name, value: group})
+	}
+	d.ConfigGroups = diffObjects(oldItems, newItems, func(o, n interface{}) []Change {
+		og, ng := o.(AppConfigGroup), n.(AppConfigGroup)
+		changes := diffValue("injection_type", og.InjectionType, ng.InjectionType)
+		changes = append(changes, diffStringMap("config_items", og.ConfigItems, ng.ConfigItems)...)
+		return append(changes, diffList("component_keys", og.ComponentKeys, ng.ComponentKeys, func(v interface{}) string {
+			return v.(string)
+		})...)
+	})
+	return d
+}
+
+// diffComponent the changes of the fields of the component, the lists are matched by the keys of the items
+func diffComponent(old, new *Component) []Change {
+	var changes []Change
+	for _, field := range []struct {
+		path     string
+		old, new interface{}
+	}{
+		{"service_cname", old.ServiceCname, new.ServiceCname},
+		{"image", old.Image, new.Image},
+		{"cmd", old.Cmd, new.Cmd},
+		{"memory", old.Memory, new.Memory},
+		{"cpu", old.CPU, new.CPU},
+		{"extend_method", old.DeployType, new.DeployType},
+		{"extend_method_map", old.ExtendMethodRule, new.ExtendMethodRule},
+	} {
+		changes = append(changes, diffValue(field.path, field.old, field.new)...)
+	}
+	envKey := func(v interface{}) string { return v.(ComponentEnv).AttrName }
+	changes = append(changes, diffList("service_env_map_list", old.Envs, new.Envs, envKey)...)
+	changes = append(changes, diffList("service_connect_info_map_list", old.ServiceConnectInfoMapList, new.ServiceConnectInfoMapList, envKey)...)
+	changes = append(changes, diffList("port_map_list", old.Ports, new.Ports, func(v interface{}) string {
+		return fmt.Sprint(v.(ComponentPort).ContainerPort)
+	})...)
+	changes = append(changes, diffList("service_volume_map_list", old.ServiceVolumeMapList, new.ServiceVolumeMapList, func(v interface{}) string {
+		return v.(ComponentVolume).VolumeName
+	})...)
+	changes = append(changes, diffList("mnt_relation_list", old.MntReleationList, new.MntReleationList, func(v interface{}) string {
+		mnt := v.(ComponentShareVolume)
+		return mnt.ShareServiceUUID + "/" + mnt.VolumeName
+	})...)
+	changes = append(changes, diffList("probes", old.Probes, new.Probes, func(v interface{}) string {
+		return string(ParseProbeMode(string(v.(ComponentProbe).Mode)))
+	})...)
+	changes = append(changes, diffList("dep_service_map_list", old.DepServiceMapList, new.DepServiceMapList, func(v interface{}) string {
+		return v.(ComponentDep).DepServiceKey
+	})...)
+	changes = append(changes, diffList("service_related_plugin_config", old.ServicePluginConfigs, new.ServicePluginConfigs, func(v interface{}) string {
+		return v.(ComponentPluginConfig).PluginKey
+	})...)
+	changes = append(changes, diffList("component_monitor", old.ComponentMonitor, new.ComponentMonitor, func(v interface{}) string {
+		return v.(ComponentMonitor).Name
+	})...)
+	return changes
+}
+
+type diffItem struct {
+	key   string
+	name  string
+	value interface{}
+}
+
+// diffObjects the removed and the modified objects in the old order, then the added objects in the new order.
+// The objects of the same key are matched in order.
+func diffObjects(old, new []diffItem, diff func(old, new interface{}) []Change) []ObjectDiff {
+	uniqueKeys(old)
+	uniqueKeys(new)
+	newIndex := make(map[string]int, len(new))
+	for i, item := range new {
+		newIndex[item.key] = i
+	}
+	matched := map[string]bool{}
+	var diffs []ObjectDiff
+	for _, o := range old {
+		i, ok := newIndex[o.key]
+		if !ok {
+			diffs = append(diffs, ObjectDiff{Type: RemovedChange, Key: o.key, Name: o.name})
+			continue
+		}
+		matched[o.key] = true
+		if changes := diff(o.value, new[i].value); len(changes) > 0 {
+			diffs = append(diffs, ObjectDiff{Type: ModifiedChange, Key: o.key, Name: new[i].name, Changes: changes})
+		}
+	}
+	for _, n := range new {
+		if !matched[n.key] {
+			diffs = append(diffs, ObjectDiff{Type: AddedChange, Key: n.key, Name: n.name})
+		}
+	}
+	return diffs
+}
+
+// uniqueKeys the duplicate keys are suffixed by the occurrence, such as mysql:3306#2
+func uniqueKeys(items []diffItem) {
+	seen := map[string]int{}
+	for i := range items {
+		seen[items[i].key]++
+		if n := seen[items[i].key]; n > 1 {
+			items[i].key = fmt.Sprintf("%s#%d", items[i].key, n)
+		}
+	}
+}
+
+// diffList the items of the slices are matched by the key, the added and the removed items are
+// reported as a whole, the modified items are reported field by field
+func diffList(path string, old, new interface{}, key func(v interface{}) string) []Change {
+	var oldItems, newItems []diffItem
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := 0; i < ov.Len(); i++ {
+		item := ov.Index(i).Interface()
+		oldItems = append(oldItems, diffItem{key: key(item), value: item})
+	}
+	for i := 0; i < nv.Len(); i++ {
+		item := nv.Index(i).Interface()
+		newItems = append(newItems, diffItem{key: key(item), value: item})
+	}
+	var changes []Change
+	for _, d := range diffObjects(oldItems, newItems, func(o, n interface{}) []Change { return diffValue("", o, n) }) {
+		itemPath := fmt.Sprintf("%s[%s]", path, d.Key)
+		switch d.Type {
+		case AddedChange:
+			changes = append(changes, Change{Type: AddedChange, Path: itemPath, New: listItem(newItems, d.Key)})
+		case RemovedChange:
+			changes = append(changes, Change{Type: RemovedChange, Path: itemPath, Old: listItem(oldItems, d.Key)})
+		default:
+			for _, c := range d.Changes {
+				c.Path = joinDiffPath(itemPath, c.Path)
+				changes = append(changes, c)
+			}
+		}
+	}
+	return changes
+}
+
+func listItem(items []diffItem, key string) interface{} {
+	for _, item := range items {
+		if item.key == key {
+			return item.value
+		}
+	}
+	return nil
+}
+
+func diffStringMap(path string, old, new map[string]string) []Change {
+	keys := map[string]bool{}
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	var changes []Change
+	for _, k := range sorted {
+		ov, inOld := old[k]
+		nv, inNew := new[k]
+		itemPath := fmt.Sprintf("%s[%s]", path, k)
+		switch {
+		case !inOld:
+			changes = append(changes, Change{Type: AddedChange, Path: itemPath, New: nv})
+		case !inNew:
+			changes = append(changes, Change{Type: RemovedChange, Path: itemPath, Old: ov})
+		case ov != nv:
+			changes = append(changes, Change{Type: ModifiedChange, Path: itemPath, Old: ov, New: nv})
+		}
+	}
+	return changes
+}
+
+// diffValue the structs are compared field by field, the other values are compared as a whole.
+// The empty slices and maps equal to nil.
+func diffValue(path string, old, new interface{}) []Change {
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	if ov.IsValid() && nv.IsValid() && ov.Type() == nv.Type() {
+		switch ov.Kind() {
+		case reflect.Struct:
+			var changes []Change
+			t := ov.Type()
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				name := strings.Split(field.Tag.Get("json"), ",")[0]
+				if field.PkgPath != "" || name == "-" || diffIgnoredFields[name] {
+					continue
+				}
+				fieldPath := path
+				// the fields of the embedded struct are the fields of the struct
+				if !field.Anonymous || name != "" {
+					if name == "" {
+						name = field.Name
+					}
+					fieldPath = joinDiffPath(path, name)
+				}
+				changes = append(changes, diffValue(fieldPath, ov.Field(i).Interface(), nv.Field(i).Interface())...)
+			}
+			return changes
+		case reflect.Slice, reflect.Map:
+			if ov.Len() == 0 && nv.Len() == 0 {
+				return nil
+			}
+		}
+	}
+	if reflect.DeepEqual(old, new) {
+		return nil
+	}
+	return []Change{{Type: ModifiedChange, Path: path, Old: old, New: new}}
+}
+
+func joinDiffPath(prefix, path string) string {
+	switch {
+	case prefix == "":
+		return path
+	case path == "":
+		return prefix
+	default:
+		return prefix + "." + path
+	}
+}
+
+//Empty whether there is no change
+func (d *ApplicationDiff) Empty() bool {
+	return len(d.Changes) == 0 && len(d.Components) == 0 && len(d.Plugins) == 0 && len(d.HTTPRoutes) == 0 &&
+		len(d.StreamRoutes) == 0 && len(d.ConfigGroups) == 0
+}
+
+//JSON return json string
+func (d *ApplicationDiff) JSON() string {
+	body, _ := json.Marshal(d)
+	return string(body)
+}
+
+// the marks of the change types in the text
+var changeMarks = map[ChangeType]string{AddedChange: "+", RemovedChange: "-", ModifiedChange: "~"}
+
+//String the human-readable text, one line for each change: + added, - removed, ~ modified
+func (d *ApplicationDiff) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "version %s -> %s\n", d.OldVersion, d.NewVersion)
+	if d.Empty() {
+		sb.WriteString("no changes\n")
+		return sb.String()
+	}
+	writeChanges(&sb, "", d.Changes)
+	for _, section := range []struct {
+		kind  string
+		diffs []ObjectDiff
+	}{
+		{"component", d.Components},
+		{"plugin", d.Plugins},
+		{"http route", d.HTTPRoutes},
+		{"stream route", d.StreamRoutes},
+		{"config group", d.ConfigGroups},
+	} {
+		for _, od := range section.diffs {
+			fmt.Fprintf(&sb, "%s %s %s", changeMarks[od.Type], section.kind, od.Name)
+			if od.Key != od.Name {
+				fmt.Fprintf(&sb, " (%s)", od.Key)
+			}
+			sb.WriteString("\n")
+			writeChanges(&sb, "    ", od.Changes)
+		}
+	}
+	return sb.String()
+}
+
+func writeChanges(sb *strings.Builder, indent string, changes []Change) {
+	for _, c := range changes {
+		fmt.Fprintf(sb, "%s%s %s", indent, changeMarks[c.Type], c.Path)
+		if c.Type == ModifiedChange {
+			fmt.Fprintf(sb, ": %s -> %s", diffText(c.Old), diffText(c.New))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// diffText the values are written as json, so that the empty and the multiline strings are readable
+func diffText(v interface{}) string {
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,125 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newDiffTestConfig() *RainbondApplicationConfig {
+	ram := newValidationTestConfig()
+	ram.AppName = "wordpress"
+	ram.AppVersion = "1.0"
+	mysql, wordpress := ram.Components[0], ram.Components[1]
+	mysql.Image = "mysql:5.7"
+	mysql.Probes = []ComponentProbe{{ID: 1, Mode: LivenessProbeMode, Scheme: TCPProbeScheme, Port: 3306}}
+	wordpress.Image = "wordpress:5"
+	wordpress.Envs = []ComponentEnv{{AttrName: "WORDPRESS_DB_NAME", AttrValue: "wordpress"}}
+	ram.Components = append(ram.Components, &Component{ServiceKey: "memcached", ServiceCname: "Memcached"})
+	ram.Plugins[0].PluginName = "log"
+	ram.Plugins[0].Image = "log:1"
+	ram.IngressSreamRoutes = []IngressStreamRoute{{Protocol: "tcp", TargetComponent: TargetComponent{ComponentKey: "mysql", Port: 3306}}}
+	ram.AppConfigGroups = []AppConfigGroup{{Name: "db", InjectionType: "env", ConfigItems: map[string]string{"DB_USER": "root"}, ComponentKeys: []string{"wordpress"}}}
+	return ram
+}
+
+func TestDiff(t *testing.T) {
+	old := newDiffTestConfig()
+	if d := Diff(old, newDiffTestConfig()); !d.Empty() || !strings.Contains(d.String(), "no changes") {
+		t.Fatalf("expect no changes, got %s", d)
+	}
+	new := newDiffTestConfig()
+	new.AppVersion = "1.1"
+	mysql, wordpress := new.Components[0], new.Components[1]
+	mysql.Image = "mysql:8.0"
+	mysql.Probes[0].ID = 2
+	mysql.Probes[0].Port = 33060
+	mysql.ServiceVolumeMapList[0].VolumeCapacity = 20
+	wordpress.Envs[0].AttrValue = "blog"
+	wordpress.Envs = append(wordpress.Envs, ComponentEnv{AttrName: "WORDPRESS_DEBUG", AttrValue: "1"})
+	wordpress.Ports = []ComponentPort{{PortAlias: "HTTPS", ContainerPort: 443}}
+	new.Components = append(new.Components[:2], &Component{ServiceKey: "redis", ServiceCname: "Redis"})
+	new.Plugins[0].Image = "log:2"
+	new.IngressSreamRoutes[0].Protocol = "udp"
+	new.IngressHTTPRoutes = append(new.IngressHTTPRoutes, IngressHTTPRoute{Location: "/admin", TargetComponent: TargetComponent{ComponentKey: "wordpress", Port: 443}})
+	new.AppConfigGroups[0].ConfigItems["DB_USER"] = "wordpress"
+	new.AppConfigGroups[0].ComponentKeys = append(new.AppConfigGroups[0].ComponentKeys, "mysql")
+
+	d := Diff(old, new)
+	if d.OldVersion != "1.0" || d.NewVersion != "1.1" || len(d.Changes) != 0 {
+		t.Fatalf("unexpected application changes %+v", d)
+	}
+	paths := func(od ObjectDiff) string {
+		var ps []string
+		for _, c := range od.Changes {
+			ps = append(ps, string(c.Type)+" "+c.Path)
+		}
+		return strings.Join(ps, ", ")
+	}
+	expect := []struct {
+		diffs []ObjectDiff
+		index int
+		typ   ChangeType
+		key   string
+		paths string
+	}{
+		{d.Components, 0, ModifiedChange, "mysql", "modified image, modified service_volume_map_list[data].volume_capacity, modified probes[liveness].port"},
+		{d.Components, 1, ModifiedChange, "wordpress", "modified service_env_map_list[WORDPRESS_DB_NAME].attr_value, added service_env_map_list[WORDPRESS_DEBUG], removed port_map_list[80], added port_map_list[443]"},
+		{d.Components, 2, RemovedChange, "memcached", ""},
+		{d.Components, 3, AddedChange, "redis", ""},
+		{d.Plugins, 0, ModifiedChange, "log", "modified image"},
+		{d.HTTPRoutes, 0, AddedChange, "wordpress:443", ""},
+		{d.StreamRoutes, 0, ModifiedChange, "mysql:3306", "modified protocol"},
+		{d.ConfigGroups, 0, ModifiedChange, "db", "modified config_items[DB_USER], added component_keys[mysql]"},
+	}
+	for _, e := range expect {
+		if e.index >= len(e.diffs) {
+			t.Fatalf("expect diff of %s, got %s", e.key, d)
+		}
+		od := e.diffs[e.index]
+		if od.Type != e.typ || od.Key != e.key || paths(od) != e.paths {
+			t.Fatalf("expect %s %s [%s], got %s %s [%s]", e.typ, e.key, e.paths, od.Type, od.Key, paths(od))
+		}
+	}
+	if len(d.Components) != 4 || len(d.HTTPRoutes) != 1 {
+		t.Fatalf("unexpected diff %s", d)
+	}
+	text := d.String()
+	for _, line := range []string{
+		"version 1.0 -> 1.1\n",
+		"~ component MySQL (mysql)\n    ~ image: \"mysql:5.7\" -> \"mysql:8.0\"\n",
+		"    + service_env_map_list[WORDPRESS_DEBUG]\n",
+		"- component Memcached (memcached)\n",
+		"+ http route WordPress:443 (wordpress:443)\n",
+		"~ stream route MySQL:3306 (mysql:3306)\n    ~ protocol: \"tcp\" -> \"udp\"\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("expect %q in the text:\n%s", line, text)
+		}
+	}
+	var decoded ApplicationDiff
+	if err := json.Unmarshal([]byte(d.JSON()), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Components) != 4 || decoded.Components[0].Changes[0].New != "mysql:8.0" {
+		t.Fatalf("unexpected json %s", d.JSON())
+	}
+}
@@ -0,0 +1,287 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//LegacyTemplateVersion the version of the templates without template_version
+var LegacyTemplateVersion = "v1"
+
+//LatestTemplateVersion the latest template version the templates can be migrated to
+var LatestTemplateVersion = "v3"
+
+//MigrationFunc migrate the template decoded from the raw json, the numbers are json.Number.
+//The migration works before the template is decoded into the types, so the template in the
+//format the types can not decode is migrated.
+type MigrationFunc func(doc map[string]interface{}) error
+
+//Migration migrate the template from the version to the next version
+type Migration struct {
+	From    string
+	To      string
+	Migrate MigrationFunc
+}
+
+var migrations = struct {
+	sync.RWMutex
+	from map[string]Migration
+}{from: map[string]Migration{}}
+
+func init() {
+	RegisterMigration(Migration{From: "v1", To: "v2", Migrate: migrateV1ToV2})
+	RegisterMigration(Migration{From: "v2", To: "v3", Migrate: migrateV2ToV3})
+}
+
+//RegisterMigration register the migration, the registered migration from the same version is replaced
+func RegisterMigration(m Migration) {
+	migrations.Lock()
+	defer migrations.Unlock()
+	migrations.from[m.From] = m
+}
+
+// migrationPath the migrations from the version to the target version
+func migrationPath(from, target string) ([]Migration, error) {
+	migrations.RLock()
+	defer migrations.RUnlock()
+	var path []Migration
+	visited := map[string]bool{}
+	for version := from; version != target; {
+		m, ok := migrations.from[version]
+		if !ok || visited[version] {
+			return nil, fmt.Errorf("no migration from template version %s to %s", from, target)
+		}
+		visited[version] = true
+		path = append(path, m)
+		version = m.To
+	}
+	return path, nil
+}
+
+//TemplateVersion the template version of the raw json, it is LegacyTemplateVersion if it is not set
+func TemplateVersion(raw []byte) (string, error) {
+	var doc struct {
+		TempleteVersion string `json:"template_version"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return "", err
+	}
+	if doc.TempleteVersion == "" {
+		return LegacyTemplateVersion, nil
+	}
+	return doc.TempleteVersion, nil
+}
+
+//Migrate migrate the raw json of the template to the target version step by step, the template_version
+//is set to the version of each step. The template already in the target version is returned as it is.
+//The templates without template_version are migrated from LegacyTemplateVersion, the v1 migration
+//does not change the v2 templates written without the version.
+func Migrate(raw []byte, target string) ([]byte, error) {
+	from, err := TemplateVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+	if from == target {
+		return raw, nil
+	}
+	path, err := migrationPath(from, target)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	for _, m := range path {
+		if err := m.Migrate(doc); err != nil {
+			return nil, fmt.Errorf("migrate template from %s to %s failure %s", m.From, m.To, err.Error())
+		}
+		doc["template_version"] = m.To
+	}
+	return json.Marshal(doc)
+}
+
+//TypedMigration the migration changes the decoded config. The fields unknown to the types are kept,
+//the objects of the config are merged into the template and the arrays are merged item by item.
+func TypedMigration(migrate func(ram *RainbondApplicationConfig) error) MigrationFunc {
+	return func(doc map[string]interface{}) error {
+		body, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		var ram RainbondApplicationConfig
+		if err := json.Unmarshal(body, &ram); err != nil {
+			return err
+		}
+		if err := migrate(&ram); err != nil {
+			return err
+		}
+		if body, err = json.Marshal(&ram); err != nil {
+			return err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var typed map[string]interface{}
+		if err := decoder.Decode(&typed); err != nil {
+			return err
+		}
+		mergeJSON(doc, typed)
+		return nil
+	}
+}
+
+// mergeJSON the values of src replace the values of dst, the keys only in dst are kept
+func mergeJSON(dst, src map[string]interface{}) {
+	for key, value := range src {
+		dst[key] = mergeJSONValue(dst[key], value)
+	}
+}
+
+func mergeJSONValue(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		if d, ok := dst.(map[string]interface{}); ok {
+			mergeJSON(d, s)
+			return d
+		}
+	case []interface{}:
+		if d, ok := dst.([]interface{}); ok && len(d) == len(s) {
+			for i := range s {
+				d[i] = mergeJSONValue(d[i], s[i])
+			}
+			return d
+		}
+	}
+	return src
+}
+
+// the deploy types of v1, the stateful components could be scaled
+var legacyDeployTypes = map[string]DeployType{
+	"stateless": StatelessMultipleDeployType,
+	"state":     StateMultipleDeployType,
+}
+
+// migrateV1ToV2 the deploy types of v1 are split into singleton and multiple
+func migrateV1ToV2(doc map[string]interface{}) error {
+	apps, _ := doc["apps"].([]interface{})
+	for _, app := range apps {
+		com, ok := app.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if method, ok := com["extend_method"].(string); ok {
+			if deployType, ok := legacyDeployTypes[method]; ok {
+				com["extend_method"] = string(deployType)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateV2ToV3 the values of v3 have the types of the schema: the numbers and the booleans written
+// as strings are converted, the nulls become empty arrays and objects, the deploy types, the probes
+// and the sharing policies are written in the canonical spellings
+func migrateV2ToV3(doc map[string]interface{}) error {
+	schema := Schema()
+	coerceJSON(schema, schema, doc)
+	return TypedMigration(func(ram *RainbondApplicationConfig) error {
+		ram.HandleNullValue()
+		for _, com := range ram.Components {
+			if com == nil {
+				continue
+			}
+			if com.DeployType == "" {
+				com.DeployType = StatelessMultipleDeployType
+			}
+			for i := range com.ServiceVolumeMapList {
+				volume := &com.ServiceVolumeMapList[i]
+				switch strings.ToLower(volume.SharingPolicy) {
+				case "shared":
+					volume.SharingPolicy = "Shared"
+				case "exclusive":
+					volume.SharingPolicy = "Exclusive"
+				}
+			}
+		}
+		return nil
+	})(doc)
+}
+
+var jsonIntegerRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+
+// coerceJSON convert the values to the types of the schema, the value can not be converted is not changed
+func coerceJSON(root, s *JSONSchema, value interface{}) interface{} {
+	if s.Ref != "" && strings.HasPrefix(s.Ref, "#/$defs/") {
+		if def := root.Defs[strings.TrimPrefix(s.Ref, "#/$defs/")]; def != nil {
+			value = coerceJSON(root, def, value)
+		}
+	}
+	expect := func(t string) bool {
+		for _, st := range s.Type {
+			if st == t {
+				return true
+			}
+		}
+		return false
+	}
+	switch v := value.(type) {
+	case nil:
+		if expect("array") {
+			return []interface{}{}
+		}
+		if expect("object") {
+			return map[string]interface{}{}
+		}
+	case string:
+		// only the json integer literals are written as numbers, such as "10", but not "1e3", "010" or " 10"
+		if (expect("integer") || expect("number")) && jsonIntegerRegexp.MatchString(v) {
+			if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return json.Number(v)
+			}
+		}
+		trimmed := strings.TrimSpace(v)
+		if expect("boolean") && (trimmed == "true" || trimmed == "false") {
+			return trimmed == "true"
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			if prop, ok := s.Properties[key]; ok {
+				v[key] = coerceJSON(root, prop, item)
+			} else if s.AdditionalProperties != nil {
+				v[key] = coerceJSON(root, s.AdditionalProperties, item)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i := range v {
+				v[i] = coerceJSON(root, s.Items, v[i])
+			}
+		}
+	}
+	return value
+}
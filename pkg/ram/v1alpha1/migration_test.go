@@ -0,0 +1,134 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var legacyTemplate = []byte(`{
+  "group_key": "wordpress",
+  "x_market": {"star": 5},
+  "apps": [
+    {
+      "service_key": "mysql",
+      "service_cname": "MySQL",
+      "extend_method": "state",
+      "memory": "512",
+      "probes": null,
+      "service_env_map_list": [{"attr_name": "MYSQL_DATABASE", "attr_value": "wordpress", "is_change": "true", "x_hint": "db"}],
+      "service_volume_map_list": [{"volume_name": "data", "volume_path": "/var/lib/mysql", "volume_type": "local", "volume_capacity": "10", "sharing_policy": "exclusive", "file_content": ""}],
+      "port_map_list": [{"container_port": 3306, "protocol": "mysql"}]
+    }
+  ],
+  "ingress_stream_routes": [{"component_key": "mysql", "port": "3306", "protocol": "tcp"}]
+}`)
+
+func TestMigrate(t *testing.T) {
+	if version, _ := TemplateVersion(legacyTemplate); version != LegacyTemplateVersion {
+		t.Fatalf("expect legacy version, got %s", version)
+	}
+	v2, err := Migrate(legacyTemplate, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	json.Unmarshal(v2, &doc)
+	com := doc["apps"].([]interface{})[0].(map[string]interface{})
+	if doc["template_version"] != "v2" || com["extend_method"] != "state_multiple" || com["memory"] != "512" {
+		t.Fatalf("unexpected v2 template %s", v2)
+	}
+	v3, err := Migrate(v2, LatestTemplateVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateJSON(v3); err != nil {
+		t.Fatalf("v3 template does not match the schema: %v", err)
+	}
+	var ram RainbondApplicationConfig
+	if err := json.Unmarshal(v3, &ram); err != nil {
+		t.Fatal(err)
+	}
+	mysql := ram.Components[0]
+	if ram.TempleteVersion != "v3" || mysql.Memory != 512 || mysql.Probes == nil || !mysql.Envs[0].IsChange ||
+		mysql.ServiceVolumeMapList[0].VolumeCapacity != 10 || mysql.ServiceVolumeMapList[0].SharingPolicy != "Exclusive" ||
+		ram.IngressSreamRoutes[0].Port != 3306 {
+		t.Fatalf("unexpected v3 template %s", v3)
+	}
+	// the fields unknown to the types are kept
+	json.Unmarshal(v3, &doc)
+	com = doc["apps"].([]interface{})[0].(map[string]interface{})
+	env := com["service_env_map_list"].([]interface{})[0].(map[string]interface{})
+	if doc["x_market"] == nil || env["x_hint"] != "db" {
+		t.Fatalf("the unknown fields are dropped: %s", v3)
+	}
+	if direct, err := Migrate(legacyTemplate, "v3"); err != nil || string(direct) != string(v3) {
+		t.Fatalf("migrate v1 to v3 expect %s, got %s %v", v3, direct, err)
+	}
+	if same, err := Migrate(v3, "v3"); err != nil || string(same) != string(v3) {
+		t.Fatalf("the template in the target version should not be changed: %v", err)
+	}
+	if _, err := Migrate(v3, "v2"); err == nil {
+		t.Fatal("expect error for downgrade")
+	}
+	if _, err := Migrate([]byte(`{"template_version": "v9"}`), "v3"); err == nil {
+		t.Fatal("expect error for unknown version")
+	}
+}
+
+func TestRegisterMigration(t *testing.T) {
+	RegisterMigration(Migration{From: "test-1", To: "test-2", Migrate: func(doc map[string]interface{}) error {
+		doc["group_name"] = doc["group_key"]
+		return nil
+	}})
+	RegisterMigration(Migration{From: "test-2", To: "test-3", Migrate: TypedMigration(func(ram *RainbondApplicationConfig) error {
+		ram.AppVersion = ram.AppName + "-1"
+		return nil
+	})})
+	migrated, err := Migrate([]byte(`{"template_version": "test-1", "group_key": "app", "custom": true}`), "test-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	json.Unmarshal(migrated, &doc)
+	if doc["template_version"] != "test-3" || doc["group_version"] != "app-1" || doc["custom"] != true {
+		t.Fatalf("unexpected migrated template %s", migrated)
+	}
+}
+
+func TestCoerceJSONIntegers(t *testing.T) {
+	schema := Schema()
+	for value, expect := range map[string]interface{}{
+		"512":                  json.Number("512"),
+		"-1":                   json.Number("-1"),
+		"1e3":                  "1e3",
+		"010":                  "010",
+		" 10":                  " 10",
+		"0x10":                 "0x10",
+		"1.5":                  "1.5",
+		"99999999999999999999": "99999999999999999999",
+	} {
+		doc := map[string]interface{}{"apps": []interface{}{map[string]interface{}{"memory": value}}}
+		coerceJSON(schema, schema, doc)
+		if got := doc["apps"].([]interface{})[0].(map[string]interface{})["memory"]; got != expect {
+			t.Errorf("memory %q is coerced to %#v, expect %#v", value, got, expect)
+		}
+	}
+}
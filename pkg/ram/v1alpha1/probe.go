@@ -0,0 +1,163 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//ProbeMode probe mode
+type ProbeMode string
+
+//LivenessProbeMode restart the container if the probe fails
+var LivenessProbeMode ProbeMode = "liveness"
+
+//ReadinessProbeMode remove the container from the endpoints if the probe fails
+var ReadinessProbeMode ProbeMode = "readiness"
+
+//StartupProbeMode the other probes are disabled until the probe succeeds
+var StartupProbeMode ProbeMode = "startup"
+
+//IgnoreProbeMode legacy mode of rainbond, the result of the probe is ignored
+var IgnoreProbeMode ProbeMode = "ignore"
+
+var probeModeAliases = map[string]ProbeMode{
+	"liveness":  LivenessProbeMode,
+	"livebess":  LivenessProbeMode,
+	"live":      LivenessProbeMode,
+	"readiness": ReadinessProbeMode,
+	"readness":  ReadinessProbeMode,
+	"ready":     ReadinessProbeMode,
+	"startup":   StartupProbeMode,
+	"start":     StartupProbeMode,
+	"ignore":    IgnoreProbeMode,
+}
+
+//ParseProbeMode parse the mode with the legacy spellings, the unknown mode is returned as it is
+func ParseProbeMode(mode string) ProbeMode {
+	if m, ok := probeModeAliases[strings.ToLower(strings.TrimSpace(mode))]; ok {
+		return m
+	}
+	return ProbeMode(mode)
+}
+
+//Valid whether the mode is known
+func (m ProbeMode) Valid() bool {
+	switch m {
+	case LivenessProbeMode, ReadinessProbeMode, StartupProbeMode, IgnoreProbeMode:
+		return true
+	}
+	return false
+}
+
+//UnmarshalJSON decode the mode tolerantly
+func (m *ProbeMode) UnmarshalJSON(data []byte) error {
+	var mode string
+	if err := json.Unmarshal(data, &mode); err != nil {
+		return err
+	}
+	*m = ParseProbeMode(mode)
+	return nil
+}
+
+//ProbeScheme probe scheme
+type ProbeScheme string
+
+//HTTPProbeScheme http get request
+var HTTPProbeScheme ProbeScheme = "http"
+
+//HTTPSProbeScheme https get request
+var HTTPSProbeScheme ProbeScheme = "https"
+
+//TCPProbeScheme tcp connection
+var TCPProbeScheme ProbeScheme = "tcp"
+
+//CmdProbeScheme command executed in the container
+var CmdProbeScheme ProbeScheme = "cmd"
+
+//GRPCProbeScheme grpc health checking protocol
+var GRPCProbeScheme ProbeScheme = "grpc"
+
+var probeSchemeAliases = map[string]ProbeScheme{
+	"http":    HTTPProbeScheme,
+	"https":   HTTPSProbeScheme,
+	"tcp":     TCPProbeScheme,
+	"cmd":     CmdProbeScheme,
+	"exec":    CmdProbeScheme,
+	"command": CmdProbeScheme,
+	"grpc":    GRPCProbeScheme,
+}
+
+//ParseProbeScheme parse the scheme with the legacy spellings, the unknown scheme is returned as it is
+func ParseProbeScheme(scheme string) ProbeScheme {
+	if s, ok := probeSchemeAliases[strings.ToLower(strings.TrimSpace(scheme))]; ok {
+		return s
+	}
+	return ProbeScheme(scheme)
+}
+
+//Valid whether the scheme is known
+func (s ProbeScheme) Valid() bool {
+	switch s {
+	case HTTPProbeScheme, HTTPSProbeScheme, TCPProbeScheme, CmdProbeScheme, GRPCProbeScheme:
+		return true
+	}
+	return false
+}
+
+//UnmarshalJSON decode the scheme tolerantly
+func (s *ProbeScheme) UnmarshalJSON(data []byte) error {
+	var scheme string
+	if err := json.Unmarshal(data, &scheme); err != nil {
+		return err
+	}
+	*s = ParseProbeScheme(scheme)
+	return nil
+}
+
+//ProbeHTTPHeader http header of the probe request
+type ProbeHTTPHeader struct {
+	Name  string
+	Value string
+}
+
+//ParseProbeHTTPHeaders parse the headers of the probe, the headers are separated by comma or new line,
+//the name and the value are separated by the first = or :, so the value may contain them.
+func ParseProbeHTTPHeaders(headers string) ([]ProbeHTTPHeader, error) {
+	var re []ProbeHTTPHeader
+	for _, item := range strings.FieldsFunc(headers, func(r rune) bool { return r == ',' || r == '\n' }) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var name, value string
+		if i := strings.IndexAny(item, "=:"); i >= 0 {
+			name, value = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		} else {
+			name = item
+		}
+		if name == "" || strings.ContainsAny(name, " \t\"()/<>?@[]{}\\") {
+			return nil, fmt.Errorf("invalid http header %q", item)
+		}
+		re = append(re, ProbeHTTPHeader{Name: name, Value: value})
+	}
+	return re, nil
+}
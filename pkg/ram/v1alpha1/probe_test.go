@@ -0,0 +1,81 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestProbeDecoding(t *testing.T) {
+	var probes []ComponentProbe
+	body := `[{"mode":"livebess","scheme":"HTTP","port":80},{"mode":"Readiness","scheme":"exec","cmd":"true"},{"mode":"startup","scheme":"foo"}]`
+	if err := json.Unmarshal([]byte(body), &probes); err != nil {
+		t.Fatal(err)
+	}
+	if probes[0].Mode != LivenessProbeMode || probes[0].Scheme != HTTPProbeScheme {
+		t.Fatalf("unexpected probe %+v", probes[0])
+	}
+	if probes[1].Mode != ReadinessProbeMode || probes[1].Scheme != CmdProbeScheme {
+		t.Fatalf("unexpected probe %+v", probes[1])
+	}
+	if probes[2].Scheme != "foo" || probes[2].Validation() == nil {
+		t.Fatal("expect error for unknown scheme")
+	}
+}
+
+func TestParseProbeHTTPHeaders(t *testing.T) {
+	headers, err := ParseProbeHTTPHeaders("Authorization=Basic dXNlcjpwYXNz==, X-Host: a.com ,,X-Empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []ProbeHTTPHeader{{"Authorization", "Basic dXNlcjpwYXNz=="}, {"X-Host", "a.com"}, {"X-Empty", ""}}
+	if !reflect.DeepEqual(headers, expect) {
+		t.Fatalf("unexpected headers %+v", headers)
+	}
+	if _, err := ParseProbeHTTPHeaders("=value"); err == nil {
+		t.Fatal("expect error for empty header name")
+	}
+}
+
+func TestComponentProbeValidation(t *testing.T) {
+	invalid := [][]ComponentProbe{
+		{{Mode: "liveness", Scheme: "tcp"}},
+		{{Mode: "liveness", Scheme: "tcp", Port: 80, Cmd: "true"}},
+		{{Mode: "liveness", Scheme: "cmd"}},
+		{{Mode: "liveness", Scheme: "tcp", Port: 80, HTTPHeader: "a=b"}},
+		{{Mode: "unknown", Scheme: "tcp", Port: 80}},
+		{{Mode: "liveness", Scheme: "tcp", Port: 80}, {Mode: "livebess", Scheme: "http", Port: 80}},
+	}
+	for _, probes := range invalid {
+		com := Component{ServiceCname: "test", Probes: probes}
+		if err := com.Validation(); err == nil {
+			t.Fatalf("expect error for %+v", probes)
+		}
+	}
+	com := Component{ServiceCname: "test", Probes: []ComponentProbe{
+		{Mode: "liveness", Scheme: "https", Port: 443, HTTPHeader: "a=b=c"},
+		{Mode: "readiness", Cmd: "cat /tmp/ready"},
+		{Mode: "startup", Scheme: "grpc", Port: 9000},
+	}}
+	if err := com.Validation(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,312 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+//go:generate sh -c "go run ../../../cmd/rainbond-oam schema > rainbond-application-config.schema.json"
+
+//SchemaDraft the draft of the json schema
+var SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+//JSONSchema the json schema, only the keywords used by the schema of the application config are supported
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 SchemaType             `json:"type,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
+}
+
+//SchemaType the json types of the value, it is written as a string if there is only one type
+type SchemaType []string
+
+//MarshalJSON -
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+//UnmarshalJSON -
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = SchemaType{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// schemaEnums the values of the string types, the empty value uses the default. The volume types are
+// not listed, the clusters may define their own storage types
+var schemaEnums = map[reflect.Type][]interface{}{
+	reflect.TypeOf(DeployType("")): {"", StatelessSingletionDeployType, StatelessMultipleDeployType, StateSingletonDeployType, StateMultipleDeployType},
+	reflect.TypeOf(AccessMode("")): {"", RWOAccessMode, RWXAccessMode, ROXAccessMode},
+}
+
+// schemaRequired the fields the application config can not work without
+var schemaRequired = map[string][]string{
+	"RainbondApplicationConfig": {"apps"},
+	"Component":                 {"service_key"},
+	"ComponentPort":             {"container_port"},
+	"ComponentEnv":              {"attr_name"},
+	"ComponentVolume":           {"volume_name", "volume_path", "volume_type"},
+	"ComponentShareVolume":      {"mnt_name", "mnt_dir", "service_share_uuid"},
+	"ComponentDep":              {"dep_service_key"},
+	"ComponentProbe":            {"mode"},
+	"ComponentPluginConfig":     {"plugin_key"},
+	"Plugin":                    {"plugin_key"},
+	"AppConfigGroup":            {"name"},
+	"IngressHTTPRoute":          {"component_key", "port"},
+	"IngressStreamRoute":        {"component_key", "port"},
+}
+
+// schemaBounds the minimum and maximum of the numbers, nil is not limited
+var schemaBounds = map[string][2]*float64{
+	"Component.memory":                         {float(0), nil},
+	"Component.cpu":                            {float(0), nil},
+	"ComponentPort.container_port":             {float(1), float(65535)},
+	"ComponentVolume.volume_capacity":          {float(0), nil},
+	"ComponentPluginConfig.memory_required":    {float(0), nil},
+	"ComponentPluginConfig.cpu_required":       {float(0), nil},
+	"ComponentExtendMethodRule.min_node":       {float(0), float(1024)},
+	"ComponentExtendMethodRule.max_node":       {float(0), float(1024)},
+	"ComponentProbe.port":                      {float(0), float(65535)},
+	"ComponentProbe.initial_delay_second":      {float(0), nil},
+	"ComponentProbe.period_second":             {float(0), nil},
+	"ComponentProbe.timeout_second":            {float(0), nil},
+	"ComponentProbe.success_threshold":         {float(0), nil},
+	"ComponentProbe.failure_threshold":         {float(0), nil},
+	"IngressHTTPRoute.port":                    {float(1), float(65535)},
+	"IngressStreamRoute.port":                  {float(1), float(65535)},
+	"ComponentMonitor.port":                    {float(0), float(65535)},
+	"IngressHTTPRoute.request_body_size_limit": {float(0), nil},
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// schemaDescriptions the descriptions of the types and the fields, the field is keyed by <type>.<json name>
+var schemaDescriptions = map[string]string{
+	"RainbondApplicationConfig":                       "The rainbond application config, the template of an application version.",
+	"RainbondApplicationConfig.group_key":             "The key of the application template.",
+	"RainbondApplicationConfig.group_name":            "The name of the application.",
+	"RainbondApplicationConfig.group_version":         "The version of the application.",
+	"RainbondApplicationConfig.template_version":      "The version of the template format, default is v2.",
+	"RainbondApplicationConfig.apps":                  "The components of the application.",
+	"RainbondApplicationConfig.plugins":               "The plugins the components run as sidecars or init containers.",
+	"RainbondApplicationConfig.app_config_groups":     "The config groups injected into the member components.",
+	"RainbondApplicationConfig.ingress_http_routes":   "The http routes to the ports of the components.",
+	"RainbondApplicationConfig.ingress_stream_routes": "The tcp/udp routes to the ports of the components.",
+	"Component":                               "A component of the application, it runs as a workload.",
+	"Component.memory":                        "The memory limit of the container in MB.",
+	"Component.cpu":                           "The cpu limit of the container in cores.",
+	"Component.probes":                        "The health checks of the container, one probe for each mode.",
+	"Component.service_image":                 "The registry credential of the image.",
+	"Component.service_id":                    "The id of the component in the source cluster.",
+	"Component.extend_method":                 "The deploy type, the stateful components run as statefulsets. Empty is stateless_multiple.",
+	"Component.service_key":                   "The unique key of the component in the application.",
+	"Component.service_share_uuid":            "The id other components refer to when they mount the volumes of the component.",
+	"Component.mnt_relation_list":             "The volumes of other components the component mounts.",
+	"Component.service_source":                "Where the component comes from, such as docker_image.",
+	"Component.dep_service_map_list":          "The components the component depends on, it receives their connection envs.",
+	"Component.service_connect_info_map_list": "The connection envs the dependent components receive.",
+	"Component.service_volume_map_list":       "The volumes and the config files of the component.",
+	"Component.port_map_list":                 "The ports of the component.",
+	"Component.service_name":                  "The name of the component.",
+	"Component.service_env_map_list":          "The envs of the component.",
+	"Component.service_alias":                 "The alias of the component, it names the kubernetes resources if it is a valid dns label.",
+	"Component.extend_method_map":             "The scaling rules of the component.",
+	"Component.service_cname":                 "The display name of the component.",
+	"Component.image":                         "The image the component runs.",
+	"Component.cmd":                           "The command of the container, it replaces the CMD of the image and is parsed with the shell word rules.",
+	"Component.service_related_plugin_config": "The plugins the component runs.",
+	"Component.component_monitor":             "The metrics endpoints of the component.",
+	"ComponentProbe":                          "A health check of the container.",
+	"ComponentProbe.mode":                     "The probe mode: liveness, readiness, startup or ignore.",
+	"ComponentProbe.scheme":                   "The probe scheme: http, https, tcp, cmd or grpc.",
+	"ComponentProbe.cmd":                      "The command of the cmd probe.",
+	"ComponentProbe.port":                     "The port of the http, https, tcp and grpc probes.",
+	"ComponentProbe.path":                     "The path of the http and https probes.",
+	"ComponentProbe.http_header":              "The headers of the http and https probes, name=value separated by commas.",
+	"ImageInfo":                               "The credential of the image registry.",
+	"ComponentPort":                           "A port of the component.",
+	"ComponentPort.port_alias":                "The alias of the port, the lower case alias is the name of the port.",
+	"ComponentPort.protocol":                  "The protocol of the port, such as http, tcp, udp or mysql.",
+	"ComponentPort.container_port":            "The port the container listens on.",
+	"ComponentPort.is_outer_service":          "Whether the port is accessible outside the cluster.",
+	"ComponentPort.is_inner_service":          "Whether the port is accessible by the other components.",
+	"ComponentEnv":                            "An env of the component.",
+	"ComponentEnv.attr_name":                  "The name of the env, a valid identifier.",
+	"ComponentEnv.name":                       "The description of the env.",
+	"ComponentEnv.is_change":                  "Whether the env can be changed when the application is installed.",
+	"ComponentEnv.attr_value":                 "The value of the env.",
+	"ComponentExtendMethodRule":               "The scaling rules, the zero values use the defaults.",
+	"ComponentExtendMethodRule.min_node":      "The minimum number of the replicas, it is the number of replicas installed.",
+	"ComponentExtendMethodRule.max_node":      "The maximum number of the replicas.",
+	"Plugin":                                  "A plugin the components run.",
+	"Plugin.plugin_key":                       "The unique key of the plugin in the application.",
+	"Plugin.category":                         "The category of the plugin, the init-plugin runs as init container.",
+	"Plugin.image":                            "The image the plugin runs.",
+	"Plugin.config_groups":                    "The config definitions of the plugin.",
+	"PluginConfigGroup":                       "The config definition of the plugin.",
+	"PluginConfigGroup.injection":             "How the config is injected: env or auto.",
+	"PluginConfigGroup.service_meta_type":     "What the config is defined for: un_define, upstream_port or downstream_port.",
+	"PluginConfigGroupOption":                 "A config option of the plugin.",
+	"ComponentShareVolume":                    "A volume of other component the component mounts.",
+	"ComponentShareVolume.mnt_name":           "The name of the volume.",
+	"ComponentShareVolume.mnt_dir":            "The mount path in the container.",
+	"ComponentShareVolume.service_share_uuid": "The share id or the key of the component defines the volume.",
+	"ComponentDep":                            "A component the component depends on.",
+	"ComponentDep.dep_service_key":            "The key of the component depended on.",
+	"ComponentVolume":                         "A volume or a config file of the component.",
+	"ComponentVolume.volume_name":             "The name of the volume, unique in the component.",
+	"ComponentVolume.file_content":            "The content of the config file.",
+	"ComponentVolume.volume_path":             "The absolute mount path in the container.",
+	"ComponentVolume.volume_type":             "The volume type, share-file, local, memoryfs, config-file or a storage type of the cluster.",
+	"ComponentVolume.volume_capacity":         "The capacity of the volume in GB, zero is not limited. The config files have no capacity.",
+	"ComponentVolume.access_mode":             "The access mode of the volume, empty is decided by the volume type.",
+	"ComponentVolume.sharing_policy":          "The sharing policy of the volume: Shared or Exclusive.",
+	"ComponentPluginConfig":                   "The config of a plugin the component runs.",
+	"ComponentPluginConfig.plugin_key":        "The key of the plugin.",
+	"ComponentPluginConfig.memory_required":   "The memory limit of the plugin container in MB.",
+	"ComponentPluginConfig.cpu_required":      "The cpu limit of the plugin container in cores.",
+	"ComponentPluginConfig.attr":              "The values of the config options.",
+	"ComponentMonitor":                        "A metrics endpoint of the component.",
+	"AppConfigGroup":                          "A config group injected into the member components.",
+	"AppConfigGroup.name":                     "The name of the config group.",
+	"AppConfigGroup.injection_type":           "How the items are injected: env or file.",
+	"AppConfigGroup.config_items":             "The items of the config group.",
+	"AppConfigGroup.component_keys":           "The keys of the member components.",
+	"IngressHTTPRoute":                        "A http route to the port of a component.",
+	"IngressHTTPRoute.component_key":          "The key of the target component.",
+	"IngressHTTPRoute.port":                   "The target port.",
+	"IngressStreamRoute":                      "A tcp/udp route to the port of a component, the external port is the target port.",
+	"IngressStreamRoute.component_key":        "The key of the target component.",
+	"IngressStreamRoute.port":                 "The target port.",
+}
+
+//Schema the json schema of the rainbond application config generated from the types,
+//the structs are defined in $defs. The nil slices and maps are encoded as null, so they are nullable.
+func Schema() *JSONSchema {
+	g := &schemaGenerator{defs: map[string]*JSONSchema{}}
+	root := g.schemaOf(reflect.TypeOf(RainbondApplicationConfig{}))
+	return &JSONSchema{
+		Schema:      SchemaDraft,
+		Ref:         root.Ref,
+		Title:       "Rainbond application config",
+		Description: schemaDescriptions["RainbondApplicationConfig"],
+		Defs:        g.defs,
+	}
+}
+
+//SchemaJSON the indented json of Schema, it is published as rainbond-application-config.schema.json
+func SchemaJSON() []byte {
+	body, _ := json.MarshalIndent(Schema(), "", "  ")
+	return append(body, '\n')
+}
+
+type schemaGenerator struct {
+	defs map[string]*JSONSchema
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) *JSONSchema {
+	if enum, ok := schemaEnums[t]; ok {
+		return &JSONSchema{Type: SchemaType{"string"}, Enum: enum}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaOf(t.Elem())
+	case reflect.String:
+		return &JSONSchema{Type: SchemaType{"string"}}
+	case reflect.Bool:
+		return &JSONSchema{Type: SchemaType{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &JSONSchema{Type: SchemaType{"integer"}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: SchemaType{"integer"}, Minimum: float(0)}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: SchemaType{"number"}}
+	case reflect.Slice:
+		return &JSONSchema{Type: SchemaType{"array", "null"}, Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: SchemaType{"object", "null"}, AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := g.defs[name]; !ok {
+			def := &JSONSchema{
+				Type:        SchemaType{"object"},
+				Description: schemaDescriptions[name],
+				Properties:  map[string]*JSONSchema{},
+				Required:    schemaRequired[name],
+			}
+			// the placeholder stops the recursion of the self referenced types
+			g.defs[name] = def
+			g.addProperties(def, name, t)
+		}
+		return &JSONSchema{Ref: "#/$defs/" + name}
+	}
+	// interface{} accepts any value
+	return &JSONSchema{}
+}
+
+// addProperties the fields of the embedded structs are the properties of the struct embeds them
+func (g *schemaGenerator) addProperties(def *JSONSchema, typeName string, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.addProperties(def, typeName, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		prop := g.schemaOf(field.Type)
+		if prop.Ref != "" {
+			// the keywords next to $ref apply to the field, the referenced definition is not changed
+			prop = &JSONSchema{Ref: prop.Ref}
+		}
+		key := typeName + "." + name
+		prop.Description = schemaDescriptions[key]
+		if bounds, ok := schemaBounds[key]; ok {
+			prop.Minimum, prop.Maximum = bounds[0], bounds[1]
+		}
+		def.Properties[name] = prop
+	}
+}
@@ -0,0 +1,100 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSchemaPublished(t *testing.T) {
+	published, err := ioutil.ReadFile("rainbond-application-config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(published, SchemaJSON()) {
+		t.Fatal("the published schema is out of date, run go generate ./pkg/ram/v1alpha1")
+	}
+	var schema JSONSchema
+	if err := json.Unmarshal(published, &schema); err != nil {
+		t.Fatal(err)
+	}
+	component := schema.Defs["Component"]
+	if component == nil || len(component.Properties["extend_method"].Enum) != 5 || component.Required[0] != "service_key" {
+		t.Fatalf("unexpected component schema %+v", component)
+	}
+	volume := schema.Defs["ComponentVolume"]
+	if len(volume.Properties["volume_type"].Enum) != 0 || len(volume.Properties["access_mode"].Enum) != 4 {
+		t.Fatalf("unexpected volume schema %+v", volume.Properties)
+	}
+	// the fields of the embedded target component are the fields of the route
+	if route := schema.Defs["IngressStreamRoute"]; route.Properties["component_key"] == nil || schema.Defs["TargetComponent"] != nil {
+		t.Fatalf("unexpected stream route schema %+v", route)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	body, err := json.MarshalIndent(newValidationTestConfig(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateJSON(body); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []byte(`{
+  "apps": [
+    {
+      "service_key": "mysql",
+      "extend_method": "stateful",
+      "port_map_list": [{"container_port": 70000}],
+      "service_volume_map_list": [{"volume_name": "data", "volume_path": "/data", "volume_type": "local", "access_mode": "RWA"}],
+      "memory": 1.5
+    },
+    {"service_cname": "中文", "probes": [{}]}
+  ],
+  "plugins": {}
+}`)
+	errs, ok := ValidateJSON(invalid).(SchemaErrors)
+	if !ok {
+		t.Fatalf("expect schema errors, got %v", ValidateJSON(invalid))
+	}
+	expect := []SchemaError{
+		{Line: 5, Column: 24, Path: "apps[0].extend_method"},
+		{Line: 6, Column: 44, Path: "apps[0].port_map_list[0].container_port"},
+		{Line: 7, Column: 122, Path: "apps[0].service_volume_map_list[0].access_mode"},
+		{Line: 8, Column: 17, Path: "apps[0].memory"},
+		{Line: 10, Column: 5, Path: "apps[1]"},
+		{Line: 10, Column: 40, Path: "apps[1].probes[0]"},
+		{Line: 12, Column: 14, Path: "plugins"},
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("expect %d errors, got %v", len(expect), errs)
+	}
+	for i := range expect {
+		if errs[i].Line != expect[i].Line || errs[i].Column != expect[i].Column || errs[i].Path != expect[i].Path {
+			t.Fatalf("expect error at %d:%d %s, got %v", expect[i].Line, expect[i].Column, expect[i].Path, errs[i])
+		}
+	}
+	errs, ok = ValidateJSON([]byte("{\n  \"apps\": [1,]\n}")).(SchemaErrors)
+	if !ok || len(errs) != 1 || errs[0].Line != 2 || errs[0].Column != 14 {
+		t.Fatalf("expect syntax error at 2:14, got %v", errs)
+	}
+}
@@ -0,0 +1,402 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//SchemaError the json value does not match the schema, the line and the column are 1-based
+//and point at the start of the value
+type SchemaError struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e SchemaError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, e.Path, e.Message)
+}
+
+//SchemaErrors all the values do not match the schema
+type SchemaErrors []SchemaError
+
+func (e SchemaErrors) Error() string {
+	var errs []string
+	for _, se := range e {
+		errs = append(errs, se.Error())
+	}
+	return strings.Join(errs, "; ")
+}
+
+//ValidateJSON validate the raw json of the application config against Schema, the malformed json is
+//reported as one SchemaError at the position of the syntax error
+func ValidateJSON(body []byte) error {
+	return ValidateJSONSchema(Schema(), body)
+}
+
+//ValidateJSONSchema validate the raw json against the schema
+func ValidateJSONSchema(schema *JSONSchema, body []byte) error {
+	p := &jsonParser{data: body}
+	node, err := p.parse()
+	if err != nil {
+		line, column := position(body, p.pos)
+		return SchemaErrors{{Line: line, Column: column, Message: err.Error()}}
+	}
+	v := &schemaValidator{root: schema, body: body}
+	v.validate(schema, node, "")
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// position the line and the column of the offset, the column counts the characters
+func position(body []byte, offset int) (int, int) {
+	if offset > len(body) {
+		offset = len(body)
+	}
+	prefix := body[:offset]
+	line := 1 + strings.Count(string(prefix), "\n")
+	start := strings.LastIndex(string(prefix), "\n") + 1
+	return line, utf8.RuneCount(prefix[start:]) + 1
+}
+
+// the kinds of the json values, they are the names of the json schema types
+const (
+	jsonObject  = "object"
+	jsonArray   = "array"
+	jsonString  = "string"
+	jsonNumber  = "number"
+	jsonBoolean = "boolean"
+	jsonNull    = "null"
+)
+
+// jsonNode the json value with the offset where it starts
+type jsonNode struct {
+	kind   string
+	offset int
+	// the decoded string, the literal of the number and the boolean
+	value  string
+	keys   []string
+	fields []*jsonNode
+	items  []*jsonNode
+}
+
+func (n *jsonNode) field(key string) *jsonNode {
+	for i := range n.keys {
+		if n.keys[i] == key {
+			return n.fields[i]
+		}
+	}
+	return nil
+}
+
+// jsonParser parse the json and keep the offsets of the values, the pos is the offset of the syntax error
+type jsonParser struct {
+	data []byte
+	pos  int
+}
+
+func (p *jsonParser) parse() (*jsonNode, error) {
+	node, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.data) {
+		return nil, fmt.Errorf("invalid character %q after top-level value", p.data[p.pos])
+	}
+	return node, nil
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) parseValue() (*jsonNode, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, fmt.Errorf("unexpected end of json input")
+	}
+	node := &jsonNode{offset: p.pos}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		node.kind = jsonObject
+		p.pos++
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == '}' {
+			p.pos++
+			return node, nil
+		}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+				return nil, p.unexpected("object key")
+			}
+			key, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+				return nil, p.unexpected("':' after object key")
+			}
+			p.pos++
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			node.keys = append(node.keys, key)
+			node.fields = append(node.fields, value)
+			if done, err := p.parseSeparator('}'); err != nil || done {
+				return node, err
+			}
+		}
+	case c == '[':
+		node.kind = jsonArray
+		p.pos++
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == ']' {
+			p.pos++
+			return node, nil
+		}
+		for {
+			item, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+			if done, err := p.parseSeparator(']'); err != nil || done {
+				return node, err
+			}
+		}
+	case c == '"':
+		node.kind = jsonString
+		value, err := p.parseString()
+		node.value = value
+		return node, err
+	case c == '-' || (c >= '0' && c <= '9'):
+		node.kind = jsonNumber
+		for p.pos < len(p.data) && strings.IndexByte("+-.eE0123456789", p.data[p.pos]) >= 0 {
+			p.pos++
+		}
+		node.value = string(p.data[node.offset:p.pos])
+		if _, err := strconv.ParseFloat(node.value, 64); err != nil || !json.Valid([]byte(node.value)) {
+			p.pos = node.offset
+			return nil, fmt.Errorf("invalid number %s", node.value)
+		}
+		return node, nil
+	default:
+		for _, literal := range []string{"true", "false", "null"} {
+			if strings.HasPrefix(string(p.data[p.pos:]), literal) {
+				node.kind = jsonBoolean
+				if literal == "null" {
+					node.kind = jsonNull
+				}
+				node.value = literal
+				p.pos += len(literal)
+				return node, nil
+			}
+		}
+		return nil, p.unexpected("value")
+	}
+}
+
+// parseSeparator parse the comma between the members or the end of the object or the array
+func (p *jsonParser) parseSeparator(end byte) (bool, error) {
+	p.skipSpace()
+	if p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+			return false, nil
+		case end:
+			p.pos++
+			return true, nil
+		}
+	}
+	return false, p.unexpected(fmt.Sprintf("',' or '%c'", end))
+}
+
+func (p *jsonParser) parseString() (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '"':
+			p.pos++
+			var value string
+			if err := json.Unmarshal(p.data[start:p.pos], &value); err != nil {
+				literal := p.data[start:p.pos]
+				p.pos = start
+				return "", fmt.Errorf("invalid string %s", literal)
+			}
+			return value, nil
+		}
+		p.pos++
+	}
+	p.pos = start
+	return "", fmt.Errorf("unterminated string")
+}
+
+func (p *jsonParser) unexpected(expect string) error {
+	if p.pos >= len(p.data) {
+		return fmt.Errorf("unexpected end of json input, expect %s", expect)
+	}
+	return fmt.Errorf("invalid character %q, expect %s", p.data[p.pos], expect)
+}
+
+type schemaValidator struct {
+	root *JSONSchema
+	body []byte
+	errs SchemaErrors
+}
+
+func (v *schemaValidator) addf(node *jsonNode, path, format string, args ...interface{}) {
+	line, column := position(v.body, node.offset)
+	v.errs = append(v.errs, SchemaError{Line: line, Column: column, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *schemaValidator) validate(s *JSONSchema, node *jsonNode, path string) {
+	if s.Ref != "" {
+		def := v.resolve(s.Ref)
+		if def == nil {
+			v.addf(node, path, "unresolved reference %s", s.Ref)
+			return
+		}
+		v.validate(def, node, path)
+	}
+	if len(s.Type) > 0 && !matchType(s.Type, node) {
+		v.addf(node, path, "expect %s, got %s", strings.Join(s.Type, " or "), node.kind)
+		return
+	}
+	if len(s.Enum) > 0 && !matchEnum(s.Enum, node) {
+		var values []string
+		for _, e := range s.Enum {
+			body, _ := json.Marshal(e)
+			values = append(values, string(body))
+		}
+		v.addf(node, path, "value %s is not one of %s", nodeJSON(node), strings.Join(values, ", "))
+	}
+	if node.kind == jsonNumber {
+		f, _ := strconv.ParseFloat(node.value, 64)
+		if s.Minimum != nil && f < *s.Minimum {
+			v.addf(node, path, "%s is less than the minimum %v", node.value, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			v.addf(node, path, "%s is greater than the maximum %v", node.value, *s.Maximum)
+		}
+	}
+	switch node.kind {
+	case jsonObject:
+		for _, name := range s.Required {
+			if node.field(name) == nil {
+				v.addf(node, path, "missing required property %q", name)
+			}
+		}
+		for i, key := range node.keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			if prop, ok := s.Properties[key]; ok {
+				v.validate(prop, node.fields[i], fieldPath)
+			} else if s.AdditionalProperties != nil {
+				v.validate(s.AdditionalProperties, node.fields[i], fieldPath)
+			}
+		}
+	case jsonArray:
+		if s.Items != nil {
+			for i, item := range node.items {
+				v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+}
+
+// resolve only the definitions in $defs of the root schema are referenced
+func (v *schemaValidator) resolve(ref string) *JSONSchema {
+	if !strings.HasPrefix(ref, "#/$defs/") {
+		return nil
+	}
+	return v.root.Defs[strings.TrimPrefix(ref, "#/$defs/")]
+}
+
+func matchType(types SchemaType, node *jsonNode) bool {
+	for _, t := range types {
+		if t == node.kind {
+			return true
+		}
+		if t == "integer" && node.kind == jsonNumber {
+			f, err := strconv.ParseFloat(node.value, 64)
+			if err == nil && f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchEnum(enum []interface{}, node *jsonNode) bool {
+	var value interface{}
+	if err := json.Unmarshal([]byte(nodeJSON(node)), &value); err != nil {
+		return false
+	}
+	for _, e := range enum {
+		// the enum of the go types are compared as json
+		body, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		var expect interface{}
+		if json.Unmarshal(body, &expect) == nil && expect == value {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeJSON the json of the scalar node, it is empty for the objects and the arrays
+func nodeJSON(node *jsonNode) string {
+	if node.kind == jsonString {
+		body, _ := json.Marshal(node.value)
+		return string(body)
+	}
+	return node.value
+}
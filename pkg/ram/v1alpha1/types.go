@@ -21,21 +21,33 @@ package v1alpha1
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/goodrain/rainbond-oam/pkg/util"
 )
 
 //RainbondApplicationConfig store app version templete
 type RainbondApplicationConfig struct {
-	AppKeyID           string              `json:"group_key"`
-	AppName            string              `json:"group_name"`
-	AppVersion         string              `json:"group_version"`
-	TempleteVersion    string              `json:"template_version"`
-	Components         []*Component        `json:"apps"`
-	Plugins            []Plugin            `json:"plugins,omitempty"`
-	AppConfigGroups    []AppConfigGroup    `json:"app_config_groups,omitempty"`
-	IngressHTTPRoutes  []IngressHTTPRoute  `json:"ingress_http_routes,omitempty"`
-	IngressSreamRoutes []IngressSreamRoute `json:"ingress_stream_routes,omitempty"`
+	AppKeyID          string             `json:"group_key"`
+	AppName           string             `json:"group_name"`
+	AppVersion        string             `json:"group_version"`
+	TempleteVersion   string             `json:"template_version"`
+	Components        []*Component       `json:"apps"`
+	Plugins           []Plugin           `json:"plugins,omitempty"`
+	AppConfigGroups   []AppConfigGroup   `json:"app_config_groups,omitempty"`
+	IngressHTTPRoutes []IngressHTTPRoute `json:"ingress_http_routes,omitempty"`
+	// Deprecated: the name is misspelled, use IngressStreamRoutes and SetIngressStreamRoutes.
+	IngressSreamRoutes []IngressStreamRoute `json:"ingress_stream_routes,omitempty"`
+}
+
+//IngressStreamRoutes the tcp/udp routes of the application
+func (s *RainbondApplicationConfig) IngressStreamRoutes() []IngressStreamRoute {
+	return s.IngressSreamRoutes
+}
+
+//SetIngressStreamRoutes set the tcp/udp routes of the application
+func (s *RainbondApplicationConfig) SetIngressStreamRoutes(routes []IngressStreamRoute) {
+	s.IngressSreamRoutes = routes
 }
 
 //HandleNullValue handle null value
@@ -54,22 +66,15 @@ func (s *RainbondApplicationConfig) HandleNullValue() {
 	}
 }
 
-//Validation validation app templete
+//Validation validation app templete, all the invalid fields are returned as ValidationErrors
 func (s *RainbondApplicationConfig) Validation() error {
-	if len(s.Components) == 0 {
-		return fmt.Errorf("no app in templete")
-	}
-	for _, app := range s.Components {
-		if err := app.Validation(); err != nil {
-			return err
-		}
-	}
-	for _, plugin := range s.Plugins {
-		if err := plugin.Validation(); err != nil {
-			return err
-		}
-	}
-	return nil
+	return s.validate(false).err()
+}
+
+//ConversionValidation validate the fields the converters can not convert. The unknown deploy types and
+//plugins and the negative quantities are left to the converters, they report them as diagnostics
+func (s *RainbondApplicationConfig) ConversionValidation() error {
+	return s.validate(true).err()
 }
 
 //JSON return json string
@@ -180,36 +185,85 @@ func (s *Component) HandleNullValue() {
 	if s.Probes == nil {
 		s.Probes = []ComponentProbe{}
 	}
+	for i := range s.Probes {
+		s.Probes[i].HandleNullValue()
+	}
 }
 
-//Validation -
+//Validation validate the fields of the component, the paths of ValidationErrors are relative to the component.
+//The references to the other components and the plugins are validated by the application config
 func (s *Component) Validation() error {
-	return nil
+	f := newFieldErrors("")
+	s.validate(f)
+	return f.errs.err()
 }
 
 //ComponentProbe probe
 type ComponentProbe struct {
-	ID                 int    `json:"ID" bson:"ID"`
-	InitialDelaySecond int    `json:"initial_delay_second" bson:"initial_delay_second"`
-	FailureThreshold   int    `json:"failure_threshold" bson:"failure_threshold"`
-	ServiceID          string `json:"service_id" bson:"service_id"`
-	HTTPHeader         string `json:"http_header" bson:"http_header"`
-	Cmd                string `json:"cmd" bson:"cmd"`
-	ProbeID            string `json:"probe_id" bson:"probe_id"`
-	Scheme             string `json:"scheme" bson:"scheme"`
-	SuccessThreshold   int    `json:"success_threshold" bson:"success_threshold"`
-	TimeoutSecond      int    `json:"timeout_second" bson:"timeout_second"`
-	IsUsed             bool   `json:"is_used" bson:"is_used"`
-	PeriodSecond       int    `json:"period_second" bson:"period_second"`
-	Port               int    `json:"port" bson:"port"`
-	Mode               string `json:"mode" bson:"mode"`
-	Path               string `json:"path" bson:"path"`
+	ID                 int         `json:"ID" bson:"ID"`
+	InitialDelaySecond int         `json:"initial_delay_second" bson:"initial_delay_second"`
+	FailureThreshold   int         `json:"failure_threshold" bson:"failure_threshold"`
+	ServiceID          string      `json:"service_id" bson:"service_id"`
+	HTTPHeader         string      `json:"http_header" bson:"http_header"`
+	Cmd                string      `json:"cmd" bson:"cmd"`
+	ProbeID            string      `json:"probe_id" bson:"probe_id"`
+	Scheme             ProbeScheme `json:"scheme" bson:"scheme"`
+	SuccessThreshold   int         `json:"success_threshold" bson:"success_threshold"`
+	TimeoutSecond      int         `json:"timeout_second" bson:"timeout_second"`
+	IsUsed             bool        `json:"is_used" bson:"is_used"`
+	PeriodSecond       int         `json:"period_second" bson:"period_second"`
+	Port               int         `json:"port" bson:"port"`
+	Mode               ProbeMode   `json:"mode" bson:"mode"`
+	Path               string      `json:"path" bson:"path"`
+}
+
+//HandleNullValue the legacy probe without scheme runs the cmd
+func (s *ComponentProbe) HandleNullValue() {
+	if s.Scheme == "" && s.Cmd != "" {
+		s.Scheme = CmdProbeScheme
+	}
 }
 
 //Validation probe validation
 func (s *ComponentProbe) Validation() error {
-	if s.Port == 0 && s.Cmd == "" {
-		return fmt.Errorf("probe endpoint port is 0")
+	if !ParseProbeMode(string(s.Mode)).Valid() {
+		return fmt.Errorf("unknown probe mode %q", s.Mode)
+	}
+	scheme := ParseProbeScheme(string(s.Scheme))
+	if scheme == "" && s.Cmd != "" {
+		scheme = CmdProbeScheme
+	}
+	if !scheme.Valid() {
+		return fmt.Errorf("unknown %s probe scheme %q", s.Mode, s.Scheme)
+	}
+	if scheme == CmdProbeScheme {
+		if strings.TrimSpace(s.Cmd) == "" {
+			return fmt.Errorf("%s probe of scheme cmd has no cmd", s.Mode)
+		}
+		if _, err := util.SplitShellWords(s.Cmd); err != nil {
+			return fmt.Errorf("%s probe: parse cmd: %v", s.Mode, err)
+		}
+	} else {
+		if s.Port <= 0 || s.Port > 65535 {
+			return fmt.Errorf("%s probe endpoint port %d is invalid", s.Mode, s.Port)
+		}
+		if strings.TrimSpace(s.Cmd) != "" {
+			return fmt.Errorf("%s probe defines both cmd and %s port", s.Mode, scheme)
+		}
+	}
+	if s.HTTPHeader != "" {
+		if scheme != HTTPProbeScheme && scheme != HTTPSProbeScheme {
+			return fmt.Errorf("%s probe of scheme %s does not support http header", s.Mode, scheme)
+		}
+		if _, err := ParseProbeHTTPHeaders(s.HTTPHeader); err != nil {
+			return fmt.Errorf("%s probe: %v", s.Mode, err)
+		}
+	}
+	if s.InitialDelaySecond < 0 || s.PeriodSecond < 0 || s.TimeoutSecond < 0 || s.SuccessThreshold < 0 || s.FailureThreshold < 0 {
+		return fmt.Errorf("%s probe has negative seconds or thresholds", s.Mode)
+	}
+	if ParseProbeMode(string(s.Mode)) != ReadinessProbeMode && s.SuccessThreshold > 1 {
+		return fmt.Errorf("success threshold of %s probe must be 1", s.Mode)
 	}
 	return nil
 }
@@ -286,9 +340,11 @@ type Plugin struct {
 	BuildVersion  string              `json:"build_version" bson:"build_version"`
 }
 
-//Validation validation app templete
+//Validation validate the fields of the plugin, the paths of ValidationErrors are relative to the plugin
 func (s *Plugin) Validation() error {
-	return nil
+	f := newFieldErrors("")
+	s.validate(f)
+	return f.errs.err()
 }
 
 //HandleNullValue 处理null值数据
@@ -298,6 +354,24 @@ func (s *Plugin) HandleNullValue() {
 	}
 }
 
+//InitPluginCategory init plugin, run before the component container starts
+var InitPluginCategory = "init-plugin"
+
+//EnvPluginInjection the plugin config is injected as environment variables
+var EnvPluginInjection = "env"
+
+//AutoPluginInjection the plugin config is discovered by the plugin at runtime
+var AutoPluginInjection = "auto"
+
+//UnDefineMetaType plugin config not related to any port
+var UnDefineMetaType = "un_define"
+
+//UpstreamPortMetaType plugin config defined for every port of the component
+var UpstreamPortMetaType = "upstream_port"
+
+//DownstreamPortMetaType plugin config defined for every port of the dependent components
+var DownstreamPortMetaType = "downstream_port"
+
 //PluginConfigGroup 插件配置定义
 type PluginConfigGroup struct {
 	ID              int                       `json:"ID" bson:"id"`
@@ -369,7 +443,8 @@ var ROXAccessMode AccessMode = "ROX"
 
 //ComponentVolume volume config
 type ComponentVolume struct {
-	VolumeName      string     `json:"volume_name"`
+	VolumeName string `json:"volume_name"`
+	// Deprecated: the name is misspelled, use FileContent and SetFileContent.
 	FileConent      string     `json:"file_content"`
 	VolumeMountPath string     `json:"volume_path"`
 	VolumeType      VolumeType `json:"volume_type"`
@@ -378,6 +453,16 @@ type ComponentVolume struct {
 	SharingPolicy   string     `json:"sharing_policy"`
 }
 
+//FileContent the content of the config file volume
+func (s ComponentVolume) FileContent() string {
+	return s.FileConent
+}
+
+//SetFileContent set the content of the config file volume
+func (s *ComponentVolume) SetFileContent(content string) {
+	s.FileConent = content
+}
+
 //ComponentPluginConfig 服务插件配置数据
 type ComponentPluginConfig struct {
 	CreateTime      string                   `json:"create_time"`
@@ -428,13 +513,16 @@ type IngressHTTPRoute struct {
 	TargetComponent
 }
 
-//IngressSreamRoute ingress stream route
-type IngressSreamRoute struct {
+//IngressStreamRoute ingress stream route
+type IngressStreamRoute struct {
 	Protocol          string `json:"protocol"`
 	ConnectionTimeout int    `json:"connection_timeout"`
 	TargetComponent
 }
 
+//IngressSreamRoute Deprecated: use IngressStreamRoute, the misspelled name is kept for the existing code
+type IngressSreamRoute = IngressStreamRoute
+
 //TargetComponent target component
 type TargetComponent struct {
 	ComponentKey string `json:"component_key"`
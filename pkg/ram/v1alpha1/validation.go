@@ -0,0 +1,378 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/goodrain/rainbond-oam/pkg/util"
+)
+
+// the env name must be a valid identifier of the shell
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+//FieldError the invalid field of the application config, the path points at the field
+//in the json of the config, such as apps[3].port_map_list[1].container_port
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+//ValidationErrors all the invalid fields of the application config
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	var errs []string
+	for _, fe := range e {
+		errs = append(errs, fe.Error())
+	}
+	return strings.Join(errs, "; ")
+}
+
+// err nil if there is no invalid field
+func (e ValidationErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// fieldErrors collect the invalid fields under the prefix
+type fieldErrors struct {
+	prefix string
+	errs   *ValidationErrors
+	// lenient skip the fields the converters convert with the default values or diagnose by themselves
+	lenient bool
+}
+
+func newFieldErrors(prefix string) fieldErrors {
+	return fieldErrors{prefix: prefix, errs: &ValidationErrors{}}
+}
+
+func (f fieldErrors) at(format string, args ...interface{}) fieldErrors {
+	field := fmt.Sprintf(format, args...)
+	switch {
+	case f.prefix == "":
+	case strings.HasPrefix(field, "["):
+		field = f.prefix + field
+	default:
+		field = f.prefix + "." + field
+	}
+	return fieldErrors{prefix: field, errs: f.errs, lenient: f.lenient}
+}
+
+func (f fieldErrors) add(format string, args ...interface{}) {
+	*f.errs = append(*f.errs, FieldError{Path: f.prefix, Message: fmt.Sprintf(format, args...)})
+}
+
+// addStrict add the field the converters can still convert or report with their own diagnostics,
+// such as the unknown deploy type, it is skipped by the lenient validation
+func (f fieldErrors) addStrict(format string, args ...interface{}) {
+	if f.lenient {
+		return
+	}
+	f.add(format, args...)
+}
+
+// validate check every field of the application config, the fields of the components are checked by the components
+func (s *RainbondApplicationConfig) validate(lenient bool) ValidationErrors {
+	f := newFieldErrors("")
+	f.lenient = lenient
+	if len(s.Components) == 0 {
+		f.at("apps").add("no app in templete")
+	}
+	keys := map[string]*Component{}
+	shareIDs := map[string]*Component{}
+	cnames := map[string]int{}
+	for i, com := range s.Components {
+		cf := f.at("apps[%d]", i)
+		if com == nil {
+			cf.add("component is null")
+			continue
+		}
+		com.validate(cf)
+		if com.ServiceKey == "" {
+			cf.at("service_key").add("service key is required")
+		} else if _, ok := keys[com.ServiceKey]; ok {
+			cf.at("service_key").add("duplicate service key %q", com.ServiceKey)
+		} else {
+			keys[com.ServiceKey] = com
+		}
+		if com.ServiceShareID != "" {
+			shareIDs[com.ServiceShareID] = com
+		}
+		if other, ok := cnames[com.ServiceCname]; ok {
+			cf.at("service_cname").add("duplicate service cname %q of apps[%d]", com.ServiceCname, other)
+		} else {
+			cnames[com.ServiceCname] = i
+		}
+	}
+	plugins := map[string]bool{}
+	for i := range s.Plugins {
+		pf := f.at("plugins[%d]", i)
+		s.Plugins[i].validate(pf)
+		if key := s.Plugins[i].PluginKey; key != "" {
+			if plugins[key] {
+				pf.at("plugin_key").add("duplicate plugin key %q", key)
+			}
+			plugins[key] = true
+		}
+	}
+	for i, com := range s.Components {
+		if com == nil {
+			continue
+		}
+		cf := f.at("apps[%d]", i)
+		for j, dep := range com.DepServiceMapList {
+			df := cf.at("dep_service_map_list[%d].dep_service_key", j)
+			if dep.DepServiceKey == com.ServiceKey {
+				df.add("component can not depend on itself")
+			} else if keys[dep.DepServiceKey] == nil {
+				df.add("unknown component %q", dep.DepServiceKey)
+			}
+		}
+		for j, config := range com.ServicePluginConfigs {
+			if !plugins[config.PluginKey] {
+				cf.at("service_related_plugin_config[%d].plugin_key", j).addStrict("unknown plugin %q", config.PluginKey)
+			}
+		}
+		for j, mnt := range com.MntReleationList {
+			mf := cf.at("mnt_relation_list[%d]", j)
+			owner := shareIDs[mnt.ShareServiceUUID]
+			if owner == nil {
+				owner = keys[mnt.ShareServiceUUID]
+			}
+			if owner == nil {
+				mf.at("service_share_uuid").add("unknown component %q", mnt.ShareServiceUUID)
+			} else if !owner.hasVolume(mnt.VolumeName) {
+				mf.at("mnt_name").add("volume %q is not defined by component %s", mnt.VolumeName, owner.ServiceCname)
+			}
+		}
+	}
+	validateTarget := func(tf fieldErrors, target TargetComponent) {
+		com := keys[target.ComponentKey]
+		if com == nil {
+			tf.at("component_key").add("unknown component %q", target.ComponentKey)
+			return
+		}
+		if !com.hasPort(int(target.Port)) {
+			tf.at("port").add("port %d is not defined by component %s", target.Port, com.ServiceCname)
+		}
+	}
+	for i := range s.IngressHTTPRoutes {
+		validateTarget(f.at("ingress_http_routes[%d]", i), s.IngressHTTPRoutes[i].TargetComponent)
+	}
+	for i := range s.IngressSreamRoutes {
+		validateTarget(f.at("ingress_stream_routes[%d]", i), s.IngressSreamRoutes[i].TargetComponent)
+	}
+	for i, group := range s.AppConfigGroups {
+		for j, key := range group.ComponentKeys {
+			if keys[key] == nil {
+				f.at("app_config_groups[%d].component_keys[%d]", i, j).add("unknown component %q", key)
+			}
+		}
+	}
+	return *f.errs
+}
+
+// validate check the fields of the component itself, the references to the other parts of the application
+// config are checked by the application config
+func (s *Component) validate(f fieldErrors) {
+	if _, err := util.SplitShellWords(s.Cmd); err != nil {
+		f.at("cmd").add("parse cmd: %v", err)
+	}
+	modes := map[ProbeMode]bool{}
+	for i := range s.Probes {
+		if err := s.Probes[i].Validation(); err != nil {
+			f.at("probes[%d]", i).add("%v", err)
+			continue
+		}
+		mode := ParseProbeMode(string(s.Probes[i].Mode))
+		if modes[mode] {
+			f.at("probes[%d].mode", i).add("conflicting %s probes", mode)
+		}
+		modes[mode] = true
+	}
+	switch s.DeployType {
+	case "", StatelessSingletionDeployType, StatelessMultipleDeployType, StateSingletonDeployType, StateMultipleDeployType:
+	default:
+		f.at("extend_method").addStrict("unknown deploy type %q", s.DeployType)
+	}
+	if s.Memory < 0 {
+		f.at("memory").addStrict("memory %d can not be negative", s.Memory)
+	}
+	if s.CPU < 0 {
+		f.at("cpu").addStrict("cpu %d can not be negative", s.CPU)
+	}
+	s.ExtendMethodRule.validate(f.at("extend_method_map"))
+	ports := map[int]int{}
+	aliases := map[string]int{}
+	for i, port := range s.Ports {
+		pf := f.at("port_map_list[%d]", i)
+		if port.ContainerPort <= 0 || port.ContainerPort > 65535 {
+			pf.at("container_port").add("port %d is out of range [1, 65535]", port.ContainerPort)
+		} else if other, ok := ports[port.ContainerPort]; ok {
+			pf.at("container_port").add("port %d conflicts with port_map_list[%d]", port.ContainerPort, other)
+		} else {
+			ports[port.ContainerPort] = i
+		}
+		// the lower case alias is the name of the port
+		alias := strings.ToLower(port.PortAlias)
+		if alias == "" {
+			continue
+		}
+		if other, ok := aliases[alias]; ok {
+			pf.at("port_alias").add("port alias %q conflicts with port_map_list[%d]", port.PortAlias, other)
+		} else {
+			aliases[alias] = i
+		}
+	}
+	mounts := map[string]string{}
+	addMount := func(mf fieldErrors, mountPath, field string) {
+		if !path.IsAbs(mountPath) {
+			mf.add("mount path %q is not absolute", mountPath)
+			return
+		}
+		mountPath = path.Clean(mountPath)
+		if other, ok := mounts[mountPath]; ok {
+			mf.add("mount path %q conflicts with %s", mountPath, other)
+			return
+		}
+		mounts[mountPath] = field
+	}
+	names := map[string]int{}
+	for i, volume := range s.ServiceVolumeMapList {
+		vf := f.at("service_volume_map_list[%d]", i)
+		if other, ok := names[volume.VolumeName]; ok {
+			vf.at("volume_name").add("volume name %q conflicts with service_volume_map_list[%d]", volume.VolumeName, other)
+		} else {
+			names[volume.VolumeName] = i
+		}
+		addMount(vf.at("volume_path"), volume.VolumeMountPath, fmt.Sprintf("service_volume_map_list[%d]", i))
+		volume.validateCapacity(vf)
+	}
+	for i, mnt := range s.MntReleationList {
+		addMount(f.at("mnt_relation_list[%d].mnt_dir", i), mnt.VolumeMountDir, fmt.Sprintf("mnt_relation_list[%d]", i))
+	}
+	for i, env := range s.Envs {
+		validateEnvName(f.at("service_env_map_list[%d].attr_name", i), env.AttrName)
+	}
+	for i, env := range s.ServiceConnectInfoMapList {
+		validateEnvName(f.at("service_connect_info_map_list[%d].attr_name", i), env.AttrName)
+	}
+	for i, config := range s.ServicePluginConfigs {
+		cf := f.at("service_related_plugin_config[%d]", i)
+		if config.MemoryRequired < 0 {
+			cf.at("memory_required").addStrict("memory %d can not be negative", config.MemoryRequired)
+		}
+		if config.CPURequired < 0 {
+			cf.at("cpu_required").addStrict("cpu %d can not be negative", config.CPURequired)
+		}
+	}
+}
+
+func (s *Component) hasPort(port int) bool {
+	for _, p := range s.Ports {
+		if p.ContainerPort == port {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Component) hasVolume(name string) bool {
+	for _, v := range s.ServiceVolumeMapList {
+		if v.VolumeName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validate the zero min node means the default min node, the zero max node means not limited
+func (s ComponentExtendMethodRule) validate(f fieldErrors) {
+	def := DefaultExtendMethodRule()
+	if s.MinNode < 0 || s.MinNode > def.MaxNode {
+		f.at("min_node").add("min node %d is out of range [%d, %d]", s.MinNode, def.MinNode, def.MaxNode)
+	}
+	if s.MaxNode < 0 || s.MaxNode > def.MaxNode {
+		f.at("max_node").add("max node %d is out of range [%d, %d]", s.MaxNode, def.MinNode, def.MaxNode)
+	} else if s.MaxNode != 0 && s.MaxNode < s.MinNode {
+		f.at("max_node").add("max node %d is less than min node %d", s.MaxNode, s.MinNode)
+	}
+	if s.StepNode < 0 {
+		f.at("step_node").add("step node %d can not be negative", s.StepNode)
+	}
+	if s.MinMemory < 0 {
+		f.at("min_memory").add("min memory %d can not be negative", s.MinMemory)
+	}
+	if s.MaxMemory < 0 {
+		f.at("max_memory").add("max memory %d can not be negative", s.MaxMemory)
+	} else if s.MaxMemory != 0 && s.MaxMemory < s.MinMemory {
+		f.at("max_memory").add("max memory %d is less than min memory %d", s.MaxMemory, s.MinMemory)
+	}
+	if s.StepMemory < 0 {
+		f.at("step_memory").add("step memory %d can not be negative", s.StepMemory)
+	}
+}
+
+// validateCapacity the config files have no capacity, the zero capacity of the other volumes is not limited.
+// The volume types are not limited, the clusters may define their own storage types.
+func (s ComponentVolume) validateCapacity(f fieldErrors) {
+	if s.VolumeType == ConfigFileVolumeType {
+		if s.VolumeCapacity != 0 {
+			f.at("volume_capacity").add("%s volume has no capacity", s.VolumeType)
+		}
+		return
+	}
+	if s.VolumeCapacity < 0 {
+		f.at("volume_capacity").addStrict("capacity %d can not be negative", s.VolumeCapacity)
+	}
+}
+
+// validate the env names of the options injected as envs
+func (s *Plugin) validate(f fieldErrors) {
+	if s.PluginKey == "" {
+		f.at("plugin_key").add("plugin key is required")
+	}
+	for i, group := range s.ConfigGroups {
+		if group.Injection != EnvPluginInjection {
+			continue
+		}
+		for j, option := range group.Options {
+			validateEnvName(f.at("config_groups[%d].options[%d].attr_name", i, j), option.AttrName)
+		}
+	}
+}
+
+func validateEnvName(f fieldErrors, name string) {
+	if !envNameRegexp.MatchString(name) {
+		f.add("env name %q is not a valid identifier", name)
+	}
+}
@@ -0,0 +1,131 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package v1alpha1
+
+import (
+	"testing"
+)
+
+func newValidationTestConfig() *RainbondApplicationConfig {
+	return &RainbondApplicationConfig{
+		Components: []*Component{
+			{
+				ServiceKey:   "mysql",
+				ServiceCname: "MySQL",
+				DeployType:   StateSingletonDeployType,
+				Ports:        []ComponentPort{{PortAlias: "MYSQL", ContainerPort: 3306}},
+				ServiceVolumeMapList: ComponentVolumeList{
+					{VolumeName: "data", VolumeMountPath: "/var/lib/mysql", VolumeType: LocalVolumeType, VolumeCapacity: 10},
+				},
+				ServiceConnectInfoMapList: []ComponentEnv{{AttrName: "MYSQL_HOST"}},
+			},
+			{
+				ServiceKey:           "wordpress",
+				ServiceCname:         "WordPress",
+				DeployType:           StatelessMultipleDeployType,
+				Ports:                []ComponentPort{{PortAlias: "HTTP", ContainerPort: 80}},
+				DepServiceMapList:    []ComponentDep{{DepServiceKey: "mysql"}},
+				ServicePluginConfigs: []ComponentPluginConfig{{PluginKey: "log"}},
+				ExtendMethodRule:     ComponentExtendMethodRule{MinNode: 2, MaxNode: 4},
+			},
+		},
+		Plugins:           []Plugin{{PluginKey: "log"}},
+		IngressHTTPRoutes: []IngressHTTPRoute{{TargetComponent: TargetComponent{ComponentKey: "wordpress", Port: 80}}},
+	}
+}
+
+func TestValidation(t *testing.T) {
+	if err := newValidationTestConfig().Validation(); err != nil {
+		t.Fatal(err)
+	}
+	ram := newValidationTestConfig()
+	mysql, wordpress := ram.Components[0], ram.Components[1]
+	wordpress.ServiceKey = "mysql"
+	wordpress.ServiceCname = "MySQL"
+	wordpress.DeployType = "unknown"
+	wordpress.DepServiceMapList = append(wordpress.DepServiceMapList, ComponentDep{DepServiceKey: "redis"})
+	wordpress.ServicePluginConfigs[0].PluginKey = "missing"
+	wordpress.ExtendMethodRule = ComponentExtendMethodRule{MinNode: 3, MaxNode: 2}
+	wordpress.Ports = append(wordpress.Ports, ComponentPort{PortAlias: "http", ContainerPort: 80})
+	wordpress.Envs = []ComponentEnv{{AttrName: "DB-NAME"}}
+	mysql.ServiceVolumeMapList = append(mysql.ServiceVolumeMapList,
+		ComponentVolume{VolumeName: "conf", VolumeMountPath: "/var/lib/mysql/", VolumeType: ConfigFileVolumeType, VolumeCapacity: 1})
+	ram.IngressSreamRoutes = []IngressStreamRoute{{TargetComponent: TargetComponent{ComponentKey: "mysql", Port: 3307}}}
+	err := ram.Validation()
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expect validation errors, got %v", err)
+	}
+	expect := []string{
+		"apps[1].service_key",
+		"apps[1].service_cname",
+		"apps[1].extend_method",
+		"apps[1].extend_method_map.max_node",
+		"apps[1].port_map_list[1].container_port",
+		"apps[1].port_map_list[1].port_alias",
+		"apps[1].service_env_map_list[0].attr_name",
+		"apps[0].service_volume_map_list[1].volume_path",
+		"apps[0].service_volume_map_list[1].volume_capacity",
+		"apps[1].dep_service_map_list[0].dep_service_key",
+		"apps[1].dep_service_map_list[1].dep_service_key",
+		"apps[1].service_related_plugin_config[0].plugin_key",
+		"ingress_http_routes[0].component_key",
+		"ingress_stream_routes[0].port",
+	}
+	paths := map[string]bool{}
+	for _, fe := range errs {
+		paths[fe.Path] = true
+	}
+	for _, path := range expect {
+		if !paths[path] {
+			t.Fatalf("expect error at %s, got %v", path, errs)
+		}
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("expect %d errors, got %v", len(expect), errs)
+	}
+}
+
+func TestComponentValidationPath(t *testing.T) {
+	com := Component{ServiceCname: "test", ServiceVolumeMapList: ComponentVolumeList{{VolumeName: "data", VolumeMountPath: "data", VolumeType: "nfs"}}}
+	errs, ok := com.Validation().(ValidationErrors)
+	// the volume types of the clusters are not limited
+	if !ok || len(errs) != 1 || errs[0].Path != "service_volume_map_list[0].volume_path" {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func TestConversionValidation(t *testing.T) {
+	ram := newValidationTestConfig()
+	wordpress := ram.Components[1]
+	wordpress.DeployType = "unknown"
+	wordpress.Memory = -1
+	wordpress.ServicePluginConfigs[0].PluginKey = "missing"
+	if err := ram.ConversionValidation(); err != nil {
+		t.Fatalf("the fields diagnosed by the converters are rejected: %v", err)
+	}
+	errs, ok := ram.Validation().(ValidationErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expect 3 validation errors, got %v", errs)
+	}
+	wordpress.Ports[0].ContainerPort = 0
+	if err := ram.ConversionValidation(); err == nil {
+		t.Fatal("expect error for port out of range")
+	}
+}
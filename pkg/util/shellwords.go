@@ -0,0 +1,230 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+//ShellWordsMapper maps the parts of the shell words, the literal text and the references
+//of environment variables ($NAME or ${NAME}). The nil functions keep the parts unchanged.
+type ShellWordsMapper struct {
+	Literal   func(text string) string
+	Reference func(name string) string
+}
+
+//SplitShellWords split the command line into words with the shell semantics, references of
+//environment variables are kept in the ${NAME} form
+func SplitShellWords(line string) ([]string, error) {
+	return ShellWordsMapper{}.Split(line)
+}
+
+//Split split the command line into words. The words are separated by unquoted blanks, the single
+//quotes keep the text literally, the double quotes keep the text except the references and the
+//escapes of $ ` " \, an unquoted backslash escapes the next character. The command substitution
+//and the parameter expansion operators are not supported.
+func (m ShellWordsMapper) Split(line string) ([]string, error) {
+	var words []string
+	var word, literal strings.Builder
+	// a word is found even though it is empty, such as ''
+	var inWord bool
+	flushLiteral := func() {
+		if literal.Len() == 0 {
+			return
+		}
+		if m.Literal != nil {
+			word.WriteString(m.Literal(literal.String()))
+		} else {
+			word.WriteString(literal.String())
+		}
+		literal.Reset()
+	}
+	reference := func(name string) {
+		flushLiteral()
+		if m.Reference != nil {
+			word.WriteString(m.Reference(name))
+		} else {
+			word.WriteString("${" + name + "}")
+		}
+	}
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				flushLiteral()
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '\\':
+			if i+1 == len(runes) {
+				inWord = true
+				literal.WriteRune(r)
+				continue
+			}
+			i++
+			// line continuation
+			if runes[i] != '\n' {
+				inWord = true
+				literal.WriteRune(runes[i])
+			}
+		case r == '\'':
+			inWord = true
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote at %d", i)
+			}
+			literal.WriteString(string(runes[i+1 : end]))
+			i = end
+		case r == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(runes); i++ {
+				r = runes[i]
+				if r == '"' {
+					closed = true
+					break
+				}
+				if r == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+					i++
+					if runes[i] != '\n' {
+						literal.WriteRune(runes[i])
+					}
+					continue
+				}
+				if r == '$' {
+					name, next, err := parseReference(runes, i)
+					if err != nil {
+						return nil, err
+					}
+					if name != "" {
+						reference(name)
+						i = next - 1
+						continue
+					}
+				}
+				if r == '`' {
+					return nil, fmt.Errorf("command substitution is not supported at %d", i)
+				}
+				literal.WriteRune(r)
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+		case r == '$':
+			inWord = true
+			name, next, err := parseReference(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			if name == "" {
+				literal.WriteRune(r)
+				continue
+			}
+			reference(name)
+			i = next - 1
+		case r == '`':
+			return nil, fmt.Errorf("command substitution is not supported at %d", i)
+		default:
+			inWord = true
+			literal.WriteRune(r)
+		}
+	}
+	if inWord {
+		flushLiteral()
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// parseReference parse the reference start at the $ of runes[i], returns the name and the index
+// after the reference. An empty name means the $ is a literal.
+func parseReference(runes []rune, i int) (string, int, error) {
+	if i+1 < len(runes) && runes[i+1] == '{' {
+		end := indexRune(runes, i+2, '}')
+		if end < 0 {
+			return "", 0, fmt.Errorf("unterminated parameter at %d", i)
+		}
+		name := string(runes[i+2 : end])
+		if !isEnvName(name) {
+			return "", 0, fmt.Errorf("bad substitution ${%s} at %d", name, i)
+		}
+		return name, end + 1, nil
+	}
+	if i+1 < len(runes) && runes[i+1] == '(' {
+		return "", 0, fmt.Errorf("command substitution is not supported at %d", i)
+	}
+	end := i + 1
+	for end < len(runes) && isEnvNameRune(runes[end], end == i+1) {
+		end++
+	}
+	return string(runes[i+1 : end]), end, nil
+}
+
+func indexRune(runes []rune, start int, r rune) int {
+	for i := start; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !isEnvNameRune(r, i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isEnvNameRune(r rune, first bool) bool {
+	if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+		return true
+	}
+	return !first && r >= '0' && r <= '9'
+}
+
+//QuoteShellWord quote the word so that it is parsed by the shell as the literal text
+func QuoteShellWord(word string) string {
+	if word == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(word, " \t\r\n'\"\\$`|&;<>()*?[]#~{}!") {
+		return word
+	}
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+//JoinShellWords join the literal words into a command line, it is the reverse of SplitShellWords
+//for the words without references
+func JoinShellWords(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, QuoteShellWord(word))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,79 @@
+// RAINBOND, Application Management Platform
+// Copyright (C) 2020-2020 Goodrain Co., Ltd.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version. For any non-GPL usage of Rainbond,
+// one or multiple Commercial Licenses authorized by Goodrain Co., Ltd.
+// must be obtained first.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		line  string
+		words []string
+	}{
+		{line: "", words: nil},
+		{line: "   ", words: nil},
+		{line: "nginx  -g   'daemon off;'", words: []string{"nginx", "-g", "daemon off;"}},
+		{line: `echo "a \"b\" c" d\ e ''`, words: []string{"echo", `a "b" c`, "d e", ""}},
+		{line: `sh -c 'echo $HOME'`, words: []string{"sh", "-c", "echo $HOME"}},
+		{line: `java $JAVA_OPTS -Dport="${PORT}" \$1`, words: []string{"java", "${JAVA_OPTS}", "-Dport=${PORT}", "$1"}},
+		{line: "run \\\n --fast", words: []string{"run", "--fast"}},
+	}
+	for _, test := range tests {
+		words, err := SplitShellWords(test.line)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(words, test.words) {
+			t.Fatalf("%q: expect %q, got %q", test.line, test.words, words)
+		}
+	}
+	for _, line := range []string{`echo 'a`, `echo "a`, "echo `date`", "echo $(date)", "echo ${A:-b}", "echo ${"} {
+		if _, err := SplitShellWords(line); err == nil {
+			t.Fatalf("%q: expect error", line)
+		}
+	}
+}
+
+func TestShellWordsMapper(t *testing.T) {
+	mapper := ShellWordsMapper{
+		Literal:   func(text string) string { return text + "!" },
+		Reference: func(name string) string { return "$(" + name + ")" },
+	}
+	words, err := mapper.Split(`a$B "c${D}"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(words, []string{"a!$(B)", "c!$(D)"}) {
+		t.Fatalf("unexpected words %q", words)
+	}
+}
+
+func TestJoinShellWords(t *testing.T) {
+	words := []string{"sh", "-c", "echo 'a' $HOME", "", "x=1"}
+	line := JoinShellWords(words)
+	parsed, err := SplitShellWords(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, words) {
+		t.Fatalf("%s: expect %q, got %q", line, words, parsed)
+	}
+}